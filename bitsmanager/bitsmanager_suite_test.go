@@ -0,0 +1,13 @@
+package bitsmanager_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBitsmanager(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Bitsmanager Suite")
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"sync"
 
+	"code.cloudfoundry.org/cli/cf/api/resources"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
 )
 
@@ -38,12 +39,26 @@ type FakeApplicationBitsRepository struct {
 		result2 string
 		result3 error
 	}
-	UploadBitsStub        func(appGUID string, zipFile io.ReadCloser, fileSize int64) (apiErr error)
+	MatchResourcesStub        func(appResources []resources.AppFileResource) ([]resources.AppFileResource, error)
+	matchResourcesMutex       sync.RWMutex
+	matchResourcesArgsForCall []struct {
+		appResources []resources.AppFileResource
+	}
+	matchResourcesReturns struct {
+		result1 []resources.AppFileResource
+		result2 error
+	}
+	matchResourcesReturnsOnCall map[int]struct {
+		result1 []resources.AppFileResource
+		result2 error
+	}
+	UploadBitsStub        func(appGUID string, zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) (apiErr error)
 	uploadBitsMutex       sync.RWMutex
 	uploadBitsArgsForCall []struct {
-		appGUID  string
-		zipFile  io.ReadCloser
-		fileSize int64
+		appGUID          string
+		zipFile          io.ReadCloser
+		fileSize         int64
+		matchedResources []resources.AppFileResource
 	}
 	uploadBitsReturns struct {
 		result1 error
@@ -51,6 +66,20 @@ type FakeApplicationBitsRepository struct {
 	uploadBitsReturnsOnCall map[int]struct {
 		result1 error
 	}
+	UploadPackageBitsStub        func(packageGUID string, zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) error
+	uploadPackageBitsMutex       sync.RWMutex
+	uploadPackageBitsArgsForCall []struct {
+		packageGUID      string
+		zipFile          io.ReadCloser
+		fileSize         int64
+		matchedResources []resources.AppFileResource
+	}
+	uploadPackageBitsReturns struct {
+		result1 error
+	}
+	uploadPackageBitsReturnsOnCall map[int]struct {
+		result1 error
+	}
 	CopyBitsStub        func(origAppGuid string, newAppGuid string) error
 	copyBitsMutex       sync.RWMutex
 	copyBitsArgsForCall []struct {
@@ -173,18 +202,80 @@ func (fake *FakeApplicationBitsRepository) IsDiffReturnsOnCall(i int, result1 bo
 	}{result1, result2, result3}
 }
 
-func (fake *FakeApplicationBitsRepository) UploadBits(appGUID string, zipFile io.ReadCloser, fileSize int64) (apiErr error) {
+func (fake *FakeApplicationBitsRepository) MatchResources(appResources []resources.AppFileResource) ([]resources.AppFileResource, error) {
+	var appResourcesCopy []resources.AppFileResource
+	if appResources != nil {
+		appResourcesCopy = make([]resources.AppFileResource, len(appResources))
+		copy(appResourcesCopy, appResources)
+	}
+	fake.matchResourcesMutex.Lock()
+	ret, specificReturn := fake.matchResourcesReturnsOnCall[len(fake.matchResourcesArgsForCall)]
+	fake.matchResourcesArgsForCall = append(fake.matchResourcesArgsForCall, struct {
+		appResources []resources.AppFileResource
+	}{appResourcesCopy})
+	fake.recordInvocation("MatchResources", []interface{}{appResourcesCopy})
+	fake.matchResourcesMutex.Unlock()
+	if fake.MatchResourcesStub != nil {
+		return fake.MatchResourcesStub(appResources)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.matchResourcesReturns.result1, fake.matchResourcesReturns.result2
+}
+
+func (fake *FakeApplicationBitsRepository) MatchResourcesCallCount() int {
+	fake.matchResourcesMutex.RLock()
+	defer fake.matchResourcesMutex.RUnlock()
+	return len(fake.matchResourcesArgsForCall)
+}
+
+func (fake *FakeApplicationBitsRepository) MatchResourcesArgsForCall(i int) []resources.AppFileResource {
+	fake.matchResourcesMutex.RLock()
+	defer fake.matchResourcesMutex.RUnlock()
+	return fake.matchResourcesArgsForCall[i].appResources
+}
+
+func (fake *FakeApplicationBitsRepository) MatchResourcesReturns(result1 []resources.AppFileResource, result2 error) {
+	fake.MatchResourcesStub = nil
+	fake.matchResourcesReturns = struct {
+		result1 []resources.AppFileResource
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeApplicationBitsRepository) MatchResourcesReturnsOnCall(i int, result1 []resources.AppFileResource, result2 error) {
+	fake.MatchResourcesStub = nil
+	if fake.matchResourcesReturnsOnCall == nil {
+		fake.matchResourcesReturnsOnCall = make(map[int]struct {
+			result1 []resources.AppFileResource
+			result2 error
+		})
+	}
+	fake.matchResourcesReturnsOnCall[i] = struct {
+		result1 []resources.AppFileResource
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeApplicationBitsRepository) UploadBits(appGUID string, zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) (apiErr error) {
+	var matchedResourcesCopy []resources.AppFileResource
+	if matchedResources != nil {
+		matchedResourcesCopy = make([]resources.AppFileResource, len(matchedResources))
+		copy(matchedResourcesCopy, matchedResources)
+	}
 	fake.uploadBitsMutex.Lock()
 	ret, specificReturn := fake.uploadBitsReturnsOnCall[len(fake.uploadBitsArgsForCall)]
 	fake.uploadBitsArgsForCall = append(fake.uploadBitsArgsForCall, struct {
-		appGUID  string
-		zipFile  io.ReadCloser
-		fileSize int64
-	}{appGUID, zipFile, fileSize})
-	fake.recordInvocation("UploadBits", []interface{}{appGUID, zipFile, fileSize})
+		appGUID          string
+		zipFile          io.ReadCloser
+		fileSize         int64
+		matchedResources []resources.AppFileResource
+	}{appGUID, zipFile, fileSize, matchedResourcesCopy})
+	fake.recordInvocation("UploadBits", []interface{}{appGUID, zipFile, fileSize, matchedResourcesCopy})
 	fake.uploadBitsMutex.Unlock()
 	if fake.UploadBitsStub != nil {
-		return fake.UploadBitsStub(appGUID, zipFile, fileSize)
+		return fake.UploadBitsStub(appGUID, zipFile, fileSize, matchedResources)
 	}
 	if specificReturn {
 		return ret.result1
@@ -198,10 +289,10 @@ func (fake *FakeApplicationBitsRepository) UploadBitsCallCount() int {
 	return len(fake.uploadBitsArgsForCall)
 }
 
-func (fake *FakeApplicationBitsRepository) UploadBitsArgsForCall(i int) (string, io.ReadCloser, int64) {
+func (fake *FakeApplicationBitsRepository) UploadBitsArgsForCall(i int) (string, io.ReadCloser, int64, []resources.AppFileResource) {
 	fake.uploadBitsMutex.RLock()
 	defer fake.uploadBitsMutex.RUnlock()
-	return fake.uploadBitsArgsForCall[i].appGUID, fake.uploadBitsArgsForCall[i].zipFile, fake.uploadBitsArgsForCall[i].fileSize
+	return fake.uploadBitsArgsForCall[i].appGUID, fake.uploadBitsArgsForCall[i].zipFile, fake.uploadBitsArgsForCall[i].fileSize, fake.uploadBitsArgsForCall[i].matchedResources
 }
 
 func (fake *FakeApplicationBitsRepository) UploadBitsReturns(result1 error) {
@@ -223,6 +314,62 @@ func (fake *FakeApplicationBitsRepository) UploadBitsReturnsOnCall(i int, result
 	}{result1}
 }
 
+func (fake *FakeApplicationBitsRepository) UploadPackageBits(packageGUID string, zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) error {
+	var matchedResourcesCopy []resources.AppFileResource
+	if matchedResources != nil {
+		matchedResourcesCopy = make([]resources.AppFileResource, len(matchedResources))
+		copy(matchedResourcesCopy, matchedResources)
+	}
+	fake.uploadPackageBitsMutex.Lock()
+	ret, specificReturn := fake.uploadPackageBitsReturnsOnCall[len(fake.uploadPackageBitsArgsForCall)]
+	fake.uploadPackageBitsArgsForCall = append(fake.uploadPackageBitsArgsForCall, struct {
+		packageGUID      string
+		zipFile          io.ReadCloser
+		fileSize         int64
+		matchedResources []resources.AppFileResource
+	}{packageGUID, zipFile, fileSize, matchedResourcesCopy})
+	fake.recordInvocation("UploadPackageBits", []interface{}{packageGUID, zipFile, fileSize, matchedResourcesCopy})
+	fake.uploadPackageBitsMutex.Unlock()
+	if fake.UploadPackageBitsStub != nil {
+		return fake.UploadPackageBitsStub(packageGUID, zipFile, fileSize, matchedResources)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.uploadPackageBitsReturns.result1
+}
+
+func (fake *FakeApplicationBitsRepository) UploadPackageBitsCallCount() int {
+	fake.uploadPackageBitsMutex.RLock()
+	defer fake.uploadPackageBitsMutex.RUnlock()
+	return len(fake.uploadPackageBitsArgsForCall)
+}
+
+func (fake *FakeApplicationBitsRepository) UploadPackageBitsArgsForCall(i int) (string, io.ReadCloser, int64, []resources.AppFileResource) {
+	fake.uploadPackageBitsMutex.RLock()
+	defer fake.uploadPackageBitsMutex.RUnlock()
+	return fake.uploadPackageBitsArgsForCall[i].packageGUID, fake.uploadPackageBitsArgsForCall[i].zipFile, fake.uploadPackageBitsArgsForCall[i].fileSize, fake.uploadPackageBitsArgsForCall[i].matchedResources
+}
+
+func (fake *FakeApplicationBitsRepository) UploadPackageBitsReturns(result1 error) {
+	fake.UploadPackageBitsStub = nil
+	fake.uploadPackageBitsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeApplicationBitsRepository) UploadPackageBitsReturnsOnCall(i int, result1 error) {
+	fake.UploadPackageBitsStub = nil
+	if fake.uploadPackageBitsReturnsOnCall == nil {
+		fake.uploadPackageBitsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.uploadPackageBitsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeApplicationBitsRepository) CopyBits(origAppGuid string, newAppGuid string) error {
 	fake.copyBitsMutex.Lock()
 	ret, specificReturn := fake.copyBitsReturnsOnCall[len(fake.copyBitsArgsForCall)]
@@ -279,8 +426,12 @@ func (fake *FakeApplicationBitsRepository) Invocations() map[string][][]interfac
 	defer fake.getApplicationSha1Mutex.RUnlock()
 	fake.isDiffMutex.RLock()
 	defer fake.isDiffMutex.RUnlock()
+	fake.matchResourcesMutex.RLock()
+	defer fake.matchResourcesMutex.RUnlock()
 	fake.uploadBitsMutex.RLock()
 	defer fake.uploadBitsMutex.RUnlock()
+	fake.uploadPackageBitsMutex.RLock()
+	defer fake.uploadPackageBitsMutex.RUnlock()
 	fake.copyBitsMutex.RLock()
 	defer fake.copyBitsMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
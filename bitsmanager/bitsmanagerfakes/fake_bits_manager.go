@@ -20,6 +20,18 @@ type FakeBitsManager struct {
 	uploadReturnsOnCall map[int]struct {
 		result1 error
 	}
+	UploadPackageStub        func(packageGuid string, path string) error
+	uploadPackageMutex       sync.RWMutex
+	uploadPackageArgsForCall []struct {
+		packageGuid string
+		path        string
+	}
+	uploadPackageReturns struct {
+		result1 error
+	}
+	uploadPackageReturnsOnCall map[int]struct {
+		result1 error
+	}
 	CopyBitsStub        func(origAppGuid string, newAppGuid string) error
 	copyBitsMutex       sync.RWMutex
 	copyBitsArgsForCall []struct {
@@ -45,6 +57,19 @@ type FakeBitsManager struct {
 		result1 string
 		result2 error
 	}
+	GetLegacySha1Stub        func(path string) (sha1 string, err error)
+	getLegacySha1Mutex       sync.RWMutex
+	getLegacySha1ArgsForCall []struct {
+		path string
+	}
+	getLegacySha1Returns struct {
+		result1 string
+		result2 error
+	}
+	getLegacySha1ReturnsOnCall map[int]struct {
+		result1 string
+		result2 error
+	}
 	IsDiffStub        func(path string, currentSha1 string) (isDiff bool, sha1 string, err error)
 	isDiffMutex       sync.RWMutex
 	isDiffArgsForCall []struct {
@@ -114,6 +139,55 @@ func (fake *FakeBitsManager) UploadReturnsOnCall(i int, result1 error) {
 	}{result1}
 }
 
+func (fake *FakeBitsManager) UploadPackage(packageGuid string, path string) error {
+	fake.uploadPackageMutex.Lock()
+	ret, specificReturn := fake.uploadPackageReturnsOnCall[len(fake.uploadPackageArgsForCall)]
+	fake.uploadPackageArgsForCall = append(fake.uploadPackageArgsForCall, struct {
+		packageGuid string
+		path        string
+	}{packageGuid, path})
+	fake.recordInvocation("UploadPackage", []interface{}{packageGuid, path})
+	fake.uploadPackageMutex.Unlock()
+	if fake.UploadPackageStub != nil {
+		return fake.UploadPackageStub(packageGuid, path)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fake.uploadPackageReturns.result1
+}
+
+func (fake *FakeBitsManager) UploadPackageCallCount() int {
+	fake.uploadPackageMutex.RLock()
+	defer fake.uploadPackageMutex.RUnlock()
+	return len(fake.uploadPackageArgsForCall)
+}
+
+func (fake *FakeBitsManager) UploadPackageArgsForCall(i int) (string, string) {
+	fake.uploadPackageMutex.RLock()
+	defer fake.uploadPackageMutex.RUnlock()
+	return fake.uploadPackageArgsForCall[i].packageGuid, fake.uploadPackageArgsForCall[i].path
+}
+
+func (fake *FakeBitsManager) UploadPackageReturns(result1 error) {
+	fake.UploadPackageStub = nil
+	fake.uploadPackageReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBitsManager) UploadPackageReturnsOnCall(i int, result1 error) {
+	fake.UploadPackageStub = nil
+	if fake.uploadPackageReturnsOnCall == nil {
+		fake.uploadPackageReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.uploadPackageReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
 func (fake *FakeBitsManager) CopyBits(origAppGuid string, newAppGuid string) error {
 	fake.copyBitsMutex.Lock()
 	ret, specificReturn := fake.copyBitsReturnsOnCall[len(fake.copyBitsArgsForCall)]
@@ -214,6 +288,57 @@ func (fake *FakeBitsManager) GetSha1ReturnsOnCall(i int, result1 string, result2
 	}{result1, result2}
 }
 
+func (fake *FakeBitsManager) GetLegacySha1(path string) (sha1 string, err error) {
+	fake.getLegacySha1Mutex.Lock()
+	ret, specificReturn := fake.getLegacySha1ReturnsOnCall[len(fake.getLegacySha1ArgsForCall)]
+	fake.getLegacySha1ArgsForCall = append(fake.getLegacySha1ArgsForCall, struct {
+		path string
+	}{path})
+	fake.recordInvocation("GetLegacySha1", []interface{}{path})
+	fake.getLegacySha1Mutex.Unlock()
+	if fake.GetLegacySha1Stub != nil {
+		return fake.GetLegacySha1Stub(path)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.getLegacySha1Returns.result1, fake.getLegacySha1Returns.result2
+}
+
+func (fake *FakeBitsManager) GetLegacySha1CallCount() int {
+	fake.getLegacySha1Mutex.RLock()
+	defer fake.getLegacySha1Mutex.RUnlock()
+	return len(fake.getLegacySha1ArgsForCall)
+}
+
+func (fake *FakeBitsManager) GetLegacySha1ArgsForCall(i int) string {
+	fake.getLegacySha1Mutex.RLock()
+	defer fake.getLegacySha1Mutex.RUnlock()
+	return fake.getLegacySha1ArgsForCall[i].path
+}
+
+func (fake *FakeBitsManager) GetLegacySha1Returns(result1 string, result2 error) {
+	fake.GetLegacySha1Stub = nil
+	fake.getLegacySha1Returns = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeBitsManager) GetLegacySha1ReturnsOnCall(i int, result1 string, result2 error) {
+	fake.GetLegacySha1Stub = nil
+	if fake.getLegacySha1ReturnsOnCall == nil {
+		fake.getLegacySha1ReturnsOnCall = make(map[int]struct {
+			result1 string
+			result2 error
+		})
+	}
+	fake.getLegacySha1ReturnsOnCall[i] = struct {
+		result1 string
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeBitsManager) IsDiff(path string, currentSha1 string) (isDiff bool, sha1 string, err error) {
 	fake.isDiffMutex.Lock()
 	ret, specificReturn := fake.isDiffReturnsOnCall[len(fake.isDiffArgsForCall)]
@@ -274,10 +399,14 @@ func (fake *FakeBitsManager) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.uploadMutex.RLock()
 	defer fake.uploadMutex.RUnlock()
+	fake.uploadPackageMutex.RLock()
+	defer fake.uploadPackageMutex.RUnlock()
 	fake.copyBitsMutex.RLock()
 	defer fake.copyBitsMutex.RUnlock()
 	fake.getSha1Mutex.RLock()
 	defer fake.getSha1Mutex.RUnlock()
+	fake.getLegacySha1Mutex.RLock()
+	defer fake.getLegacySha1Mutex.RUnlock()
 	fake.isDiffMutex.RLock()
 	defer fake.isDiffMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
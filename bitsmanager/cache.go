@@ -0,0 +1,183 @@
+package bitsmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BitsCache keep downloaded files and git checkouts on disk to not fetch them again between runs of terraform,
+// an empty Dir disables cache. Cache folder can be removed at any time.
+//
+// Layout of the folder:
+// - blobs/sha256/<hex>: downloaded files by digest of their content
+// - http/<key of url>.json: digest of the content of an url with its ETag and Last-Modified headers
+// - git/<key of repo>/<commit hash>: checkout of a repo at a commit (without .git folder)
+// - local/<tree fingerprint>: digest of the zip of a local folder, folder is not zipped again while it is not touched
+// - tmp: files being written, they are moved atomically to their place when complete
+type BitsCache struct {
+	Dir string
+}
+
+type httpCacheEntry struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+	Digest       string `json:"digest"`
+}
+
+func NewBitsCache(dir string) BitsCache {
+	return BitsCache{Dir: dir}
+}
+func (c BitsCache) IsEnabled() bool {
+	return c.Dir != ""
+}
+
+// cacheKey give a name usable on any filesystem for the given parts
+func cacheKey(parts ...string) string {
+	h := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(h[:])
+}
+
+// tmpDir give folder where files are written before being moved, it is on the same filesystem than the cache
+func (c BitsCache) tmpDir() (string, error) {
+	dir := filepath.Join(c.Dir, "tmp")
+	return dir, os.MkdirAll(dir, 0755)
+}
+func (c BitsCache) blobPath(digest string) string {
+	return filepath.Join(c.Dir, "blobs", CHECKSUM_TYPE_SHA256, strings.TrimPrefix(digest, CHECKSUM_TYPE_SHA256+":"))
+}
+
+// newBlobFile give a file where content of a blob can be written before being stored with storeBlobFile
+func (c BitsCache) newBlobFile() (*os.File, error) {
+	tmpDir, err := c.tmpDir()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(tmpDir, "blob")
+}
+
+// storeBlobFile move a file written in cache folder to its place by digest and give its digest
+func (c BitsCache) storeBlobFile(path string) (string, error) {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+	blobPath := c.blobPath(digest)
+	err = os.MkdirAll(filepath.Dir(blobPath), 0755)
+	if err != nil {
+		return "", err
+	}
+	return digest, os.Rename(path, blobPath)
+}
+
+// fileDigest give sha256 digest of a file content
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, file)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s", CHECKSUM_TYPE_SHA256, hex.EncodeToString(h.Sum(nil))), nil
+}
+func (c BitsCache) httpEntryPath(url string) string {
+	return filepath.Join(c.Dir, "http", cacheKey(url)+".json")
+}
+
+// httpEntry give what is known about an url, entry is not found when its content is not in cache anymore
+func (c BitsCache) httpEntry(url string) (httpCacheEntry, bool) {
+	var entry httpCacheEntry
+	b, err := ioutil.ReadFile(c.httpEntryPath(url))
+	if err != nil {
+		return entry, false
+	}
+	err = json.Unmarshal(b, &entry)
+	if err != nil || entry.Url != url {
+		return entry, false
+	}
+	if _, err := os.Stat(c.blobPath(entry.Digest)); err != nil {
+		return entry, false
+	}
+	return entry, true
+}
+func (c BitsCache) setHttpEntry(entry httpCacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return c.writeFile(c.httpEntryPath(entry.Url), b)
+}
+
+// writeFile replace atomically content of a file, a concurrent reader never see a partial file
+func (c BitsCache) writeFile(path string, content []byte) error {
+	tmpDir, err := c.tmpDir()
+	if err != nil {
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(tmpDir, "entry")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(content)
+	tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func (c BitsCache) localDigestPath(fingerprint string) string {
+	return filepath.Join(c.Dir, "local", fingerprint)
+}
+
+// localDigest give digest of the zip of a folder by its tree fingerprint (see GetTreeFingerprint)
+func (c BitsCache) localDigest(fingerprint string) (string, bool) {
+	b, err := ioutil.ReadFile(c.localDigestPath(fingerprint))
+	if err != nil || len(b) == 0 {
+		return "", false
+	}
+	return string(b), true
+}
+func (c BitsCache) setLocalDigest(fingerprint, digest string) error {
+	return c.writeFile(c.localDigestPath(fingerprint), []byte(digest))
+}
+
+// gitCheckoutPath give folder of a checkout of a repo at a commit, submodules are part of the key
+// as a checkout with submodules doesn't have the same content
+func (c BitsCache) gitCheckoutPath(url string, submodules bool, commit string) string {
+	return filepath.Join(c.Dir, "git", cacheKey(url, fmt.Sprintf("submodules=%t", submodules)), commit)
+}
+
+// storeGitCheckout move a checkout in the cache, checkout is removed when an other one was stored in the meantime
+func (c BitsCache) storeGitCheckout(checkoutDir, url string, submodules bool, commit string) (string, error) {
+	cachePath := c.gitCheckoutPath(url, submodules, commit)
+	err := os.MkdirAll(filepath.Dir(cachePath), 0755)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(checkoutDir, cachePath)
+	if err != nil {
+		if _, errStat := os.Stat(cachePath); errStat == nil {
+			os.RemoveAll(checkoutDir)
+			return cachePath, nil
+		}
+		return "", err
+	}
+	return cachePath, nil
+}
@@ -0,0 +1,149 @@
+package bitsmanager
+
+import (
+	"code.cloudfoundry.org/cli/cf/appfiles"
+	"code.cloudfoundry.org/cli/util/glob"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileFilter select files of an app which are sent to Cloud Foundry.
+// Files ignored by .cfignore of the app (and default files ignored by cf cli, e.g.: .git) are never sent,
+// files matching one of Excludes patterns are not sent and, when Includes is set, only files matching one of its patterns are sent.
+// Patterns follow .cfignore syntax.
+type FileFilter struct {
+	Excludes []string
+	Includes []string
+}
+
+func (f FileFilter) IsEmpty() bool {
+	return len(f.Excludes) == 0 && len(f.Includes) == 0
+}
+
+// Sha1 make a fingerprint from the fingerprint of the source and the patterns used to select files,
+// fingerprint is given as is when there is no patterns
+func (f FileFilter) Sha1(sourceSha1 string) string {
+	if f.IsEmpty() {
+		return sourceSha1
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", sourceSha1)
+	fmt.Fprintf(h, "excludes:%s\n", strings.Join(f.Excludes, "\n"))
+	fmt.Fprintf(h, "includes:%s\n", strings.Join(f.Includes, "\n"))
+	return fmt.Sprintf("%s:%s", CHECKSUM_TYPE_SHA256, hex.EncodeToString(h.Sum(nil)))
+}
+
+// cfIgnore load .cfignore of the folder with exclude patterns added at the end
+func (f FileFilter) cfIgnore(dir string) appfiles.CfIgnore {
+	content, err := ioutil.ReadFile(filepath.Join(dir, ".cfignore"))
+	if err != nil {
+		content = []byte{}
+	}
+	return appfiles.NewCfIgnore(string(content) + "\n" + strings.Join(f.Excludes, "\n"))
+}
+
+func (f FileFilter) includeGlobs() ([]glob.Glob, error) {
+	includes := make([]glob.Glob, 0)
+	for _, pattern := range f.Includes {
+		globs, err := globsForPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		includes = append(includes, globs...)
+	}
+	return includes, nil
+}
+func (f FileFilter) isIncluded(includes []glob.Glob, relPath string) bool {
+	if len(includes) == 0 {
+		return true
+	}
+	for _, include := range includes {
+		if include.Match(relPath) || include.Match("/"+relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Walk call onEachFile on each folder and regular file of dir which must be sent, relPath is in unix format
+func (f FileFilter) Walk(dir string, onEachFile func(relPath string, fullPath string, fileInfo os.FileInfo) error) error {
+	ignore := f.cfIgnore(dir)
+	includes, err := f.includeGlobs()
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(dir, func(fullPath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fullPath == dir {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, fullPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if ignore.FileShouldBeIgnored(relPath) {
+			if fileInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fileInfo.Mode().IsRegular() && !fileInfo.IsDir() {
+			return nil
+		}
+		// folders are walked even when not included, they may contain included files
+		if !f.isIncluded(includes, relPath) {
+			return nil
+		}
+		return onEachFile(relPath, fullPath, fileInfo)
+	})
+}
+
+// IsIncluded tells if a file (path relative to app root in unix format) of an archive must be sent,
+// .cfignore can't be read before archive is unpacked, only default ignored files and patterns are used
+func (f FileFilter) IsIncluded(relPath string) (bool, error) {
+	relPath = strings.TrimSuffix(relPath, "/")
+	if appfiles.NewCfIgnore(strings.Join(f.Excludes, "\n")).FileShouldBeIgnored(relPath) {
+		return false, nil
+	}
+	includes, err := f.includeGlobs()
+	if err != nil {
+		return false, err
+	}
+	return f.isIncluded(includes, relPath), nil
+}
+
+// globsForPattern follow matching rules of .cfignore, a pattern matches a file or a folder and everything inside,
+// at any depth when it doesn't start with /
+func globsForPattern(pattern string) ([]glob.Glob, error) {
+	pattern = path.Clean(strings.TrimSpace(pattern))
+	patterns := []string{
+		pattern,
+		path.Join(pattern, "*"),
+		path.Join(pattern, "**", "*"),
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		patterns = append(patterns,
+			path.Join("**", pattern),
+			path.Join("**", pattern, "*"),
+			path.Join("**", pattern, "**", "*"),
+		)
+	}
+	globs := make([]glob.Glob, len(patterns))
+	for i, p := range patterns {
+		g, err := glob.CompileGlob(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern '%s': %s", pattern, err.Error())
+		}
+		globs[i] = g
+	}
+	return globs, nil
+}
@@ -0,0 +1,119 @@
+package bitsmanager_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("FileFilter", func() {
+	var appPath string
+	writeFile := func(name, content string) {
+		path := filepath.Join(appPath, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+	walkedFiles := func(filter FileFilter) []string {
+		files := make([]string, 0)
+		err := filter.Walk(appPath, func(relPath string, fullPath string, fileInfo os.FileInfo) error {
+			if !fileInfo.IsDir() {
+				files = append(files, relPath)
+			}
+			return nil
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return files
+	}
+	BeforeEach(func() {
+		var err error
+		appPath, err = ioutil.TempDir("", "file-filter")
+		Expect(err).ToNot(HaveOccurred())
+		writeFile(".git/HEAD", "ref: refs/heads/master")
+		writeFile(".cfignore", "fixtures\n")
+		writeFile("fixtures/data.json", "{}")
+		writeFile("node_modules/.cache/entry", "cache")
+		writeFile("node_modules/lib/index.js", "lib")
+		writeFile("lib/app.jar", "jar")
+		writeFile("manifest.yml", "---")
+	})
+	AfterEach(func() {
+		os.RemoveAll(appPath)
+	})
+	Describe("Walk", func() {
+		It("should follow .cfignore and default files ignored by cf cli", func() {
+			Expect(walkedFiles(FileFilter{})).To(Equal([]string{
+				"lib/app.jar",
+				"node_modules/.cache/entry",
+				"node_modules/lib/index.js",
+			}))
+		})
+		It("should not walk excluded files", func() {
+			Expect(walkedFiles(FileFilter{Excludes: []string{".cache"}})).To(Equal([]string{
+				"lib/app.jar",
+				"node_modules/lib/index.js",
+			}))
+		})
+		It("should only walk included files which are not excluded", func() {
+			filter := FileFilter{
+				Includes: []string{"lib", "/node_modules"},
+				Excludes: []string{"node_modules/lib"},
+			}
+			Expect(walkedFiles(filter)).To(Equal([]string{
+				"lib/app.jar",
+				"node_modules/.cache/entry",
+			}))
+		})
+	})
+	Describe("Sha1", func() {
+		It("should give fingerprint of the source as is when there is no patterns", func() {
+			Expect(FileFilter{}.Sha1("sha256:abc")).To(Equal("sha256:abc"))
+		})
+		It("should give a different fingerprint when patterns change", func() {
+			first := FileFilter{Excludes: []string{"fixtures"}}.Sha1("sha256:abc")
+			second := FileFilter{Excludes: []string{"fixtures", "*.log"}}.Sha1("sha256:abc")
+			Expect(first).To(HavePrefix("sha256:"))
+			Expect(first).ToNot(Equal("sha256:abc"))
+			Expect(first).ToNot(Equal(second))
+		})
+	})
+	Describe("on tar archives", func() {
+		It("should only convert selected files to zip", func() {
+			buf := new(bytes.Buffer)
+			tarWriter := tar.NewWriter(buf)
+			for _, name := range []string{"app/index.js", "app/test/fixture.json", "app/.git/HEAD"} {
+				Expect(tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 2})).To(Succeed())
+				_, err := tarWriter.Write([]byte("{}"))
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(tarWriter.Close()).To(Succeed())
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(buf.Bytes())
+			}))
+			defer server.Close()
+
+			handler := NewHttpHandler(false, HttpClientConfig{}, BitsCache{}, ArtifactVerifier{}, FileFilter{Excludes: []string{"test"}})
+			fileHandler, err := handler.GetZipFile(server.URL + "/app.tar")
+			Expect(err).ToNot(HaveOccurred())
+			defer fileHandler.Clean()
+			content, err := ioutil.ReadAll(fileHandler.ZipFile)
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+			Expect(err).ToNot(HaveOccurred())
+			names := make([]string, 0)
+			for _, file := range reader.File {
+				names = append(names, file.Name)
+			}
+			Expect(names).To(Equal([]string{"app/index.js"}))
+		})
+	})
+})
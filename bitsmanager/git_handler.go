@@ -3,21 +3,33 @@ package bitsmanager
 import (
 	"crypto/tls"
 	"fmt"
-	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/common"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
 	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
 	"io/ioutil"
+	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 )
 
+// GitSshConfig is used to clone repos through ssh, ssh agent is used when there is no private key
+// and ~/.ssh/known_hosts (or files in env var SSH_KNOWN_HOSTS) when there is no known hosts file.
+type GitSshConfig struct {
+	PrivateKey     string
+	Passphrase     string
+	KnownHostsFile string
+}
+
 type GitHandler struct {
+	Filter    FileFilter
+	SshConfig GitSshConfig
+	Cache     BitsCache
+	Verifier  ArtifactVerifier
 }
 
-func NewGitHandler(skipInsecureSSL bool) *GitHandler {
+func NewGitHandler(skipInsecureSSL bool, sshConfig GitSshConfig, cache BitsCache, verifier ArtifactVerifier, filter FileFilter) *GitHandler {
 	customClient := &http.Client{
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: skipInsecureSSL},
@@ -27,21 +39,30 @@ func NewGitHandler(skipInsecureSSL bool) *GitHandler {
 		"https",
 		githttp.NewClient(customClient),
 	)
-	return &GitHandler{}
+	return &GitHandler{
+		Filter:    filter,
+		SshConfig: sshConfig,
+		Cache:     cache,
+		Verifier:  verifier,
+	}
 }
 func (h GitHandler) GetZipFile(path string) (FileHandler, error) {
-	tmpDir, err := ioutil.TempDir("", "git-tf")
+	source, err := parseGitSource(path)
 	if err != nil {
 		return FileHandler{}, err
 	}
-	gitUtils := h.makeGitUtils(tmpDir, path)
-	err = gitUtils.Clone()
+	checkoutDir, cleanCheckout, err := h.checkout(source)
 	if err != nil {
 		return FileHandler{}, err
 	}
-	err = os.RemoveAll(filepath.Join(tmpDir, ".git"))
-	localFh, err := NewLocalHandler().GetZipFile(tmpDir)
+	appDir := filepath.Join(checkoutDir, filepath.FromSlash(source.SubDir))
+	if fileInfo, err := os.Stat(appDir); err != nil || !fileInfo.IsDir() {
+		cleanCheckout()
+		return FileHandler{}, fmt.Errorf("Folder '%s' cannot be found in git repository '%s'.", source.SubDir, source.Url)
+	}
+	localFh, err := NewLocalHandler(BitsCache{}, h.Filter).GetZipFile(appDir)
 	if err != nil {
+		cleanCheckout()
 		return FileHandler{}, err
 	}
 	cleanFunc := func() error {
@@ -49,7 +70,7 @@ func (h GitHandler) GetZipFile(path string) (FileHandler, error) {
 		if err != nil {
 			return err
 		}
-		return os.RemoveAll(tmpDir)
+		return cleanCheckout()
 	}
 	return FileHandler{
 		ZipFile: localFh.ZipFile,
@@ -57,42 +78,160 @@ func (h GitHandler) GetZipFile(path string) (FileHandler, error) {
 		Clean:   cleanFunc,
 	}, nil
 }
-func (h GitHandler) makeGitUtils(tmpDir, path string) *GitUtils {
-	u, _ := url.Parse(path)
 
-	refName := "master"
-	if u.Fragment != "" {
-		refName = u.Fragment
+// checkout clone the repo without its .git folder and give the folder with a function to remove it,
+// when cache is enabled a commit already cloned is taken from cache and a new checkout is kept in cache.
+// Signature of a commit can only be checked on a clone, a checkout in cache is not reused when signatures are verified.
+func (h GitHandler) checkout(source gitSource) (string, func() error, error) {
+	noClean := func() error {
+		return nil
+	}
+	tmpParentDir := ""
+	if h.Cache.IsEnabled() && h.Verifier.PublicKey == "" {
+		gitUtils, err := h.makeGitUtils("", source)
+		if err != nil {
+			return "", nil, err
+		}
+		commit, err := gitUtils.GetCommitSha1()
+		if err != nil {
+			return "", nil, err
+		}
+		err = h.Verifier.VerifyCommit(source.Url, commit)
+		if err != nil {
+			return "", nil, err
+		}
+		cachePath := h.Cache.gitCheckoutPath(source.Url, source.Submodules, commit)
+		if _, err := os.Stat(cachePath); err == nil {
+			log.Printf("[DEBUG] commit %s of %s is taken from cache", commit, source.Url)
+			return cachePath, noClean, nil
+		}
+		tmpParentDir, err = h.Cache.tmpDir()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	tmpDir, err := ioutil.TempDir(tmpParentDir, "git-tf")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanFunc := func() error {
+		return os.RemoveAll(tmpDir)
+	}
+	gitUtils, err := h.makeGitUtils(tmpDir, source)
+	if err != nil {
+		cleanFunc()
+		return "", nil, err
+	}
+	commit, err := gitUtils.Clone()
+	if err != nil {
+		cleanFunc()
+		return "", nil, err
+	}
+	err = h.Verifier.VerifyCommit(source.Url, commit)
+	if err != nil {
+		cleanFunc()
+		return "", nil, err
+	}
+	err = h.verifyCommitSignature(gitUtils, source, commit)
+	if err != nil {
+		cleanFunc()
+		return "", nil, err
+	}
+	err = os.RemoveAll(filepath.Join(tmpDir, ".git"))
+	if err != nil {
+		cleanFunc()
+		return "", nil, err
+	}
+	if !h.Cache.IsEnabled() || h.Verifier.PublicKey != "" {
+		return tmpDir, cleanFunc, nil
+	}
+	cachePath, err := h.Cache.storeGitCheckout(tmpDir, source.Url, source.Submodules, commit)
+	if err != nil {
+		cleanFunc()
+		return "", nil, err
+	}
+	return cachePath, noClean, nil
+}
+func (h GitHandler) verifyCommitSignature(gitUtils *GitUtils, source gitSource, commit string) error {
+	if h.Verifier.PublicKey == "" {
+		return nil
+	}
+	payload, signature, err := gitUtils.CommitSignature(commit)
+	if err != nil {
+		return err
 	}
-	var authMethod transport.AuthMethod
-	if u.User != nil {
-		password, _ := u.User.Password()
-		authMethod = githttp.NewBasicAuth(u.User.Username(), password)
+	return h.Verifier.VerifyCommitSignature(source.Url, commit, payload, signature)
+}
+func (h GitHandler) makeGitUtils(tmpDir string, source gitSource) (*GitUtils, error) {
+	authMethod, err := h.authMethod(source)
+	if err != nil {
+		return nil, err
 	}
 	gitUtils := &GitUtils{
-		Url:        fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, u.Path),
+		Url:        source.Url,
 		Folder:     tmpDir,
-		RefName:    refName,
+		RefName:    source.RefName,
 		AuthMethod: authMethod,
+		Submodules: source.Submodules,
 	}
-	return gitUtils
+	return gitUtils, nil
+}
+func (h GitHandler) authMethod(source gitSource) (transport.AuthMethod, error) {
+	if !source.IsSsh() {
+		if source.Username == "" {
+			return nil, nil
+		}
+		return githttp.NewBasicAuth(source.Username, source.Password), nil
+	}
+	if h.SshConfig.PrivateKey == "" && h.SshConfig.KnownHostsFile == "" {
+		// default auth of go-git is used: ssh agent
+		return nil, nil
+	}
+	var authMethod gitssh.AuthMethod
+	var err error
+	if h.SshConfig.PrivateKey != "" {
+		authMethod, err = gitssh.NewPublicKeys(source.SshUser(), []byte(h.SshConfig.PrivateKey), h.SshConfig.Passphrase)
+	} else {
+		authMethod, err = gitssh.NewSSHAgentAuth(source.SshUser())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create ssh auth for git repository '%s': %s", source.Url, err.Error())
+	}
+	if h.SshConfig.KnownHostsFile == "" {
+		return authMethod, nil
+	}
+	hostKeyCallback, err := gitssh.NewKnownHostsCallback(h.SshConfig.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load known hosts file '%s': %s", h.SshConfig.KnownHostsFile, err.Error())
+	}
+	switch auth := authMethod.(type) {
+	case *gitssh.PublicKeys:
+		auth.HostKeyCallback = hostKeyCallback
+	case *gitssh.PublicKeysCallback:
+		auth.HostKeyCallback = hostKeyCallback
+	}
+	return authMethod, nil
 }
 func (h GitHandler) GetSha1File(path string) (string, error) {
-	tmpDir, err := ioutil.TempDir("", "git-tf")
+	source, err := parseGitSource(path)
 	if err != nil {
 		return "", err
 	}
-	defer os.RemoveAll(tmpDir)
-	gitUtils := h.makeGitUtils(tmpDir, path)
-	return gitUtils.GetCommitSha1()
-}
-func (h GitHandler) Detect(path string) bool {
-	if !common.IsWebURL(path) {
-		return false
+	gitUtils, err := h.makeGitUtils("", source)
+	if err != nil {
+		return "", err
 	}
-	u, err := url.Parse(path)
+	commitSha1, err := gitUtils.GetCommitSha1()
 	if err != nil {
-		return false
+		return "", err
 	}
-	return HasExtFile(u.Path, ".git")
+	err = h.Verifier.VerifyCommit(source.Url, commitSha1)
+	if err != nil {
+		return "", err
+	}
+	return h.Filter.Sha1(commitSha1), nil
+}
+func (h GitHandler) Detect(path string) bool {
+	_, err := parseGitSource(path)
+	return err == nil
 }
@@ -0,0 +1,104 @@
+package bitsmanager
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var scpLikeGitUrlRegex = regexp.MustCompile(`^[\w.-]+@[\w.-]+:[^/]`)
+
+var gitSchemes = []string{"http", "https", "ssh", "git", "file"}
+
+// gitSource is a git path given to an app, it follows the scheme:
+// <repo url ending with .git>[//subdir][?submodules=true][#tag-or-branch-or-commit-hash]
+// repo url can be an http(s) url (with optional basic auth user:password@), an ssh url (ssh://git@host/repo.git or git@host:repo.git)
+// or a file url
+type gitSource struct {
+	Url        string
+	RefName    string
+	SubDir     string
+	Submodules bool
+	Username   string
+	Password   string
+}
+
+func parseGitSource(gitPath string) (gitSource, error) {
+	source := gitSource{RefName: "master"}
+	if i := strings.LastIndex(gitPath, "#"); i >= 0 {
+		if gitPath[i+1:] != "" {
+			source.RefName = gitPath[i+1:]
+		}
+		gitPath = gitPath[:i]
+	}
+	if i := strings.Index(gitPath, "?"); i >= 0 {
+		query, err := url.ParseQuery(gitPath[i+1:])
+		if err != nil {
+			return source, fmt.Errorf("Invalid options in git path '%s': %s", gitPath, err.Error())
+		}
+		if query.Get("submodules") != "" {
+			source.Submodules, err = strconv.ParseBool(query.Get("submodules"))
+			if err != nil {
+				return source, fmt.Errorf("Invalid submodules option in git path '%s': %s", gitPath, err.Error())
+			}
+		}
+		gitPath = gitPath[:i]
+	}
+	if i := strings.Index(gitPath, ".git//"); i >= 0 {
+		source.SubDir = strings.TrimPrefix(path.Clean("/"+gitPath[i+len(".git//"):]), "/")
+		gitPath = gitPath[:i+len(".git")]
+	}
+	if !strings.HasSuffix(gitPath, ".git") {
+		return source, fmt.Errorf("Git path '%s' must end with .git", gitPath)
+	}
+	if scpLikeGitUrlRegex.MatchString(gitPath) && !strings.Contains(gitPath, "://") {
+		source.Url = gitPath
+		return source, nil
+	}
+	u, err := url.Parse(gitPath)
+	if err != nil {
+		return source, err
+	}
+	if !isGitScheme(u.Scheme) {
+		return source, fmt.Errorf("Scheme '%s' is not supported for git path '%s'", u.Scheme, gitPath)
+	}
+	// credentials are given to an auth method for http(s), ssh user stays in url
+	if u.User != nil && (u.Scheme == "http" || u.Scheme == "https") {
+		source.Username = u.User.Username()
+		source.Password, _ = u.User.Password()
+		u.User = nil
+	}
+	source.Url = u.String()
+	return source, nil
+}
+func isGitScheme(scheme string) bool {
+	for _, gitScheme := range gitSchemes {
+		if scheme == gitScheme {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSsh tells if repo must be cloned through ssh
+func (s gitSource) IsSsh() bool {
+	return strings.HasPrefix(s.Url, "ssh://") || !strings.Contains(s.Url, "://")
+}
+
+// SshUser give user to connect with through ssh, git by default
+func (s gitSource) SshUser() string {
+	if strings.HasPrefix(s.Url, "ssh://") {
+		u, err := url.Parse(s.Url)
+		if err == nil && u.User != nil {
+			return u.User.Username()
+		}
+		return "git"
+	}
+	if i := strings.Index(s.Url, "@"); i >= 0 {
+		return s.Url[:i]
+	}
+	return "git"
+}
@@ -1,11 +1,16 @@
 package bitsmanager
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"io"
 	"os"
+	"regexp"
 	"strings"
 )
 
@@ -14,39 +19,91 @@ type GitUtils struct {
 	Url        string
 	RefName    string
 	AuthMethod transport.AuthMethod
+	Submodules bool
 }
 
 var refTypes []string = []string{"heads", "tags"}
 
-func (g GitUtils) Clone() error {
-	_, err := g.findRepo(false)
+var commitHashRegex = regexp.MustCompile("^[0-9a-fA-F]{40}$")
+
+// Clone checkout the repo in Folder and give the commit checked out
+func (g GitUtils) Clone() (string, error) {
+	repo, err := g.findRepo(false)
 	if err != nil {
-		return err
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
 	}
-	return nil
+	return head.Hash().String(), nil
 }
+
+// GetCommitSha1 give commit referenced by RefName, references of the remote are listed (as git ls-remote does)
+// to not clone the repo
 func (g GitUtils) GetCommitSha1() (string, error) {
 	if g.refNameIsHash() {
-		return g.RefName, nil
+		return strings.ToLower(g.RefName), nil
+	}
+	endpoint, err := transport.NewEndpoint(g.Url)
+	if err != nil {
+		return "", err
 	}
-	repo, err := g.findRepo(true)
+	gitClient, err := client.NewClient(endpoint)
 	if err != nil {
 		return "", err
 	}
-	iter, err := repo.Log(&git.LogOptions{})
+	session, err := gitClient.NewUploadPackSession(endpoint, g.AuthMethod)
 	if err != nil {
 		return "", err
 	}
-	defer iter.Close()
-	commit, err := iter.Next()
+	defer session.Close()
+	advRefs, err := session.AdvertisedReferences()
 	if err != nil {
 		return "", err
 	}
-	return commit.Hash.String(), nil
+	refs, err := advRefs.AllReferences()
+	if err != nil {
+		return "", err
+	}
+	for _, refType := range refTypes {
+		refName := fmt.Sprintf("refs/%s/%s", refType, strings.ToLower(g.RefName))
+		// annotated tags are peeled to the commit they point to
+		if hash, ok := advRefs.Peeled[refName]; ok {
+			return hash.String(), nil
+		}
+		if ref, ok := refs[plumbing.ReferenceName(refName)]; ok {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("Reference '%s' cannot be found in git repository '%s'.", g.RefName, g.Url)
 }
 func (g GitUtils) refNameIsHash() bool {
-	return len(g.RefName) == 40
+	return commitHashRegex.MatchString(g.RefName)
+}
+
+// recurseSubmodules give how deep submodules are cloned, they are only cloned when asked and when there is a worktree
+func (g GitUtils) recurseSubmodules(isBare bool) git.SubmoduleRescursivity {
+	if !g.Submodules || isBare {
+		return git.NoRecurseSubmodules
+	}
+	return git.DefaultSubmoduleRecursionDepth
+}
+
+// updateSubmodules checkout submodules at the commits referenced by the current worktree
+func (g GitUtils) updateSubmodules(tree *git.Worktree) error {
+	submodules, err := tree.Submodules()
+	if err != nil {
+		return err
+	}
+	return submodules.Update(&git.SubmoduleUpdateOptions{
+		Init:              true,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Auth:              g.AuthMethod,
+	})
 }
+
+// findRepoFromHash clone whole history of the repo, a commit which is not at the top of a branch can't be cloned alone
 func (g GitUtils) findRepoFromHash(isBare bool) (*git.Repository, error) {
 	repo, err := git.PlainClone(g.Folder, isBare, &git.CloneOptions{
 		URL:  g.Url,
@@ -66,6 +123,12 @@ func (g GitUtils) findRepoFromHash(isBare bool) (*git.Repository, error) {
 	if err != nil {
 		return nil, err
 	}
+	if g.Submodules {
+		err = g.updateSubmodules(tree)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return repo, nil
 }
 func (g GitUtils) findRepo(isBare bool) (repo *git.Repository, err error) {
@@ -74,26 +137,92 @@ func (g GitUtils) findRepo(isBare bool) (repo *git.Repository, err error) {
 		return
 	}
 	for _, refType := range refTypes {
-		repo, err = git.PlainClone(g.Folder, isBare, &git.CloneOptions{
-			URL:          g.Url,
-			SingleBranch: true,
-			Auth:         g.AuthMethod,
-			ReferenceName: plumbing.ReferenceName(fmt.Sprintf(
-				"refs/%s/%s",
-				refType,
-				strings.ToLower(g.RefName),
-			)),
-			Depth: 1,
-		})
+		repo, err = g.cloneRef(isBare, plumbing.ReferenceName(fmt.Sprintf(
+			"refs/%s/%s",
+			refType,
+			strings.ToLower(g.RefName),
+		)))
 		if err == nil {
 			return
 		}
 		if err.Error() == "reference not found" {
-			os.RemoveAll(g.Folder)
-			os.Mkdir(g.Folder, 0777)
+			g.cleanFolder()
 			continue
 		}
 		return
 	}
 	return
 }
+
+// cloneRef make a shallow clone of the ref, only the commit referenced is needed,
+// whole branch is cloned when git server doesn't support shallow clones
+func (g GitUtils) cloneRef(isBare bool, refName plumbing.ReferenceName) (*git.Repository, error) {
+	cloneOpts := &git.CloneOptions{
+		URL:               g.Url,
+		SingleBranch:      true,
+		Auth:              g.AuthMethod,
+		ReferenceName:     refName,
+		Depth:             1,
+		RecurseSubmodules: g.recurseSubmodules(isBare),
+	}
+	repo, err := git.PlainClone(g.Folder, isBare, cloneOpts)
+	if err == nil || !strings.Contains(err.Error(), "shallow") {
+		return repo, err
+	}
+	g.cleanFolder()
+	cloneOpts.Depth = 0
+	// go-git fetch tag alone only on shallow clone, tag is found when fetching branches
+	cloneOpts.SingleBranch = !refName.IsTag()
+	return git.PlainClone(g.Folder, isBare, cloneOpts)
+}
+func (g GitUtils) cleanFolder() {
+	os.RemoveAll(g.Folder)
+	os.Mkdir(g.Folder, 0777)
+}
+
+// CommitSignature give content signed by a commit of the repo cloned in Folder with its armored signature (gpgsig header),
+// signed content is the raw commit without its gpgsig header as git verify-commit does.
+// Signature is empty when commit is not signed.
+func (g GitUtils) CommitSignature(commit string) ([]byte, []byte, error) {
+	repo, err := git.PlainOpen(g.Folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, err := repo.Storer.EncodedObject(plumbing.CommitObject, plumbing.NewHash(commit))
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := obj.Reader()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+	payload := &bytes.Buffer{}
+	signature := &bytes.Buffer{}
+	inHeaders := true
+	inSignature := false
+	r := bufio.NewReader(reader)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		if inHeaders && inSignature && bytes.HasPrefix(line, []byte(" ")) {
+			// continuation line of the signature
+			signature.Write(line[1:])
+		} else if inHeaders && bytes.HasPrefix(line, []byte("gpgsig ")) {
+			inSignature = true
+			signature.Write(bytes.TrimPrefix(line, []byte("gpgsig ")))
+		} else {
+			inSignature = false
+			if inHeaders && len(bytes.TrimSpace(line)) == 0 {
+				inHeaders = false
+			}
+			payload.Write(line)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return payload.Bytes(), signature.Bytes(), nil
+}
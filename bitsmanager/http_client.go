@@ -0,0 +1,218 @@
+package bitsmanager
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// HttpRetryWait is the wait before the first retry of a failed download, it doubles on each retry
+var HttpRetryWait = 1 * time.Second
+
+const httpMaxRetryWait = 30 * time.Second
+
+const httpMaxRedirects = 10
+
+// HttpCredential is sent to hosts matching Host pattern (e.g.: artifactory.example.com, *.example.com or host:8443),
+// Token is sent as bearer token, otherwise Username and Password are sent as basic auth.
+// Headers are added to each request sent to these hosts.
+type HttpCredential struct {
+	Host     string
+	Username string
+	Password string
+	Token    string
+	Headers  map[string]string
+}
+
+// HttpClientConfig configure downloads of app bits: credentials by host, retries of failed requests
+// and timeout to connect and to receive response headers (a download itself is not limited in time)
+type HttpClientConfig struct {
+	Credentials []HttpCredential
+	Retries     int
+	Timeout     time.Duration
+}
+
+// credential give the first credential whose host pattern matches host of the url
+func (c HttpClientConfig) credential(u *url.URL) (HttpCredential, bool) {
+	for _, credential := range c.Credentials {
+		pattern := strings.ToLower(credential.Host)
+		for _, host := range []string{strings.ToLower(u.Host), strings.ToLower(u.Hostname())} {
+			if ok, _ := path.Match(pattern, host); ok {
+				return credential, true
+			}
+		}
+	}
+	return HttpCredential{}, false
+}
+
+// newRequest make a GET request with credentials and headers of the host, user info given in url takes precedence
+func (h HttpHandler) newRequest(path string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	h.setCredential(req)
+	return req, nil
+}
+
+// setCredential add credential and headers of the host of the request, if any
+func (h HttpHandler) setCredential(req *http.Request) {
+	credential, ok := h.ClientConfig.credential(req.URL)
+	if !ok {
+		return
+	}
+	for key, value := range credential.Headers {
+		req.Header.Set(key, value)
+	}
+	if req.URL.User != nil {
+		return
+	}
+	if credential.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+credential.Token)
+	} else if credential.Username != "" {
+		req.SetBasicAuth(credential.Username, credential.Password)
+	}
+}
+
+// checkRedirect make sure that credentials of a host are not sent to the host a request is redirected to
+// (e.g.: to a presigned url of a bucket), only its own credential is sent when it matches one.
+func (h HttpHandler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= httpMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", httpMaxRedirects)
+	}
+	if credential, ok := h.ClientConfig.credential(via[0].URL); ok {
+		for key := range credential.Headers {
+			req.Header.Del(key)
+		}
+		req.Header.Del("Authorization")
+	}
+	h.setCredential(req)
+	return nil
+}
+
+func isRetryableStatus(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout
+}
+
+// waitBeforeRetry wait more and more after each failed attempt
+func (h HttpHandler) waitBeforeRetry(path string, attempt int, lastErr error) {
+	wait := HttpRetryWait << uint(attempt-1)
+	if wait > httpMaxRetryWait || wait <= 0 {
+		wait = httpMaxRetryWait
+	}
+	log.Printf("[WARN] request to %s failed (attempt %d/%d), retrying in %s: %s", path, attempt, h.ClientConfig.Retries+1, wait, lastErr.Error())
+	time.Sleep(wait)
+}
+
+// get send a GET request, request is retried on network errors and server errors
+func (h HttpHandler) get(path string, headers http.Header) (*http.Response, error) {
+	client := h.makeHttpClient()
+	var lastErr error
+	for attempt := 0; attempt <= h.ClientConfig.Retries; attempt++ {
+		if attempt > 0 {
+			h.waitBeforeRetry(path, attempt, lastErr)
+		}
+		req, err := h.newRequest(path)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range headers {
+			req.Header[key] = values
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if isRetryableStatus(resp.StatusCode) {
+			lastErr = h.checkRespHttpError(resp)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// downloadToFile write content of the url in file and give headers of the response, or nil when server answered not modified.
+// Failed requests are retried and an interrupted download is resumed from where it stopped with a Range request
+// when response has an ETag or a Last-Modified header to make sure that content didn't change in the meantime.
+func (h HttpHandler) downloadToFile(path string, file *os.File, headers http.Header) (http.Header, error) {
+	client := h.makeHttpClient()
+	var written int64
+	var validator string
+	var respHeader http.Header
+	var lastErr error
+	for attempt := 0; attempt <= h.ClientConfig.Retries; attempt++ {
+		if attempt > 0 {
+			h.waitBeforeRetry(path, attempt, lastErr)
+		}
+		req, err := h.newRequest(path)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range headers {
+			req.Header[key] = values
+		}
+		if written > 0 && validator != "" {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", written))
+			req.Header.Set("If-Range", validator)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			return nil, nil
+		}
+		if isRetryableStatus(resp.StatusCode) || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			lastErr = h.checkRespHttpError(resp)
+			continue
+		}
+		err = h.checkRespHttpError(resp)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			// whole content is sent, download starts again from the beginning
+			written = 0
+			err = truncateFile(file)
+			if err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			respHeader = resp.Header
+			validator = resp.Header.Get("ETag")
+			if validator == "" {
+				validator = resp.Header.Get("Last-Modified")
+			}
+		} else {
+			log.Printf("[INFO] download of %s resumed at %d bytes", path, written)
+		}
+		n, err := io.Copy(file, resp.Body)
+		resp.Body.Close()
+		written += n
+		if err == nil {
+			return respHeader, nil
+		}
+		lastErr = fmt.Errorf("download interrupted after %d bytes: %s", written, err.Error())
+	}
+	return nil, fmt.Errorf("Error occured when dowloading file %s after %d attempts: %s", path, h.ClientConfig.Retries+1, lastErr.Error())
+}
+
+// truncateFile empty a file being downloaded to write it again from the beginning
+func truncateFile(file *os.File) error {
+	err := file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	return err
+}
@@ -9,44 +9,40 @@ import (
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/common"
 	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 type HttpHandler struct {
 	SkipInsecureSSL bool
+	ClientConfig    HttpClientConfig
+	Cache           BitsCache
+	Verifier        ArtifactVerifier
+	Filter          FileFilter
 }
 
-func NewHttpHandler(skipInsecureSSL bool) *HttpHandler {
-	return &HttpHandler{skipInsecureSSL}
+// localCopy is a downloaded file, in cache or in a temporary file
+type localCopy struct {
+	Path   string
+	Digest string
+	Clean  func() error
+}
+
+func NewHttpHandler(skipInsecureSSL bool, clientConfig HttpClientConfig, cache BitsCache, verifier ArtifactVerifier, filter FileFilter) *HttpHandler {
+	return &HttpHandler{skipInsecureSSL, clientConfig, cache, verifier, filter}
 }
 func (h HttpHandler) GetZipFile(path string) (FileHandler, error) {
-	client := h.makeHttpClient()
-	cleanFunc := func() error {
-		return nil
-	}
-	resp, err := client.Get(path)
-	if err != nil {
-		return FileHandler{}, err
-	}
-	err = h.checkRespHttpError(resp)
+	path, verifier, err := h.Verifier.WithChecksumFragment(path)
 	if err != nil {
 		return FileHandler{}, err
 	}
-	if IsTarFile(path) {
-		defer resp.Body.Close()
-		return h.tar2Zip(resp.Body)
-	}
-	if IsTarGzFile(path) {
-		defer resp.Body.Close()
-		return h.targz2Zip(resp.Body)
-	}
-	return FileHandler{
-		ZipFile: resp.Body,
-		Size:    resp.ContentLength,
-		Clean:   cleanFunc,
-	}, nil
+	// file is downloaded before being sent, an interrupted download can be resumed and file can be verified
+	return h.getLocalZipFile(path, verifier)
 }
 func (h HttpHandler) checkRespHttpError(resp *http.Response) error {
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
@@ -66,6 +62,10 @@ func (h HttpHandler) checkRespHttpError(resp *http.Response) error {
 	)
 }
 func (h HttpHandler) Detect(path string) bool {
+	path, _, err := ArtifactVerifier{}.WithChecksumFragment(path)
+	if err != nil {
+		return false
+	}
 	return common.IsWebURL(path) && (IsZipFile(path) || IsTarFile(path) || IsTarGzFile(path))
 }
 func (h HttpHandler) makeHttpClient() *http.Client {
@@ -73,19 +73,29 @@ func (h HttpHandler) makeHttpClient() *http.Client {
 		Proxy:           http.ProxyFromEnvironment,
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: h.SkipInsecureSSL},
 	}
+	if h.ClientConfig.Timeout > 0 {
+		tr.DialContext = (&net.Dialer{
+			Timeout:   h.ClientConfig.Timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		tr.TLSHandshakeTimeout = h.ClientConfig.Timeout
+		tr.ResponseHeaderTimeout = h.ClientConfig.Timeout
+	}
 	return &http.Client{
-		Transport: tr,
-		Timeout:   0,
+		Transport:     tr,
+		CheckRedirect: h.checkRedirect,
+		// a download of big app bits can take long, only connection and response headers are limited in time
+		Timeout: 0,
 	}
 }
-func (h HttpHandler) targz2Zip(r io.ReadCloser) (FileHandler, error) {
+func targz2Zip(r io.ReadCloser, filter FileFilter) (FileHandler, error) {
 	gzf, err := gzip.NewReader(r)
 	if err != nil {
 		return FileHandler{}, err
 	}
-	return h.tar2Zip(gzf)
+	return tar2Zip(gzf, filter)
 }
-func (h HttpHandler) tar2Zip(r io.ReadCloser) (FileHandler, error) {
+func tar2Zip(r io.ReadCloser, filter FileFilter) (FileHandler, error) {
 	zipFile, err := ioutil.TempFile("", "downloads-tf")
 	if err != nil {
 		return FileHandler{}, err
@@ -93,7 +103,7 @@ func (h HttpHandler) tar2Zip(r io.ReadCloser) (FileHandler, error) {
 	cleanFunc := func() error {
 		return os.Remove(zipFile.Name())
 	}
-	err = h.writeTarToZip(r, zipFile)
+	err = writeTarToZip(r, zipFile, filter)
 	if err != nil {
 		zipFile.Close()
 		return FileHandler{}, err
@@ -110,7 +120,7 @@ func (h HttpHandler) tar2Zip(r io.ReadCloser) (FileHandler, error) {
 		Clean:   cleanFunc,
 	}, nil
 }
-func (h HttpHandler) writeTarToZip(r io.Reader, zipFile *os.File) error {
+func writeTarToZip(r io.Reader, zipFile *os.File, filter FileFilter) error {
 	zipWriter := zip.NewWriter(zipFile)
 	defer zipWriter.Close()
 	tarReader := tar.NewReader(r)
@@ -139,6 +149,14 @@ func (h HttpHandler) writeTarToZip(r io.Reader, zipFile *os.File) error {
 			splitFile := strings.Split(header.Name, "/")
 			zipHeader.Name = strings.Join(splitFile[1:], "/")
 		}
+		included, err := filter.IsIncluded(zipHeader.Name)
+		if err != nil {
+			return err
+		}
+		if !included {
+			i++
+			continue
+		}
 		if !fileInfo.IsDir() {
 			zipHeader.Method = zip.Deflate
 		}
@@ -151,23 +169,221 @@ func (h HttpHandler) writeTarToZip(r io.Reader, zipFile *os.File) error {
 			continue
 		}
 		_, err = io.Copy(w, tarReader)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 func (h HttpHandler) GetSha1File(path string) (string, error) {
-	client := h.makeHttpClient()
-	req, err := http.NewRequest("GET", path, nil)
+	path, verifier, err := h.Verifier.WithChecksumFragment(path)
 	if err != nil {
 		return "", err
 	}
-	resp, err := client.Do(req)
+	downloaded, err := h.fetch(path, verifier)
+	if err != nil {
+		return "", err
+	}
+	defer downloaded.Clean()
+	return h.filterSha1(path, downloaded.Digest), nil
+}
+
+// GetLegacySha1File give fingerprint made by previous versions from the first bytes of the response body,
+// a tar archive is not converted to zip
+func (h HttpHandler) GetLegacySha1File(path string) (string, error) {
+	path, _, err := h.Verifier.WithChecksumFragment(path)
+	if err != nil {
+		return "", err
+	}
+	resp, err := h.get(path, http.Header{})
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 	err = h.checkRespHttpError(resp)
 	if err != nil {
 		return "", err
 	}
-	return GetSha1FromReader(resp.Body)
+	return GetLegacySha1FromReader(resp.Body)
+}
+func (h HttpHandler) filterSha1(path, sha1 string) string {
+	if IsTarFile(path) || IsTarGzFile(path) {
+		// patterns only apply on tar archives, zip files are sent as is
+		return h.Filter.Sha1(sha1)
+	}
+	return sha1
+}
+
+// download put content of the url in cache and give its digest, content is only downloaded
+// when it changed since it was cached (server is asked with If-None-Match and If-Modified-Since headers)
+func (h HttpHandler) download(path string) (string, error) {
+	headers := http.Header{}
+	entry, inCache := h.Cache.httpEntry(path)
+	if inCache && entry.ETag != "" {
+		headers.Set("If-None-Match", entry.ETag)
+	}
+	if inCache && entry.LastModified != "" {
+		headers.Set("If-Modified-Since", entry.LastModified)
+	}
+	blobFile, err := h.Cache.newBlobFile()
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(blobFile.Name())
+	respHeader, err := h.downloadToFile(path, blobFile, headers)
+	blobFile.Close()
+	if err != nil {
+		return "", err
+	}
+	if respHeader == nil {
+		if inCache {
+			log.Printf("[DEBUG] %s didn't change, cached file is used", path)
+			return entry.Digest, nil
+		}
+		return "", fmt.Errorf("Error occured when dowloading file %s: unexpected not modified response", path)
+	}
+	digest, err := h.Cache.storeBlobFile(blobFile.Name())
+	if err != nil {
+		return "", err
+	}
+	err = h.Cache.setHttpEntry(httpCacheEntry{
+		Url:          path,
+		ETag:         respHeader.Get("ETag"),
+		LastModified: respHeader.Get("Last-Modified"),
+		Digest:       digest,
+	})
+	if err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// fetch give a verified local copy of the content of the url, it is taken from cache when enabled
+func (h HttpHandler) fetch(path string, verifier ArtifactVerifier) (localCopy, error) {
+	var downloaded localCopy
+	if h.Cache.IsEnabled() {
+		digest, err := h.download(path)
+		if err != nil {
+			return localCopy{}, err
+		}
+		downloaded = localCopy{
+			Path:   h.Cache.blobPath(digest),
+			Digest: digest,
+			Clean: func() error {
+				// file stays in cache
+				return nil
+			},
+		}
+	} else {
+		var err error
+		downloaded, err = h.downloadToTemp(path)
+		if err != nil {
+			return localCopy{}, err
+		}
+	}
+	err := h.verify(path, downloaded, verifier)
+	if err != nil {
+		downloaded.Clean()
+		return localCopy{}, err
+	}
+	return downloaded, nil
+}
+func (h HttpHandler) downloadToTemp(path string) (localCopy, error) {
+	tmpFile, err := ioutil.TempFile("", "downloads-tf")
+	if err != nil {
+		return localCopy{}, err
+	}
+	cleanFunc := func() error {
+		return os.Remove(tmpFile.Name())
+	}
+	_, err = h.downloadToFile(path, tmpFile, http.Header{})
+	tmpFile.Close()
+	if err != nil {
+		cleanFunc()
+		return localCopy{}, err
+	}
+	digest, err := fileDigest(tmpFile.Name())
+	if err != nil {
+		cleanFunc()
+		return localCopy{}, err
+	}
+	return localCopy{
+		Path:   tmpFile.Name(),
+		Digest: digest,
+		Clean:  cleanFunc,
+	}, nil
+}
+
+// verify check pinned digest and signature (downloaded from <url>.asc) of a downloaded file
+func (h HttpHandler) verify(path string, downloaded localCopy, verifier ArtifactVerifier) error {
+	err := verifier.VerifyChecksum(path, downloaded.Digest)
+	if err != nil {
+		return err
+	}
+	if verifier.PublicKey == "" {
+		return nil
+	}
+	signature, err := h.getSignature(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(downloaded.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return verifier.VerifySignature(path, file, signature)
+}
+func (h HttpHandler) getSignature(path string) ([]byte, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += SIGNATURE_EXT
+	resp, err := h.get(u.String(), http.Header{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	err = h.checkRespHttpError(resp)
+	if err != nil {
+		return nil, fmt.Errorf("Signature of '%s' cannot be downloaded: %s", path, err.Error())
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// getLocalZipFile give zip from a verified local copy of the file
+func (h HttpHandler) getLocalZipFile(path string, verifier ArtifactVerifier) (FileHandler, error) {
+	downloaded, err := h.fetch(path, verifier)
+	if err != nil {
+		return FileHandler{}, err
+	}
+	return localCopyToZip(path, downloaded, h.Filter)
+}
+
+// localCopyToZip give zip from a local copy of the file, tar archives are converted
+func localCopyToZip(path string, downloaded localCopy, filter FileFilter) (FileHandler, error) {
+	file, err := os.Open(downloaded.Path)
+	if err != nil {
+		downloaded.Clean()
+		return FileHandler{}, err
+	}
+	if IsTarFile(path) || IsTarGzFile(path) {
+		defer downloaded.Clean()
+		defer file.Close()
+		if IsTarFile(path) {
+			return tar2Zip(file, filter)
+		}
+		return targz2Zip(file, filter)
+	}
+	fs, err := file.Stat()
+	if err != nil {
+		file.Close()
+		downloaded.Clean()
+		return FileHandler{}, err
+	}
+	return FileHandler{
+		ZipFile: file,
+		Size:    fs.Size(),
+		Clean:   downloaded.Clean,
+	}, nil
 }
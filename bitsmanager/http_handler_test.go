@@ -0,0 +1,386 @@
+package bitsmanager_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+var _ = Describe("HttpHandler", func() {
+	Context("with cache", func() {
+		var cacheDir string
+		var server *httptest.Server
+		var content []byte
+		var etag string
+		var downloads int
+		var conditionalRequests int
+		var handler *HttpHandler
+		BeforeEach(func() {
+			var err error
+			cacheDir, err = ioutil.TempDir("", "bits-cache")
+			Expect(err).ToNot(HaveOccurred())
+			content = []byte("zip content v1")
+			etag = `"v1"`
+			downloads = 0
+			conditionalRequests = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Header.Get("If-None-Match") != "" {
+					conditionalRequests++
+				}
+				if req.Header.Get("If-None-Match") == etag {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				downloads++
+				w.Header().Set("ETag", etag)
+				w.Write(content)
+			}))
+			handler = NewHttpHandler(false, HttpClientConfig{}, NewBitsCache(cacheDir), ArtifactVerifier{}, FileFilter{})
+		})
+		AfterEach(func() {
+			server.Close()
+			os.RemoveAll(cacheDir)
+		})
+		It("should give the same digest than without cache", func() {
+			sha1, err := handler.GetSha1File(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+
+			expected, err := GetSha256FromReader(ioutil.NopCloser(bytes.NewReader(content)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sha1).To(Equal(expected))
+		})
+		It("should not download again a file which didn't change", func() {
+			first, err := handler.GetSha1File(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			second, err := handler.GetSha1File(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(second).To(Equal(first))
+
+			fileHandler, err := handler.GetZipFile(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			defer fileHandler.Clean()
+			defer fileHandler.ZipFile.Close()
+			zipContent, err := ioutil.ReadAll(fileHandler.ZipFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(zipContent).To(Equal(content))
+			Expect(fileHandler.Size).To(Equal(int64(len(content))))
+
+			Expect(downloads).To(Equal(1))
+			Expect(conditionalRequests).To(Equal(2))
+		})
+		It("should download a file which changed", func() {
+			first, err := handler.GetSha1File(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+
+			content = []byte("zip content v2")
+			etag = `"v2"`
+			second, err := handler.GetSha1File(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(second).ToNot(Equal(first))
+			Expect(downloads).To(Equal(2))
+		})
+		It("should download again when cached file has been removed", func() {
+			_, err := handler.GetSha1File(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.RemoveAll(cacheDir)).To(Succeed())
+
+			_, err = handler.GetSha1File(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(downloads).To(Equal(2))
+			Expect(conditionalRequests).To(Equal(0))
+		})
+	})
+	Context("with verification", func() {
+		var server *httptest.Server
+		var files map[string][]byte
+		var content []byte
+		var publicKey string
+		var signer *openpgp.Entity
+		sign := func(entity *openpgp.Entity, content []byte) []byte {
+			signature := new(bytes.Buffer)
+			err := openpgp.ArmoredDetachSign(signature, entity, bytes.NewReader(content), nil)
+			Expect(err).ToNot(HaveOccurred())
+			return signature.Bytes()
+		}
+		armoredPublicKey := func(entity *openpgp.Entity) string {
+			buf := new(bytes.Buffer)
+			w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+			Expect(err).ToNot(HaveOccurred())
+			// identities and subkeys of a new entity are only self-signed when serializing private key
+			Expect(entity.SerializePrivate(ioutil.Discard, nil)).To(Succeed())
+			Expect(entity.Serialize(w)).To(Succeed())
+			Expect(w.Close()).To(Succeed())
+			return buf.String()
+		}
+		handler := func(checksum string) *HttpHandler {
+			return NewHttpHandler(false, HttpClientConfig{}, BitsCache{}, NewArtifactVerifier(checksum, publicKey), FileFilter{})
+		}
+		BeforeEach(func() {
+			var err error
+			signer, err = openpgp.NewEntity("build system", "", "build@example.com", nil)
+			Expect(err).ToNot(HaveOccurred())
+			publicKey = ""
+			content = []byte("zip content")
+			files = map[string][]byte{"/app.zip": content}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				file, ok := files[req.URL.Path]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write(file)
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		Context("with a pinned checksum", func() {
+			var checksum string
+			BeforeEach(func() {
+				h := sha256.Sum256(content)
+				checksum = hex.EncodeToString(h[:])
+			})
+			It("should accept file with the same digest given in fragment", func() {
+				sha1, err := handler("").GetSha1File(server.URL + "/app.zip#sha256=" + checksum)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sha1).To(Equal("sha256:" + checksum))
+
+				fileHandler, err := handler("").GetZipFile(server.URL + "/app.zip#sha256=" + checksum)
+				Expect(err).ToNot(HaveOccurred())
+				defer fileHandler.Clean()
+				defer fileHandler.ZipFile.Close()
+				zipContent, err := ioutil.ReadAll(fileHandler.ZipFile)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(zipContent).To(Equal(content))
+			})
+			It("should accept file with the same digest given as path checksum", func() {
+				_, err := handler("sha256:" + checksum).GetSha1File(server.URL + "/app.zip")
+				Expect(err).ToNot(HaveOccurred())
+			})
+			It("should refuse file with another digest", func() {
+				files["/app.zip"] = []byte("tampered content")
+				_, err := handler("").GetSha1File(server.URL + "/app.zip#sha256=" + checksum)
+				Expect(err).To(HaveOccurred())
+				_, err = handler(checksum).GetZipFile(server.URL + "/app.zip")
+				Expect(err).To(HaveOccurred())
+			})
+			It("should refuse different checksums in fragment and path checksum", func() {
+				other := sha256.Sum256([]byte("other"))
+				_, err := handler(hex.EncodeToString(other[:])).GetSha1File(server.URL + "/app.zip#sha256=" + checksum)
+				Expect(err).To(HaveOccurred())
+			})
+			It("should still detect file with a checksum in fragment", func() {
+				Expect(handler("").Detect(server.URL + "/app.zip#sha256=" + checksum)).To(BeTrue())
+			})
+		})
+		Context("with a public key", func() {
+			BeforeEach(func() {
+				publicKey = armoredPublicKey(signer)
+			})
+			It("should accept a file signed by the key", func() {
+				files["/app.zip.asc"] = sign(signer, content)
+				fileHandler, err := handler("").GetZipFile(server.URL + "/app.zip")
+				Expect(err).ToNot(HaveOccurred())
+				fileHandler.ZipFile.Close()
+				fileHandler.Clean()
+			})
+			It("should refuse a file without signature", func() {
+				_, err := handler("").GetZipFile(server.URL + "/app.zip")
+				Expect(err).To(HaveOccurred())
+			})
+			It("should refuse a file which doesn't match its signature", func() {
+				files["/app.zip.asc"] = sign(signer, content)
+				files["/app.zip"] = []byte("tampered content")
+				_, err := handler("").GetSha1File(server.URL + "/app.zip")
+				Expect(err).To(HaveOccurred())
+			})
+			It("should refuse a file signed by another key", func() {
+				other, err := openpgp.NewEntity("someone", "", "someone@example.com", nil)
+				Expect(err).ToNot(HaveOccurred())
+				files["/app.zip.asc"] = sign(other, content)
+				_, err = handler("").GetZipFile(server.URL + "/app.zip")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+	Context("with client config", func() {
+		var server *httptest.Server
+		var content []byte
+		var requests []*http.Request
+		var failures int
+		var cutAt int
+		BeforeEach(func() {
+			HttpRetryWait = time.Millisecond
+			content = []byte("zip content which is sent in several parts")
+			requests = make([]*http.Request, 0)
+			failures = 0
+			cutAt = 0
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				requests = append(requests, req)
+				if failures > 0 {
+					failures--
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Header().Set("ETag", `"v1"`)
+				start := 0
+				if req.Header.Get("Range") != "" && req.Header.Get("If-Range") == `"v1"` {
+					_, err := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-", &start)
+					Expect(err).ToNot(HaveOccurred())
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)-start))
+					w.WriteHeader(http.StatusPartialContent)
+				} else {
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				}
+				if cutAt > 0 {
+					// connection is closed in the middle of the body
+					w.Write(content[start:cutAt])
+					w.(http.Flusher).Flush()
+					cutAt = 0
+					panic(http.ErrAbortHandler)
+				}
+				w.Write(content[start:])
+			}))
+		})
+		AfterEach(func() {
+			HttpRetryWait = time.Second
+			server.Close()
+		})
+		readZip := func(handler *HttpHandler) []byte {
+			fileHandler, err := handler.GetZipFile(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			defer fileHandler.Clean()
+			defer fileHandler.ZipFile.Close()
+			zipContent, err := ioutil.ReadAll(fileHandler.ZipFile)
+			Expect(err).ToNot(HaveOccurred())
+			return zipContent
+		}
+		It("should send bearer token and headers to a matching host", func() {
+			handler := NewHttpHandler(false, HttpClientConfig{
+				Credentials: []HttpCredential{
+					{Host: "other.example.com", Token: "other-token"},
+					{Host: "127.0.0.*", Token: "my-token", Headers: map[string]string{"X-JFrog-Art-Api": "key"}},
+				},
+			}, BitsCache{}, ArtifactVerifier{}, FileFilter{})
+			Expect(readZip(handler)).To(Equal(content))
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer my-token"))
+			Expect(requests[0].Header.Get("X-JFrog-Art-Api")).To(Equal("key"))
+		})
+		It("should send basic auth to a host matching with its port", func() {
+			u, err := url.Parse(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			handler := NewHttpHandler(false, HttpClientConfig{
+				Credentials: []HttpCredential{{Host: u.Host, Username: "user", Password: "pass"}},
+			}, BitsCache{}, ArtifactVerifier{}, FileFilter{})
+			Expect(readZip(handler)).To(Equal(content))
+			username, password, ok := requests[0].BasicAuth()
+			Expect(ok).To(BeTrue())
+			Expect(username).To(Equal("user"))
+			Expect(password).To(Equal("pass"))
+		})
+		It("should not send credentials to other hosts", func() {
+			handler := NewHttpHandler(false, HttpClientConfig{
+				Credentials: []HttpCredential{{Host: "*.example.com", Token: "my-token"}},
+			}, BitsCache{}, ArtifactVerifier{}, FileFilter{})
+			Expect(readZip(handler)).To(Equal(content))
+			Expect(requests[0].Header.Get("Authorization")).To(BeEmpty())
+		})
+		Context("when redirected", func() {
+			var other *httptest.Server
+			var otherRequests []*http.Request
+			var redirectTo string
+			var handler *HttpHandler
+			BeforeEach(func() {
+				otherRequests = make([]*http.Request, 0)
+				other = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					otherRequests = append(otherRequests, req)
+					w.Write(content)
+				}))
+				u, err := url.Parse(other.URL)
+				Expect(err).ToNot(HaveOccurred())
+				// same server given by another host name
+				redirectTo = "http://localhost:" + u.Port() + "/app.zip"
+				server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					requests = append(requests, req)
+					http.Redirect(w, req, redirectTo, http.StatusFound)
+				})
+				handler = NewHttpHandler(false, HttpClientConfig{
+					Credentials: []HttpCredential{
+						{Host: "127.0.0.*", Token: "my-token", Headers: map[string]string{"X-JFrog-Art-Api": "key"}},
+					},
+				}, BitsCache{}, ArtifactVerifier{}, FileFilter{})
+			})
+			AfterEach(func() {
+				other.Close()
+			})
+			It("should not send credentials to a host which doesn't match", func() {
+				Expect(readZip(handler)).To(Equal(content))
+				Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer my-token"))
+				Expect(otherRequests).To(HaveLen(1))
+				Expect(otherRequests[0].Header.Get("Authorization")).To(BeEmpty())
+				Expect(otherRequests[0].Header.Get("X-JFrog-Art-Api")).To(BeEmpty())
+			})
+			It("should send credential of the host redirected to", func() {
+				handler.ClientConfig.Credentials = append(handler.ClientConfig.Credentials, HttpCredential{Host: "localhost:*", Username: "user", Password: "pass"})
+				Expect(readZip(handler)).To(Equal(content))
+				username, password, ok := otherRequests[0].BasicAuth()
+				Expect(ok).To(BeTrue())
+				Expect(username).To(Equal("user"))
+				Expect(password).To(Equal("pass"))
+				Expect(otherRequests[0].Header.Get("X-JFrog-Art-Api")).To(BeEmpty())
+			})
+			It("should keep credentials when redirected to a matching host", func() {
+				redirectTo = other.URL + "/app.zip"
+				Expect(readZip(handler)).To(Equal(content))
+				Expect(otherRequests[0].Header.Get("Authorization")).To(Equal("Bearer my-token"))
+				Expect(otherRequests[0].Header.Get("X-JFrog-Art-Api")).To(Equal("key"))
+			})
+		})
+		It("should retry after a server error", func() {
+			failures = 2
+			handler := NewHttpHandler(false, HttpClientConfig{Retries: 2}, BitsCache{}, ArtifactVerifier{}, FileFilter{})
+			Expect(readZip(handler)).To(Equal(content))
+			Expect(requests).To(HaveLen(3))
+		})
+		It("should fail when server errors exceed retries", func() {
+			failures = 2
+			handler := NewHttpHandler(false, HttpClientConfig{Retries: 1}, BitsCache{}, ArtifactVerifier{}, FileFilter{})
+			_, err := handler.GetZipFile(server.URL + "/app.zip")
+			Expect(err).To(HaveOccurred())
+		})
+		It("should resume an interrupted download", func() {
+			cutAt = 10
+			handler := NewHttpHandler(false, HttpClientConfig{Retries: 1}, BitsCache{}, ArtifactVerifier{}, FileFilter{})
+			Expect(readZip(handler)).To(Equal(content))
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[1].Header.Get("Range")).To(Equal("bytes=10-"))
+		})
+		It("should resume an interrupted download in cache", func() {
+			cacheDir, err := ioutil.TempDir("", "bits-cache")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(cacheDir)
+			cutAt = 10
+			handler := NewHttpHandler(false, HttpClientConfig{Retries: 1}, NewBitsCache(cacheDir), ArtifactVerifier{}, FileFilter{})
+			sha1, err := handler.GetSha1File(server.URL + "/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			h := sha256.Sum256(content)
+			Expect(sha1).To(Equal("sha256:" + hex.EncodeToString(h[:])))
+		})
+	})
+})
@@ -2,33 +2,43 @@ package bitsmanager
 
 import (
 	"code.cloudfoundry.org/cli/cf/appfiles"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
 )
 
+// LocalHandler zip a folder (or send a zip file as is), when cache is enabled digest of a zipped folder
+// is kept by tree fingerprint of the folder and it is not zipped again between runs of terraform while no file is touched
 type LocalHandler struct {
+	Filter FileFilter
+	Cache  BitsCache
 }
 
-func NewLocalHandler() *LocalHandler {
-	return &LocalHandler{}
+func NewLocalHandler(cache BitsCache, filter FileFilter) *LocalHandler {
+	return &LocalHandler{
+		Filter: filter,
+		Cache:  cache,
+	}
 }
 func (h LocalHandler) GetZipFile(path string) (FileHandler, error) {
 	zipFile, err := ioutil.TempFile("", "uploads-tf")
 	if err != nil {
 		return FileHandler{}, err
 	}
-	zipper := appfiles.ApplicationZipper{}
-	err = zipper.Zip(path, zipFile)
+	cleanFunc := func() error {
+		return os.Remove(zipFile.Name())
+	}
+	err = h.writeZip(path, zipFile)
+	zipFile.Close()
 	if err != nil {
+		cleanFunc()
 		return FileHandler{}, err
 	}
 	file, err := os.Open(zipFile.Name())
 	if err != nil {
 		return FileHandler{}, err
 	}
-	cleanFunc := func() error {
-		return os.Remove(zipFile.Name())
-	}
 	fs, _ := file.Stat()
 	return FileHandler{
 		ZipFile: file,
@@ -36,6 +46,14 @@ func (h LocalHandler) GetZipFile(path string) (FileHandler, error) {
 		Clean:   cleanFunc,
 	}, nil
 }
+
+// writeZip copy path as is when it is already a zip file (or a jar, war...) or write a reproducible zip of the folder
+func (h LocalHandler) writeZip(path string, w io.Writer) error {
+	if !(appfiles.ApplicationZipper{}).IsZipFile(path) {
+		return ZipDirectory(path, h.Filter, w)
+	}
+	return copyFile(w, path)
+}
 func (h LocalHandler) Detect(path string) bool {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return false
@@ -43,10 +61,44 @@ func (h LocalHandler) Detect(path string) bool {
 	return true
 }
 func (h LocalHandler) GetSha1File(path string) (string, error) {
+	fingerprint := ""
+	if fileInfo, err := os.Stat(path); err == nil && fileInfo.IsDir() && h.Cache.IsEnabled() {
+		fingerprint, err = GetTreeFingerprint(path, h.Filter)
+		if err != nil {
+			return "", err
+		}
+		if sha1, ok := h.Cache.localDigest(fingerprint); ok {
+			log.Printf("[DEBUG] digest of %s is taken from cache", path)
+			return sha1, nil
+		}
+	}
 	fileHandler, err := h.GetZipFile(path)
 	if err != nil {
 		return "", err
 	}
-	defer fileHandler.ZipFile.Close()
-	return GetSha1FromReader(fileHandler.ZipFile)
+	defer fileHandler.Clean()
+	sha1, err := GetSha256FromReader(fileHandler.ZipFile)
+	if err != nil || fingerprint == "" {
+		return sha1, err
+	}
+	err = h.Cache.setLocalDigest(fingerprint, sha1)
+	if err != nil {
+		log.Printf("[WARN] digest of %s cannot be kept in cache: %s", path, err.Error())
+	}
+	return sha1, nil
+}
+
+// GetLegacySha1File give fingerprint made by previous versions which zipped folders with cli zipper
+func (h LocalHandler) GetLegacySha1File(path string) (string, error) {
+	zipFile, err := ioutil.TempFile("", "uploads-tf")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(zipFile.Name())
+	err = appfiles.ApplicationZipper{}.Zip(path, zipFile)
+	if err != nil {
+		zipFile.Close()
+		return "", err
+	}
+	return GetLegacySha1FromReader(zipFile)
 }
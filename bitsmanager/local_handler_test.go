@@ -0,0 +1,85 @@
+package bitsmanager_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+
+	"bytes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("LocalHandler", func() {
+	var appPath string
+	handler := NewLocalHandler(BitsCache{}, FileFilter{})
+	BeforeEach(func() {
+		var err error
+		appPath, err = ioutil.TempDir("", "local-handler")
+		Expect(err).ToNot(HaveOccurred())
+		// content bigger than the 5KB used by legacy fingerprint
+		content := bytes.Repeat([]byte("a"), 2*LEGACY_CHUNK_FOR_SHA1)
+		err = ioutil.WriteFile(filepath.Join(appPath, "a-big-file"), content, 0644)
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(appPath, "z-last-file"), []byte("first version"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(appPath)
+	})
+	Describe("GetSha1File", func() {
+		It("should give a sha256 digest of the full zip", func() {
+			sha, err := handler.GetSha1File(appPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sha).To(MatchRegexp("^sha256:[0-9a-f]{64}$"))
+		})
+		It("should detect a change at the end of the zip", func() {
+			before, err := handler.GetSha1File(appPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = ioutil.WriteFile(filepath.Join(appPath, "z-last-file"), []byte("second version"), 0644)
+			Expect(err).ToNot(HaveOccurred())
+
+			after, err := handler.GetSha1File(appPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(after).ToNot(Equal(before))
+		})
+		Context("with cache", func() {
+			var cacheDir string
+			BeforeEach(func() {
+				var err error
+				cacheDir, err = ioutil.TempDir("", "bits-cache")
+				Expect(err).ToNot(HaveOccurred())
+			})
+			AfterEach(func() {
+				os.RemoveAll(cacheDir)
+			})
+			It("should keep digest of a folder for the next runs", func() {
+				sha, err := NewLocalHandler(NewBitsCache(cacheDir), FileFilter{}).GetSha1File(appPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sha).To(MatchRegexp("^sha256:[0-9a-f]{64}$"))
+
+				entries, err := filepath.Glob(filepath.Join(cacheDir, "local", "*"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(entries).To(HaveLen(1))
+				// a change in cache shows that folder is not zipped again by a new handler
+				Expect(ioutil.WriteFile(entries[0], []byte("sha256:from-cache"), 0644)).To(Succeed())
+				sha, err = NewLocalHandler(NewBitsCache(cacheDir), FileFilter{}).GetSha1File(appPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sha).To(Equal("sha256:from-cache"))
+			})
+			It("should zip again a folder which was touched", func() {
+				before, err := NewLocalHandler(NewBitsCache(cacheDir), FileFilter{}).GetSha1File(appPath)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = ioutil.WriteFile(filepath.Join(appPath, "z-last-file"), []byte("second version"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+
+				after, err := NewLocalHandler(NewBitsCache(cacheDir), FileFilter{}).GetSha1File(appPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(after).ToNot(Equal(before))
+			})
+		})
+	})
+})
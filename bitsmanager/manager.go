@@ -1,17 +1,22 @@
 package bitsmanager
 
 import (
+	"code.cloudfoundry.org/cli/cf/api/resources"
 	"fmt"
 	"io"
 )
 
 const (
-	CHUNK_FOR_SHA1 = 5 * 1024
-	APP_FILENAME   = "application.zip"
+	LEGACY_CHUNK_FOR_SHA1 = 5 * 1024
+	APP_FILENAME          = "application.zip"
+	CHECKSUM_TYPE_SHA256  = "sha256"
+	CHECKSUM_TYPE_SHA1    = "sha1"
 )
 
 type Handler interface {
 	GetZipFile(path string) (fileHandler FileHandler, err error)
+	// GetSha1File give fingerprint of the bits in form type:value (e.g.: sha256:<hex>, a git commit hash, etag:<etag>),
+	// it kept its name from previous versions which gave a sha1 of the first 5KB of the bits.
 	GetSha1File(path string) (sha1 string, err error)
 	Detect(path string) bool
 }
@@ -22,19 +27,28 @@ type FileHandler struct {
 }
 type BitsManager interface {
 	Upload(appGuid string, path string) error
+	UploadPackage(packageGuid string, path string) error
 	CopyBits(origAppGuid string, newAppGuid string) error
+	// GetSha1 give fingerprint of the bits with the overlay, this is not a sha1 anymore but a fingerprint in form type:value
+	// (see Handler.GetSha1File), names of the functions and of the path_sha1 and remote_sha1 attributes are kept for compatibility.
 	GetSha1(path string) (sha1 string, err error)
+	// GetLegacySha1 give the base64 sha1 of the first 5KB of the bits made by previous versions, it is only used to migrate states
+	GetLegacySha1(path string) (sha1 string, err error)
 	IsDiff(path string, currentSha1 string) (isDiff bool, sha1 string, err error)
 }
 
 type CloudControllerBitsManager struct {
-	appBitsRepo ApplicationBitsRepository
-	handlers    []Handler
+	appBitsRepo      ApplicationBitsRepository
+	handlers         []Handler
+	resourceMatching bool
+	overlay          Overlay
 }
 
-func NewCloudControllerBitsManager(appBitsRepo ApplicationBitsRepository, handlers []Handler) (manager CloudControllerBitsManager) {
+func NewCloudControllerBitsManager(appBitsRepo ApplicationBitsRepository, handlers []Handler, resourceMatching bool, overlay Overlay) (manager CloudControllerBitsManager) {
 	manager.appBitsRepo = appBitsRepo
 	manager.handlers = handlers
+	manager.resourceMatching = resourceMatching
+	manager.overlay = overlay
 	return
 }
 func (m CloudControllerBitsManager) GetSha1(path string) (string, error) {
@@ -42,7 +56,34 @@ func (m CloudControllerBitsManager) GetSha1(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return h.GetSha1File(path)
+	sha1, err := h.GetSha1File(path)
+	if err != nil {
+		return "", err
+	}
+	return m.overlay.Sha1(sha1)
+}
+
+// GetLegacySha1 give fingerprint of the path as it was computed by previous versions: from the zip made by cli zipper for a folder,
+// from the downloaded file for an url and from the commit hash for a git repo
+func (m CloudControllerBitsManager) GetLegacySha1(path string) (string, error) {
+	h, err := m.chooseHandler(path)
+	if err != nil {
+		return "", err
+	}
+	switch handler := h.(type) {
+	case *GitHandler:
+		return handler.GetSha1File(path)
+	case *LocalHandler:
+		return handler.GetLegacySha1File(path)
+	case *HttpHandler:
+		return handler.GetLegacySha1File(path)
+	}
+	fileHandler, err := h.GetZipFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer fileHandler.Clean()
+	return GetLegacySha1FromReader(fileHandler.ZipFile)
 }
 func (m CloudControllerBitsManager) CopyBits(origAppGuid string, newAppGuid string) error {
 	return m.appBitsRepo.CopyBits(origAppGuid, newAppGuid)
@@ -52,13 +93,36 @@ func (m CloudControllerBitsManager) Upload(appGuid string, path string) error {
 	if err != nil {
 		return err
 	}
-	fileHandler, err := h.GetZipFile(path)
+	fileHandler, err := m.getZipFile(h, path)
+	if err != nil {
+		return err
+	}
+	defer fileHandler.ZipFile.Close()
+	defer fileHandler.Clean()
+	if m.resourceMatching {
+		return m.uploadMatched("app "+appGuid, fileHandler, func(zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) error {
+			return m.appBitsRepo.UploadBits(appGuid, zipFile, fileSize, matchedResources)
+		})
+	}
+	return m.appBitsRepo.UploadBits(appGuid, fileHandler.ZipFile, fileHandler.Size, nil)
+}
+func (m CloudControllerBitsManager) UploadPackage(packageGuid string, path string) error {
+	h, err := m.chooseHandler(path)
+	if err != nil {
+		return err
+	}
+	fileHandler, err := m.getZipFile(h, path)
 	if err != nil {
 		return err
 	}
 	defer fileHandler.ZipFile.Close()
 	defer fileHandler.Clean()
-	return m.appBitsRepo.UploadBits(appGuid, fileHandler.ZipFile, fileHandler.Size)
+	if m.resourceMatching {
+		return m.uploadMatched("package "+packageGuid, fileHandler, func(zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) error {
+			return m.appBitsRepo.UploadPackageBits(packageGuid, zipFile, fileSize, matchedResources)
+		})
+	}
+	return m.appBitsRepo.UploadPackageBits(packageGuid, fileHandler.ZipFile, fileHandler.Size, nil)
 }
 func (m CloudControllerBitsManager) IsDiff(path string, currentSha1 string) (bool, string, error) {
 	h, err := m.chooseHandler(path)
@@ -69,8 +133,21 @@ func (m CloudControllerBitsManager) IsDiff(path string, currentSha1 string) (boo
 	if err != nil {
 		return true, "", err
 	}
+	sha1Given, err = m.overlay.Sha1(sha1Given)
+	if err != nil {
+		return true, "", err
+	}
 	return currentSha1 != sha1Given, sha1Given, nil
 }
+
+// getZipFile give zip made by the handler with files of the overlay added
+func (m CloudControllerBitsManager) getZipFile(h Handler, path string) (FileHandler, error) {
+	fileHandler, err := h.GetZipFile(path)
+	if err != nil {
+		return FileHandler{}, err
+	}
+	return m.overlay.Apply(fileHandler)
+}
 func (m CloudControllerBitsManager) chooseHandler(path string) (Handler, error) {
 	for _, h := range m.handlers {
 		if h.Detect(path) {
@@ -0,0 +1,288 @@
+package bitsmanager
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	MAVEN_SCHEME       = "maven://"
+	MAVEN_CENTRAL      = "https://repo.maven.apache.org/maven2"
+	MAVEN_DEFAULT_TYPE = "jar"
+	MAVEN_SNAPSHOT     = "SNAPSHOT"
+)
+
+var mavenChecksumRegexes = map[string]*regexp.Regexp{
+	CHECKSUM_TYPE_SHA256: regexp.MustCompile("^(?i)[0-9a-f]{64}$"),
+	CHECKSUM_TYPE_SHA1:   regexp.MustCompile("^(?i)[0-9a-f]{40}$"),
+}
+
+// MavenHandler deploy an artifact given as maven://<group>:<artifact>:<version>[:<classifier>][@<type>] (type is jar by default),
+// artifact is taken from the first repository which has it. A SNAPSHOT version is resolved to the last build from maven-metadata.xml.
+// Artifact is downloaded like an url (credentials of the host, retries, cache) and must match its .sha256 or .sha1 file.
+type MavenHandler struct {
+	Repositories []string
+	Http         HttpHandler
+	Verifier     ArtifactVerifier
+	Filter       FileFilter
+}
+
+type mavenCoordinates struct {
+	Group      string
+	Artifact   string
+	Version    string
+	Classifier string
+	Type       string
+}
+
+// mavenArtifact is an artifact found in a repository with checksum given by the repository (e.g.: sha1:<hex>)
+type mavenArtifact struct {
+	Url      string
+	Checksum string
+}
+
+type mavenMetadata struct {
+	Versioning struct {
+		Snapshot struct {
+			Timestamp   string `xml:"timestamp"`
+			BuildNumber string `xml:"buildNumber"`
+			LocalCopy   bool   `xml:"localCopy"`
+		} `xml:"snapshot"`
+		SnapshotVersions []struct {
+			Classifier string `xml:"classifier"`
+			Extension  string `xml:"extension"`
+			Value      string `xml:"value"`
+		} `xml:"snapshotVersions>snapshotVersion"`
+	} `xml:"versioning"`
+}
+
+func NewMavenHandler(skipInsecureSSL bool, repositories []string, clientConfig HttpClientConfig, cache BitsCache, verifier ArtifactVerifier, filter FileFilter) *MavenHandler {
+	if len(repositories) == 0 {
+		repositories = []string{MAVEN_CENTRAL}
+	}
+	return &MavenHandler{
+		Repositories: repositories,
+		Http:         HttpHandler{skipInsecureSSL, clientConfig, cache, ArtifactVerifier{}, filter},
+		Verifier:     verifier,
+		Filter:       filter,
+	}
+}
+func parseMavenCoordinates(path string) (mavenCoordinates, error) {
+	if !strings.HasPrefix(path, MAVEN_SCHEME) {
+		return mavenCoordinates{}, fmt.Errorf("'%s' is not a maven url.", path)
+	}
+	gav := strings.TrimPrefix(path, MAVEN_SCHEME)
+	coordinates := mavenCoordinates{Type: MAVEN_DEFAULT_TYPE}
+	if i := strings.LastIndex(gav, "@"); i >= 0 {
+		coordinates.Type = gav[i+1:]
+		gav = gav[:i]
+	}
+	parts := strings.Split(gav, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return mavenCoordinates{}, fmt.Errorf("Maven url '%s' must be in form maven://<group>:<artifact>:<version>[:<classifier>][@<type>].", path)
+	}
+	for _, part := range append(parts, coordinates.Type) {
+		if part == "" || strings.ContainsAny(part, "/\\") {
+			return mavenCoordinates{}, fmt.Errorf("Maven url '%s' must be in form maven://<group>:<artifact>:<version>[:<classifier>][@<type>].", path)
+		}
+	}
+	coordinates.Group = parts[0]
+	coordinates.Artifact = parts[1]
+	coordinates.Version = parts[2]
+	if len(parts) == 4 {
+		coordinates.Classifier = parts[3]
+	}
+	return coordinates, nil
+}
+
+// dirUrl give folder of the version in a repository (e.g.: <repo>/org/example/app/1.0.0)
+func (c mavenCoordinates) dirUrl(repository string) string {
+	return strings.Join([]string{
+		strings.TrimSuffix(repository, "/"),
+		strings.Replace(c.Group, ".", "/", -1),
+		c.Artifact,
+		c.Version,
+	}, "/")
+}
+
+// fileName give name of the file for a version, a resolved snapshot version replaces SNAPSHOT by <timestamp>-<build number>
+func (c mavenCoordinates) fileName(version string) string {
+	name := c.Artifact + "-" + version
+	if c.Classifier != "" {
+		name += "-" + c.Classifier
+	}
+	return name + "." + c.Type
+}
+func (c mavenCoordinates) isSnapshot() bool {
+	return strings.HasSuffix(c.Version, "-"+MAVEN_SNAPSHOT)
+}
+func (h MavenHandler) Detect(path string) bool {
+	coordinates, err := parseMavenCoordinates(path)
+	if err != nil {
+		return false
+	}
+	fileName := coordinates.fileName(coordinates.Version)
+	return IsZipFile(fileName) || IsTarFile(fileName) || IsTarGzFile(fileName)
+}
+
+// resolve find the artifact in the first repository which has it
+func (h MavenHandler) resolve(path string) (mavenArtifact, error) {
+	coordinates, err := parseMavenCoordinates(path)
+	if err != nil {
+		return mavenArtifact{}, err
+	}
+	// an error on a repository (e.g.: unauthorized) doesn't prevent to look for the artifact in next repositories
+	repositoryErrors := make([]string, 0)
+	for _, repository := range h.Repositories {
+		version, err := h.resolveVersion(repository, coordinates)
+		if err != nil {
+			log.Printf("[WARN] artifact '%s' cannot be resolved in repository %s: %s", path, repository, err.Error())
+			repositoryErrors = append(repositoryErrors, err.Error())
+			continue
+		}
+		artifactUrl := coordinates.dirUrl(repository) + "/" + coordinates.fileName(version)
+		checksum, found, err := h.remoteChecksum(artifactUrl)
+		if err != nil {
+			log.Printf("[WARN] artifact '%s' cannot be resolved in repository %s: %s", path, repository, err.Error())
+			repositoryErrors = append(repositoryErrors, err.Error())
+			continue
+		}
+		if found {
+			return mavenArtifact{Url: artifactUrl, Checksum: checksum}, nil
+		}
+	}
+	err = fmt.Errorf("Artifact '%s' cannot be found (or has no .sha256/.sha1 file) in repositories %s.", path, strings.Join(h.Repositories, ", "))
+	if len(repositoryErrors) > 0 {
+		err = fmt.Errorf("%s Errors occured on repositories:\n%s", err.Error(), strings.Join(repositoryErrors, "\n"))
+	}
+	return mavenArtifact{}, err
+}
+
+// resolveVersion give version used in file name, a SNAPSHOT version is resolved from maven-metadata.xml
+// of the repository when there is one
+func (h MavenHandler) resolveVersion(repository string, coordinates mavenCoordinates) (string, error) {
+	if !coordinates.isSnapshot() {
+		return coordinates.Version, nil
+	}
+	metadataUrl := coordinates.dirUrl(repository) + "/maven-metadata.xml"
+	content, found, err := h.getFile(metadataUrl)
+	if err != nil || !found {
+		return coordinates.Version, err
+	}
+	var metadata mavenMetadata
+	err = xml.Unmarshal(content, &metadata)
+	if err != nil {
+		return "", fmt.Errorf("Error occured when reading %s: %s", metadataUrl, err.Error())
+	}
+	for _, snapshotVersion := range metadata.Versioning.SnapshotVersions {
+		if snapshotVersion.Classifier == coordinates.Classifier && snapshotVersion.Extension == coordinates.Type {
+			return snapshotVersion.Value, nil
+		}
+	}
+	snapshot := metadata.Versioning.Snapshot
+	if snapshot.LocalCopy || snapshot.Timestamp == "" {
+		return coordinates.Version, nil
+	}
+	return strings.TrimSuffix(coordinates.Version, MAVEN_SNAPSHOT) + snapshot.Timestamp + "-" + snapshot.BuildNumber, nil
+}
+
+// remoteChecksum read the .sha256 file of an artifact or its .sha1 file when there is no .sha256
+func (h MavenHandler) remoteChecksum(artifactUrl string) (string, bool, error) {
+	for _, checksumType := range []string{CHECKSUM_TYPE_SHA256, CHECKSUM_TYPE_SHA1} {
+		content, found, err := h.getFile(artifactUrl + "." + checksumType)
+		if err != nil {
+			return "", false, err
+		}
+		if !found {
+			continue
+		}
+		// file can contain the checksum followed by name of the artifact
+		fields := strings.Fields(string(content))
+		if len(fields) == 0 || !mavenChecksumRegexes[checksumType].MatchString(fields[0]) {
+			return "", false, fmt.Errorf("Checksum file %s.%s is not valid.", artifactUrl, checksumType)
+		}
+		return fmt.Sprintf("%s:%s", checksumType, strings.ToLower(fields[0])), true, nil
+	}
+	return "", false, nil
+}
+
+// getFile give content of a small file of a repository, found is false when repository doesn't have it
+func (h MavenHandler) getFile(fileUrl string) ([]byte, bool, error) {
+	resp, err := h.Http.get(fileUrl, http.Header{})
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, false, nil
+	}
+	err = h.Http.checkRespHttpError(resp)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	return content, true, err
+}
+
+// verifyChecksum check a downloaded artifact against checksum given by the repository
+func (h MavenHandler) verifyChecksum(artifact mavenArtifact, downloaded localCopy) error {
+	digest := downloaded.Digest
+	if strings.HasPrefix(artifact.Checksum, CHECKSUM_TYPE_SHA1+":") {
+		file, err := os.Open(downloaded.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		hash := sha1.New()
+		_, err = io.Copy(hash, file)
+		if err != nil {
+			return err
+		}
+		digest = fmt.Sprintf("%s:%s", CHECKSUM_TYPE_SHA1, hex.EncodeToString(hash.Sum(nil)))
+	}
+	if digest != artifact.Checksum {
+		return fmt.Errorf("Checksum of '%s' is '%s' but repository gives '%s', file is refused.", artifact.Url, digest, artifact.Checksum)
+	}
+	return nil
+}
+func (h MavenHandler) GetZipFile(path string) (FileHandler, error) {
+	artifact, err := h.resolve(path)
+	if err != nil {
+		return FileHandler{}, err
+	}
+	downloaded, err := h.Http.fetch(artifact.Url, h.Verifier)
+	if err != nil {
+		return FileHandler{}, err
+	}
+	err = h.verifyChecksum(artifact, downloaded)
+	if err != nil {
+		downloaded.Clean()
+		return FileHandler{}, err
+	}
+	return localCopyToZip(artifact.Url, downloaded, h.Filter)
+}
+
+// GetSha1File give checksum given by the repository without downloading the artifact
+func (h MavenHandler) GetSha1File(path string) (string, error) {
+	artifact, err := h.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(artifact.Checksum, CHECKSUM_TYPE_SHA256+":") {
+		err = h.Verifier.VerifyChecksum(artifact.Url, artifact.Checksum)
+		if err != nil {
+			return "", err
+		}
+	}
+	return h.Http.filterSha1(artifact.Url, artifact.Checksum), nil
+}
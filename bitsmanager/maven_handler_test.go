@@ -0,0 +1,152 @@
+package bitsmanager_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("MavenHandler", func() {
+	var server *httptest.Server
+	var files map[string][]byte
+	var requested []string
+	// repository answering unauthorized to each request
+	var unauthorized string
+	var handler *MavenHandler
+	content := []byte("jar content")
+	sha1Of := func(content []byte) string {
+		h := sha1.Sum(content)
+		return hex.EncodeToString(h[:])
+	}
+	sha256Of := func(content []byte) string {
+		h := sha256.Sum256(content)
+		return hex.EncodeToString(h[:])
+	}
+	readZip := func(path string) []byte {
+		fileHandler, err := handler.GetZipFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer fileHandler.Clean()
+		defer fileHandler.ZipFile.Close()
+		zipContent, err := ioutil.ReadAll(fileHandler.ZipFile)
+		Expect(err).ToNot(HaveOccurred())
+		return zipContent
+	}
+	BeforeEach(func() {
+		requested = make([]string, 0)
+		unauthorized = ""
+		files = map[string][]byte{
+			"/releases/org/example/app/1.0.0/app-1.0.0.jar":      content,
+			"/releases/org/example/app/1.0.0/app-1.0.0.jar.sha1": []byte(sha1Of(content) + "  app-1.0.0.jar\n"),
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requested = append(requested, req.URL.Path)
+			if unauthorized != "" && strings.HasPrefix(req.URL.Path, unauthorized) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			file, ok := files[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(file)
+		}))
+		handler = NewMavenHandler(false, []string{server.URL + "/snapshots", server.URL + "/releases/"}, HttpClientConfig{}, BitsCache{}, ArtifactVerifier{}, FileFilter{})
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	Context("Detect", func() {
+		It("should detect maven coordinates of an archive", func() {
+			Expect(handler.Detect("maven://org.example:app:1.0.0")).To(BeTrue())
+			Expect(handler.Detect("maven://org.example:app:1.0.0:dist@tgz")).To(BeTrue())
+			Expect(handler.Detect("maven://org.example:app:1.0.0@war")).To(BeTrue())
+		})
+		It("should not detect invalid coordinates or other types", func() {
+			Expect(handler.Detect("maven://org.example:app")).To(BeFalse())
+			Expect(handler.Detect("maven://org.example:app:1.0.0@pom")).To(BeFalse())
+			Expect(handler.Detect("maven://org.example:app:1.0.0:a:b")).To(BeFalse())
+			Expect(handler.Detect("https://repo/app-1.0.0.jar")).To(BeFalse())
+		})
+	})
+	It("should give checksum of the repository without downloading the artifact", func() {
+		sha1, err := handler.GetSha1File("maven://org.example:app:1.0.0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sha1).To(Equal("sha1:" + sha1Of(content)))
+		Expect(requested).ToNot(ContainElement("/releases/org/example/app/1.0.0/app-1.0.0.jar"))
+	})
+	It("should download the artifact from the first repository which has it", func() {
+		Expect(readZip("maven://org.example:app:1.0.0")).To(Equal(content))
+		Expect(requested).To(ContainElement("/snapshots/org/example/app/1.0.0/app-1.0.0.jar.sha256"))
+	})
+	It("should prefer sha256 checksum and use classifier and type", func() {
+		files["/releases/org/example/app/1.0.0/app-1.0.0-dist.zip"] = content
+		files["/releases/org/example/app/1.0.0/app-1.0.0-dist.zip.sha256"] = []byte(sha256Of(content))
+		sha1, err := handler.GetSha1File("maven://org.example:app:1.0.0:dist@zip")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sha1).To(Equal("sha256:" + sha256Of(content)))
+		Expect(readZip("maven://org.example:app:1.0.0:dist@zip")).To(Equal(content))
+	})
+	It("should refuse an artifact which doesn't match its checksum file", func() {
+		files["/releases/org/example/app/1.0.0/app-1.0.0.jar"] = []byte("tampered content")
+		_, err := handler.GetZipFile("maven://org.example:app:1.0.0")
+		Expect(err).To(HaveOccurred())
+	})
+	It("should refuse an artifact which doesn't match pinned checksum", func() {
+		handler = NewMavenHandler(false, []string{server.URL + "/releases"}, HttpClientConfig{}, BitsCache{}, NewArtifactVerifier(sha256Of([]byte("other")), ""), FileFilter{})
+		_, err := handler.GetZipFile("maven://org.example:app:1.0.0")
+		Expect(err).To(HaveOccurred())
+	})
+	It("should fail when no repository has the artifact", func() {
+		_, err := handler.GetSha1File("maven://org.example:app:2.0.0")
+		Expect(err).To(HaveOccurred())
+	})
+	It("should look for the artifact in next repositories when a repository fails", func() {
+		unauthorized = "/snapshots/"
+		Expect(readZip("maven://org.example:app:1.0.0")).To(Equal(content))
+		Expect(requested).To(ContainElement("/snapshots/org/example/app/1.0.0/app-1.0.0.jar.sha256"))
+	})
+	It("should give errors of repositories when no repository has the artifact", func() {
+		unauthorized = "/snapshots/"
+		_, err := handler.GetSha1File("maven://org.example:app:2.0.0")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("cannot be found"))
+		Expect(err.Error()).To(ContainSubstring("401"))
+	})
+	It("should resolve a SNAPSHOT version to its last build", func() {
+		snapshot := []byte("snapshot jar content")
+		files["/snapshots/org/example/app/1.1.0-SNAPSHOT/maven-metadata.xml"] = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<metadata>
+  <groupId>org.example</groupId>
+  <artifactId>app</artifactId>
+  <version>1.1.0-SNAPSHOT</version>
+  <versioning>
+    <snapshot>
+      <timestamp>20260101.120000</timestamp>
+      <buildNumber>3</buildNumber>
+    </snapshot>
+    <snapshotVersions>
+      <snapshotVersion>
+        <extension>pom</extension>
+        <value>1.1.0-20260101.120000-3</value>
+      </snapshotVersion>
+      <snapshotVersion>
+        <extension>jar</extension>
+        <value>1.1.0-20260101.120000-3</value>
+      </snapshotVersion>
+    </snapshotVersions>
+  </versioning>
+</metadata>`)
+		files["/snapshots/org/example/app/1.1.0-SNAPSHOT/app-1.1.0-20260101.120000-3.jar"] = snapshot
+		files["/snapshots/org/example/app/1.1.0-SNAPSHOT/app-1.1.0-20260101.120000-3.jar.sha1"] = []byte(sha1Of(snapshot))
+		Expect(readZip("maven://org.example:app:1.1.0-SNAPSHOT")).To(Equal(snapshot))
+	})
+})
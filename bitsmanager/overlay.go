@@ -0,0 +1,156 @@
+package bitsmanager
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// OverlayFile is a file added (or replaced) in the zip of an app after it has been made by a handler,
+// its content is given directly or read from Source, a local file.
+type OverlayFile struct {
+	Destination string
+	Content     string
+	Source      string
+}
+
+// name give path of the file inside the zip in unix format without leading slash
+func (f OverlayFile) name() string {
+	return strings.TrimPrefix(path.Clean("/"+strings.Replace(f.Destination, "\\", "/", -1)), "/")
+}
+func (f OverlayFile) content() ([]byte, error) {
+	if f.Destination == "" {
+		return nil, fmt.Errorf("Destination of a file to add in app bits cannot be empty.")
+	}
+	if f.Source != "" && f.Content != "" {
+		return nil, fmt.Errorf("File '%s' to add in app bits can have a content or a source but not both.", f.Destination)
+	}
+	if f.Source == "" {
+		return []byte(f.Content), nil
+	}
+	return ioutil.ReadFile(f.Source)
+}
+
+type Overlay []OverlayFile
+
+// Sha1 make a fingerprint from the fingerprint of the bits and the files added,
+// fingerprint is given as is when there is no file to add
+func (o Overlay) Sha1(sourceSha1 string) (string, error) {
+	if len(o) == 0 {
+		return sourceSha1, nil
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", sourceSha1)
+	for _, file := range o {
+		content, err := file.content()
+		if err != nil {
+			return "", err
+		}
+		fileSha := sha256.Sum256(content)
+		fmt.Fprintf(h, "file:%s %s\n", file.name(), hex.EncodeToString(fileSha[:]))
+	}
+	return fmt.Sprintf("%s:%s", CHECKSUM_TYPE_SHA256, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// Apply write a new zip with files of the overlay added to the zip of the file handler,
+// entries of the zip with the same name are replaced. File handler is given as is when there is no file to add.
+func (o Overlay) Apply(fileHandler FileHandler) (FileHandler, error) {
+	if len(o) == 0 {
+		return fileHandler, nil
+	}
+	defer fileHandler.ZipFile.Close()
+	defer fileHandler.Clean()
+	zipReader, tmpFile, err := o.zipReader(fileHandler)
+	if tmpFile != nil {
+		defer tmpFile.Close()
+	}
+	if err != nil {
+		return FileHandler{}, err
+	}
+	zipFile, err := ioutil.TempFile("", "uploads-tf")
+	if err != nil {
+		return FileHandler{}, err
+	}
+	cleanFunc := func() error {
+		return os.Remove(zipFile.Name())
+	}
+	err = o.writeZip(zipReader, zipFile)
+	zipFile.Close()
+	if err != nil {
+		cleanFunc()
+		return FileHandler{}, err
+	}
+	file, err := os.Open(zipFile.Name())
+	if err != nil {
+		cleanFunc()
+		return FileHandler{}, err
+	}
+	fs, _ := file.Stat()
+	return FileHandler{
+		ZipFile: file,
+		Size:    fs.Size(),
+		Clean:   cleanFunc,
+	}, nil
+}
+
+// zipReader read zip of the file handler, a streamed zip (e.g.: zip url) is first written on disk,
+// this temporary file is returned and must be closed when zip has been read
+func (o Overlay) zipReader(fileHandler FileHandler) (*zip.Reader, *os.File, error) {
+	if file, ok := fileHandler.ZipFile.(*os.File); ok {
+		zipReader, err := zip.NewReader(file, fileHandler.Size)
+		return zipReader, nil, err
+	}
+	tmpFile, err := ioutil.TempFile("", "uploads-tf")
+	if err != nil {
+		return nil, nil, err
+	}
+	// file is kept opened until zip has been read
+	os.Remove(tmpFile.Name())
+	size, err := io.Copy(tmpFile, fileHandler.ZipFile)
+	if err != nil {
+		tmpFile.Close()
+		return nil, nil, err
+	}
+	zipReader, err := zip.NewReader(tmpFile, size)
+	return zipReader, tmpFile, err
+}
+func (o Overlay) writeZip(zipReader *zip.Reader, w io.Writer) error {
+	overlayNames := make(map[string]bool)
+	for _, file := range o {
+		overlayNames[file.name()] = true
+	}
+	zipWriter := zip.NewWriter(w)
+	err := copyZipEntries(zipReader, zipWriter, func(zipFile *zip.File) bool {
+		return overlayNames[zipFile.Name]
+	})
+	if err != nil {
+		return err
+	}
+	for _, file := range o {
+		content, err := file.content()
+		if err != nil {
+			return err
+		}
+		header := &zip.FileHeader{
+			Name:   file.name(),
+			Method: zip.Deflate,
+		}
+		header.SetModTime(zipEntriesModTime)
+		header.SetMode(0644)
+		part, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = part.Write(content)
+		if err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
@@ -0,0 +1,125 @@
+package bitsmanager_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+
+	"archive/zip"
+	"bytes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Overlay", func() {
+	var appPath string
+	var sourcePath string
+	zipContent := func(fileHandler FileHandler) map[string]string {
+		content, err := ioutil.ReadAll(fileHandler.ZipFile)
+		Expect(err).ToNot(HaveOccurred())
+		zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		Expect(err).ToNot(HaveOccurred())
+		files := make(map[string]string)
+		for _, f := range zipReader.File {
+			r, err := f.Open()
+			Expect(err).ToNot(HaveOccurred())
+			b, err := ioutil.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			r.Close()
+			files[f.Name] = string(b)
+		}
+		return files
+	}
+	BeforeEach(func() {
+		var err error
+		appPath, err = ioutil.TempDir("", "overlay")
+		Expect(err).ToNot(HaveOccurred())
+		err = os.Mkdir(filepath.Join(appPath, "config"), 0755)
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(appPath, "config", "application.yml"), []byte("env: dev"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(appPath, "index.html"), []byte("hello"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		sourceFile, err := ioutil.TempFile("", "overlay-source")
+		Expect(err).ToNot(HaveOccurred())
+		sourceFile.WriteString(`{"build": 1}`)
+		sourceFile.Close()
+		sourcePath = sourceFile.Name()
+	})
+	AfterEach(func() {
+		os.RemoveAll(appPath)
+		os.Remove(sourcePath)
+	})
+	Describe("Apply", func() {
+		It("should add and replace files in the zip", func() {
+			overlay := Overlay{
+				{Destination: "/config/application.yml", Content: "env: prod"},
+				{Destination: "build-info.json", Source: sourcePath},
+			}
+			fileHandler, err := NewLocalHandler(BitsCache{}, FileFilter{}).GetZipFile(appPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			fileHandler, err = overlay.Apply(fileHandler)
+			Expect(err).ToNot(HaveOccurred())
+			defer fileHandler.Clean()
+			defer fileHandler.ZipFile.Close()
+
+			Expect(zipContent(fileHandler)).To(Equal(map[string]string{
+				"config/":                "",
+				"config/application.yml": "env: prod",
+				"index.html":             "hello",
+				"build-info.json":        `{"build": 1}`,
+			}))
+		})
+		It("should add files in a streamed zip", func() {
+			buf := new(bytes.Buffer)
+			err := ZipDirectory(appPath, FileFilter{}, buf)
+			Expect(err).ToNot(HaveOccurred())
+			fileHandler := FileHandler{
+				ZipFile: ioutil.NopCloser(buf),
+				Size:    -1,
+				Clean:   func() error { return nil },
+			}
+			fileHandler, err = Overlay{{Destination: "VERSION", Content: "1.0.0"}}.Apply(fileHandler)
+			Expect(err).ToNot(HaveOccurred())
+			defer fileHandler.Clean()
+			defer fileHandler.ZipFile.Close()
+
+			files := zipContent(fileHandler)
+			Expect(files).To(HaveKeyWithValue("VERSION", "1.0.0"))
+			Expect(files).To(HaveKeyWithValue("index.html", "hello"))
+		})
+		It("should give zip as is when there is no file", func() {
+			fileHandler, err := NewLocalHandler(BitsCache{}, FileFilter{}).GetZipFile(appPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer fileHandler.Clean()
+			defer fileHandler.ZipFile.Close()
+
+			applied, err := Overlay{}.Apply(fileHandler)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(applied.ZipFile).To(BeIdenticalTo(fileHandler.ZipFile))
+		})
+	})
+	Describe("Sha1", func() {
+		It("should give source fingerprint when there is no file", func() {
+			Expect(Overlay{}.Sha1("sha256:abc")).To(Equal("sha256:abc"))
+		})
+		It("should change when content of a file changes", func() {
+			before, err := Overlay{{Destination: "a", Source: sourcePath}}.Sha1("sha256:abc")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(before).To(MatchRegexp("^sha256:[0-9a-f]{64}$"))
+
+			err = ioutil.WriteFile(sourcePath, []byte(`{"build": 2}`), 0644)
+			Expect(err).ToNot(HaveOccurred())
+			after, err := Overlay{{Destination: "a", Source: sourcePath}}.Sha1("sha256:abc")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(after).ToNot(Equal(before))
+		})
+		It("should fail when a file has both a content and a source", func() {
+			_, err := Overlay{{Destination: "a", Content: "b", Source: sourcePath}}.Sha1("sha256:abc")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
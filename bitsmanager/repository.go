@@ -4,19 +4,18 @@ import (
 	"bytes"
 	"code.cloudfoundry.org/cli/cf/api/resources"
 	"code.cloudfoundry.org/cli/cf/configuration/coreconfig"
+	"code.cloudfoundry.org/cli/cf/errors"
 	. "code.cloudfoundry.org/cli/cf/i18n"
 	"code.cloudfoundry.org/cli/cf/net"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/cloudfoundry/gofileutils/fileutils"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
-	"net/http"
 	"net/textproto"
+	"net/url"
 	"os"
-	"runtime"
 	"time"
 )
 
@@ -45,7 +44,9 @@ type Job struct {
 type ApplicationBitsRepository interface {
 	GetApplicationSha1(appGUID string) (string, error)
 	IsDiff(appGUID string, currentSha1 string) (bool, string, error)
-	UploadBits(appGUID string, zipFile io.ReadCloser, fileSize int64) (apiErr error)
+	MatchResources(appResources []resources.AppFileResource) ([]resources.AppFileResource, error)
+	UploadBits(appGUID string, zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) (apiErr error)
+	UploadPackageBits(packageGUID string, zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) error
 	CopyBits(origAppGuid string, newAppGuid string) error
 }
 
@@ -66,40 +67,56 @@ func (repo CloudControllerApplicationBitsRepository) IsDiff(appGUID string, curr
 	}
 	return currentSha1 != sha1Found, sha1Found, nil
 }
-func (repo CloudControllerApplicationBitsRepository) GetApplicationSha1(appGUID string) (string, error) {
-	// we are oblige to do the request by itself because cli is reading the full response body
-	// to dump the response into a possible logger.
-	// we need to read just few bytes to create the sha1
-	apiURL := fmt.Sprintf("/v2/apps/%s/download", appGUID)
-	request, err := http.NewRequest("GET", repo.config.APIEndpoint()+apiURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("%s: %s", T("Error building request"), err.Error())
-	}
-	request.Header.Set("Authorization", repo.config.AccessToken())
-	request.Header.Set("accept", "application/json")
-	request.Header.Set("Connection", "close")
-	request.Header.Set("content-type", "application/json")
-	request.Header.Set("User-Agent", "go-cli "+repo.config.CLIVersion()+" / "+runtime.GOOS)
+type v3Checksum struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
 
-	tr := &http.Transport{
-		Proxy:           http.ProxyFromEnvironment,
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: repo.config.IsSSLDisabled()},
-	}
-	client := &http.Client{
-		Transport: tr,
-		Timeout:   2 * time.Second,
+func (c v3Checksum) String() string {
+	if c.Value == "" {
+		return ""
 	}
+	return fmt.Sprintf("%s:%s", c.Type, c.Value)
+}
 
-	resp, err := client.Do(request)
+// GetApplicationSha1 give checksum computed by cloud controller of the latest package of the app,
+// checksum of the current droplet is given when there is no package anymore (e.g.: app created by copying a droplet)
+func (repo CloudControllerApplicationBitsRepository) GetApplicationSha1(appGUID string) (string, error) {
+	query := url.Values{}
+	query.Set("order_by", "-created_at")
+	query.Set("per_page", "1")
+	query.Set("states", "READY")
+	var pkgs struct {
+		Resources []struct {
+			Data struct {
+				Checksum v3Checksum `json:"checksum"`
+			} `json:"data"`
+		} `json:"resources"`
+	}
+	err := repo.gateway.GetResource(
+		fmt.Sprintf("%s/v3/apps/%s/packages?%s", repo.config.APIEndpoint(), appGUID, query.Encode()),
+		&pkgs,
+	)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-	sha1, err := GetSha1FromReader(resp.Body)
+	if len(pkgs.Resources) > 0 && pkgs.Resources[0].Data.Checksum.Value != "" {
+		return pkgs.Resources[0].Data.Checksum.String(), nil
+	}
+	var droplet struct {
+		Checksum v3Checksum `json:"checksum"`
+	}
+	err = repo.gateway.GetResource(
+		fmt.Sprintf("%s/v3/apps/%s/droplets/current", repo.config.APIEndpoint(), appGUID),
+		&droplet,
+	)
+	if _, ok := err.(*errors.HTTPNotFoundError); ok {
+		return "", nil
+	}
 	if err != nil {
 		return "", err
 	}
-	return sha1, nil
+	return droplet.Checksum.String(), nil
 }
 func (repo CloudControllerApplicationBitsRepository) CopyBits(origAppGuid string, newAppGuid string) error {
 	apiURL := fmt.Sprintf("%s/v2/apps/%s/copy_bits", repo.config.APIEndpoint(), newAppGuid)
@@ -226,8 +243,79 @@ func createZipPartWriter(fileSize int64, writer *multipart.Writer) (io.Writer, e
 //Old way to send bits
 /////
 
-func (repo CloudControllerApplicationBitsRepository) UploadBits(appGUID string, zipFile io.ReadCloser, fileSize int64) error {
+// UploadBits send bits to an app, matchedResources are files already known by cloud controller which are not in the zip.
+// zipFile can be nil when all files are matched.
+func (repo CloudControllerApplicationBitsRepository) UploadBits(appGUID string, zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) error {
 	apiURL := fmt.Sprintf("/v2/apps/%s/bits", appGUID)
+	if matchedResources == nil {
+		matchedResources = make([]resources.AppFileResource, 0)
+	}
+	resourcesJSON, err := json.Marshal(matchedResources)
+	if err != nil {
+		return err
+	}
+	request, err := repo.newStreamBitsRequest("PUT", apiURL, "application", resourcesJSON, zipFile, fileSize)
+	if err != nil {
+		return err
+	}
+	response := &resources.Resource{}
+	_, err = repo.gateway.PerformPollingRequestForJSONResponse(repo.config.APIEndpoint(), request, response, DefaultAppUploadBitsTimeout)
+	return err
+}
+
+// MatchResources give files which are already known by cloud controller (in its resource cache) and don't need to be uploaded
+func (repo CloudControllerApplicationBitsRepository) MatchResources(appResources []resources.AppFileResource) ([]resources.AppFileResource, error) {
+	body, err := json.Marshal(appResources)
+	if err != nil {
+		return nil, err
+	}
+	req, err := repo.gateway.NewRequest("PUT", repo.config.APIEndpoint()+"/v2/resource_match", repo.config.AccessToken(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]resources.AppFileResource, 0)
+	_, err = repo.gateway.PerformRequestForJSONResponse(req, &matched)
+	if err != nil {
+		return nil, err
+	}
+	return matched, nil
+}
+
+// packageResource is a file already known by cloud controller as given to v3 api
+type packageResource struct {
+	Checksum struct {
+		Value string `json:"value"`
+	} `json:"checksum"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+	Path        string `json:"path"`
+	Mode        string `json:"mode"`
+}
+
+// UploadPackageBits send bits to a v3 package, package will be in state PROCESSING_UPLOAD until cloud controller
+// finished to process it. matchedResources are files already known by cloud controller which are not in the zip,
+// zipFile can be nil when all files are matched.
+func (repo CloudControllerApplicationBitsRepository) UploadPackageBits(packageGUID string, zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) error {
+	apiURL := fmt.Sprintf("/v3/packages/%s/upload", packageGUID)
+	packageResources := make([]packageResource, len(matchedResources))
+	for i, matched := range matchedResources {
+		packageResources[i].Checksum.Value = matched.Sha1
+		packageResources[i].SizeInBytes = matched.Size
+		packageResources[i].Path = matched.Path
+		packageResources[i].Mode = matched.Mode
+	}
+	resourcesJSON, err := json.Marshal(packageResources)
+	if err != nil {
+		return err
+	}
+	request, err := repo.newStreamBitsRequest("POST", apiURL, "bits", resourcesJSON, zipFile, fileSize)
+	if err != nil {
+		return err
+	}
+	_, err = repo.gateway.PerformRequestForJSONResponse(request, &struct{}{})
+	return err
+}
+
+func (repo CloudControllerApplicationBitsRepository) newStreamBitsRequest(method, apiURL, partName string, resourcesJSON []byte, zipFile io.ReadCloser, fileSize int64) (*net.Request, error) {
 	r, w := io.Pipe()
 	mpw := multipart.NewWriter(w)
 	go func() {
@@ -238,18 +326,16 @@ func (repo CloudControllerApplicationBitsRepository) UploadBits(appGUID string,
 			mpw.Close()
 			panic(err)
 		}
-		_, err = io.Copy(part, bytes.NewBuffer([]byte("[]")))
+		_, err = io.Copy(part, bytes.NewBuffer(resourcesJSON))
 		if err != nil {
 			mpw.Close()
 			panic(err)
 		}
-		h := make(textproto.MIMEHeader)
-		h.Set("Content-Disposition", `form-data; name="application"; filename="application.zip"`)
-		h.Set("Content-Type", "application/zip")
-		h.Set("Content-Length", fmt.Sprintf("%d", fileSize))
-		h.Set("Content-Transfer-Encoding", "binary")
-
-		part, err = mpw.CreatePart(h)
+		if zipFile == nil {
+			mpw.Close()
+			return
+		}
+		part, err = mpw.CreatePart(bitsPartHeader(partName, fileSize))
 		if err != nil {
 			mpw.Close()
 			panic(err)
@@ -260,25 +346,27 @@ func (repo CloudControllerApplicationBitsRepository) UploadBits(appGUID string,
 		}
 		mpw.Close()
 	}()
-	var request *net.Request
-	request, err := repo.gateway.NewRequest("PUT", repo.config.APIEndpoint()+apiURL, repo.config.AccessToken(), nil)
+	request, err := repo.gateway.NewRequest(method, repo.config.APIEndpoint()+apiURL, repo.config.AccessToken(), nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	contentType := fmt.Sprintf("multipart/form-data; boundary=%s", mpw.Boundary())
 	request.HTTPReq.Header.Set("Content-Type", contentType)
-	request.HTTPReq.ContentLength = int64(repo.predictPart(int64(fileSize), mpw.Boundary()))
+	request.HTTPReq.ContentLength = int64(repo.predictPart(int64(fileSize), partName, resourcesJSON, zipFile != nil, mpw.Boundary()))
 	request.HTTPReq.Body = r
+	return request, nil
+}
 
-	response := &resources.Resource{}
-	_, err = repo.gateway.PerformPollingRequestForJSONResponse(repo.config.APIEndpoint(), request, response, DefaultAppUploadBitsTimeout)
-	if err != nil {
-		panic(err)
-	}
-	return nil
+func bitsPartHeader(partName string, fileSize int64) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="application.zip"`, partName))
+	h.Set("Content-Type", "application/zip")
+	h.Set("Content-Length", fmt.Sprintf("%d", fileSize))
+	h.Set("Content-Transfer-Encoding", "binary")
+	return h
 }
 
-func (repo CloudControllerApplicationBitsRepository) predictPart(filesize int64, boundary string) int64 {
+func (repo CloudControllerApplicationBitsRepository) predictPart(filesize int64, partName string, resourcesJSON []byte, hasZip bool, boundary string) int64 {
 	buf := new(bytes.Buffer)
 	mpw := multipart.NewWriter(buf)
 
@@ -288,18 +376,17 @@ func (repo CloudControllerApplicationBitsRepository) predictPart(filesize int64,
 		mpw.Close()
 		panic(err)
 	}
-	_, err = io.Copy(part, bytes.NewBuffer([]byte("[]")))
+	_, err = io.Copy(part, bytes.NewBuffer(resourcesJSON))
 	if err != nil {
 		mpw.Close()
 		panic(err)
 	}
-	h := make(textproto.MIMEHeader)
-	h.Set("Content-Disposition", `form-data; name="application"; filename="application.zip"`)
-	h.Set("Content-Type", "application/zip")
-	h.Set("Content-Length", fmt.Sprintf("%d", filesize))
-	h.Set("Content-Transfer-Encoding", "binary")
-
-	part, err = mpw.CreatePart(h)
+	if !hasZip {
+		mpw.Close()
+		b, _ := ioutil.ReadAll(buf)
+		return int64(len(b))
+	}
+	part, err = mpw.CreatePart(bitsPartHeader(partName, filesize))
 	if err != nil {
 		mpw.Close()
 		panic(err)
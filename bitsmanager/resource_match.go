@@ -0,0 +1,129 @@
+package bitsmanager
+
+import (
+	"archive/zip"
+	"code.cloudfoundry.org/cli/cf/api/resources"
+	"code.cloudfoundry.org/cli/cf/formatters"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// uploadBitsFunc send a zip with files already known by cloud controller, to an app (v2) or to a package (v3)
+type uploadBitsFunc func(zipFile io.ReadCloser, fileSize int64, matchedResources []resources.AppFileResource) error
+
+// uploadMatched ask cloud controller which files of the zip are already in its resource cache
+// and upload a zip containing only the other ones, target is the app or the package receiving bits.
+// Zip must be a file on disk to be read again, a streamed zip (e.g.: zip url) is uploaded as is.
+func (m CloudControllerBitsManager) uploadMatched(target string, fileHandler FileHandler, upload uploadBitsFunc) error {
+	file, ok := fileHandler.ZipFile.(*os.File)
+	if !ok {
+		log.Printf("[DEBUG] resource matching skipped for %s, bits are streamed", target)
+		return upload(fileHandler.ZipFile, fileHandler.Size, nil)
+	}
+	zipReader, err := zip.NewReader(file, fileHandler.Size)
+	if err != nil {
+		return err
+	}
+	appResources, err := zipResources(zipReader)
+	if err != nil {
+		return err
+	}
+	matched, err := m.appBitsRepo.MatchResources(appResources)
+	if err != nil {
+		log.Printf("[WARN] resource matching failed for %s, all bits are uploaded: %s", target, err.Error())
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		return upload(file, fileHandler.Size, nil)
+	}
+	matchedFiles := make(map[string]bool)
+	savedBytes := int64(0)
+	for _, resource := range matched {
+		matchedFiles[resource.Path+":"+resource.Sha1] = true
+		savedBytes += resource.Size
+	}
+	log.Printf(
+		"[DEBUG] resource matching for %s: %d/%d files already on cloud controller, %s not uploaded",
+		target,
+		len(matched),
+		len(appResources),
+		formatters.ByteSize(savedBytes),
+	)
+	if len(matched) == len(appResources) {
+		return upload(nil, 0, matched)
+	}
+	unmatchedZip, err := ioutil.TempFile("", "uploads-tf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(unmatchedZip.Name())
+	defer unmatchedZip.Close()
+	err = writeUnmatchedZip(zipReader, appResources, matchedFiles, unmatchedZip)
+	if err != nil {
+		return err
+	}
+	fs, err := unmatchedZip.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = unmatchedZip.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	return upload(unmatchedZip, fs.Size(), matched)
+}
+
+// zipResources give fingerprint of each file of the zip in the order of the zip entries (folders are given empty)
+func zipResources(zipReader *zip.Reader) ([]resources.AppFileResource, error) {
+	appResources := make([]resources.AppFileResource, len(zipReader.File))
+	for i, zipFile := range zipReader.File {
+		if zipFile.FileInfo().IsDir() {
+			continue
+		}
+		r, err := zipFile.Open()
+		if err != nil {
+			return nil, err
+		}
+		h := sha1.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		appResources[i] = resources.AppFileResource{
+			Path: zipFile.Name,
+			Sha1: hex.EncodeToString(h.Sum(nil)),
+			Size: int64(zipFile.UncompressedSize64),
+			Mode: fmt.Sprintf("%o", zipFile.Mode().Perm()),
+		}
+	}
+	nonEmpty := make([]resources.AppFileResource, 0)
+	for _, resource := range appResources {
+		if resource.Path != "" {
+			nonEmpty = append(nonEmpty, resource)
+		}
+	}
+	return nonEmpty, nil
+}
+
+// writeUnmatchedZip copy folders and files which are not matched in a new zip
+func writeUnmatchedZip(zipReader *zip.Reader, appResources []resources.AppFileResource, matchedFiles map[string]bool, w io.Writer) error {
+	sha1ByPath := make(map[string]string)
+	for _, resource := range appResources {
+		sha1ByPath[resource.Path] = resource.Sha1
+	}
+	zipWriter := zip.NewWriter(w)
+	err := copyZipEntries(zipReader, zipWriter, func(zipFile *zip.File) bool {
+		return matchedFiles[zipFile.Name+":"+sha1ByPath[zipFile.Name]]
+	})
+	if err != nil {
+		return err
+	}
+	return zipWriter.Close()
+}
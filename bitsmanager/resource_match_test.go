@@ -0,0 +1,136 @@
+package bitsmanager_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+
+	"archive/zip"
+	"bytes"
+	"code.cloudfoundry.org/cli/cf/api/resources"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager/bitsmanagerfakes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("CloudControllerBitsManager resource matching", func() {
+	var appPath string
+	var fakeRepo *bitsmanagerfakes.FakeApplicationBitsRepository
+	var uploadedFiles []string
+	var uploadedMatched []resources.AppFileResource
+	BeforeEach(func() {
+		var err error
+		appPath, err = ioutil.TempDir("", "resource-match")
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(appPath, "cached-file"), bytes.Repeat([]byte("a"), 1024), 0644)
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(appPath, "new-file"), []byte("new"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+
+		uploadedFiles = nil
+		uploadedMatched = nil
+		fakeRepo = new(bitsmanagerfakes.FakeApplicationBitsRepository)
+		fakeRepo.MatchResourcesStub = func(appResources []resources.AppFileResource) ([]resources.AppFileResource, error) {
+			matched := make([]resources.AppFileResource, 0)
+			for _, resource := range appResources {
+				if resource.Path == "cached-file" {
+					matched = append(matched, resource)
+				}
+			}
+			return matched, nil
+		}
+		// zip and matched files sent to an app (v2) or to a package (v3)
+		recordUpload := func(zipFile io.ReadCloser, fileSize int64, matched []resources.AppFileResource) error {
+			uploadedMatched = matched
+			if zipFile == nil {
+				return nil
+			}
+			content, err := ioutil.ReadAll(zipFile)
+			if err != nil {
+				return err
+			}
+			Expect(int64(len(content))).To(Equal(fileSize))
+			zipReader, err := zip.NewReader(bytes.NewReader(content), fileSize)
+			if err != nil {
+				return err
+			}
+			for _, f := range zipReader.File {
+				uploadedFiles = append(uploadedFiles, f.Name)
+			}
+			return nil
+		}
+		fakeRepo.UploadBitsStub = func(appGUID string, zipFile io.ReadCloser, fileSize int64, matched []resources.AppFileResource) error {
+			return recordUpload(zipFile, fileSize, matched)
+		}
+		fakeRepo.UploadPackageBitsStub = func(packageGUID string, zipFile io.ReadCloser, fileSize int64, matched []resources.AppFileResource) error {
+			return recordUpload(zipFile, fileSize, matched)
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(appPath)
+	})
+	manager := func(resourceMatching bool) CloudControllerBitsManager {
+		return NewCloudControllerBitsManager(fakeRepo, []Handler{NewLocalHandler(BitsCache{}, FileFilter{})}, resourceMatching, nil)
+	}
+	It("should only upload files not matched by cloud controller", func() {
+		err := manager(true).Upload("app-guid", appPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		appResources := fakeRepo.MatchResourcesArgsForCall(0)
+		Expect(appResources).To(HaveLen(2))
+		Expect(appResources[0].Path).To(Equal("cached-file"))
+		Expect(appResources[0].Sha1).To(Equal("8eca554631df9ead14510e1a70ae48c70f9b9384"))
+		Expect(appResources[0].Size).To(Equal(int64(1024)))
+		Expect(appResources[0].Mode).To(Equal("644"))
+
+		Expect(uploadedFiles).To(Equal([]string{"new-file"}))
+		Expect(uploadedMatched).To(HaveLen(1))
+		Expect(uploadedMatched[0].Path).To(Equal("cached-file"))
+	})
+	It("should not upload a zip when all files are matched", func() {
+		fakeRepo.MatchResourcesStub = func(appResources []resources.AppFileResource) ([]resources.AppFileResource, error) {
+			return appResources, nil
+		}
+		err := manager(true).Upload("app-guid", appPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRepo.UploadBitsCallCount()).To(Equal(1))
+		Expect(uploadedFiles).To(BeEmpty())
+		Expect(uploadedMatched).To(HaveLen(2))
+	})
+	It("should upload all files when matching fails", func() {
+		fakeRepo.MatchResourcesStub = nil
+		fakeRepo.MatchResourcesReturns(nil, errors.New("resource match unavailable"))
+		err := manager(true).Upload("app-guid", appPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(uploadedFiles).To(Equal([]string{"cached-file", "new-file"}))
+		Expect(uploadedMatched).To(BeEmpty())
+	})
+	It("should upload all files without asking cloud controller when matching is disabled", func() {
+		err := manager(false).Upload("app-guid", appPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRepo.MatchResourcesCallCount()).To(Equal(0))
+		Expect(uploadedFiles).To(Equal([]string{"cached-file", "new-file"}))
+	})
+	It("should only upload files not matched by cloud controller to a package", func() {
+		err := manager(true).UploadPackage("package-guid", appPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(fakeRepo.MatchResourcesCallCount()).To(Equal(1))
+		Expect(fakeRepo.UploadBitsCallCount()).To(Equal(0))
+		packageGuid, _, _, _ := fakeRepo.UploadPackageBitsArgsForCall(0)
+		Expect(packageGuid).To(Equal("package-guid"))
+		Expect(uploadedFiles).To(Equal([]string{"new-file"}))
+		Expect(uploadedMatched).To(HaveLen(1))
+		Expect(uploadedMatched[0].Path).To(Equal("cached-file"))
+	})
+	It("should upload all files to a package without asking cloud controller when matching is disabled", func() {
+		err := manager(false).UploadPackage("package-guid", appPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fakeRepo.MatchResourcesCallCount()).To(Equal(0))
+		Expect(uploadedFiles).To(Equal([]string{"cached-file", "new-file"}))
+		Expect(uploadedMatched).To(BeEmpty())
+	})
+})
@@ -0,0 +1,346 @@
+package bitsmanager
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const S3_DEFAULT_REGION = "us-east-1"
+
+// S3Config is used to download objects from S3 or an S3-compatible storage (e.g.: MinIO).
+// When there is no access key, credentials are found like aws cli does (env vars, shared credentials file, instance role).
+// Endpoint replaces the one of AWS, PathStyle sends requests to <endpoint>/<bucket>/<key> instead of <bucket>.<endpoint>/<key>.
+type S3Config struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Endpoint        string
+	PathStyle       bool
+	Retries         int
+}
+
+type S3Handler struct {
+	SkipInsecureSSL bool
+	Config          S3Config
+	Cache           BitsCache
+	Verifier        ArtifactVerifier
+	Filter          FileFilter
+}
+
+// s3Object is an object given as s3://<bucket>/<key>, a version can be given with s3://<bucket>/<key>?versionId=<version>
+type s3Object struct {
+	Bucket    string
+	Key       string
+	VersionId string
+}
+
+func NewS3Handler(skipInsecureSSL bool, s3Config S3Config, cache BitsCache, verifier ArtifactVerifier, filter FileFilter) *S3Handler {
+	return &S3Handler{skipInsecureSSL, s3Config, cache, verifier, filter}
+}
+func parseS3Object(path string) (s3Object, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return s3Object{}, err
+	}
+	if u.Scheme != "s3" {
+		return s3Object{}, fmt.Errorf("'%s' is not an s3 url.", path)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return s3Object{}, fmt.Errorf("S3 url '%s' must be in form s3://<bucket>/<key>.", path)
+	}
+	return s3Object{
+		Bucket:    u.Host,
+		Key:       key,
+		VersionId: u.Query().Get("versionId"),
+	}, nil
+}
+func (o s3Object) String() string {
+	u := url.URL{Scheme: "s3", Host: o.Bucket, Path: "/" + o.Key}
+	if o.VersionId != "" {
+		u.RawQuery = url.Values{"versionId": []string{o.VersionId}}.Encode()
+	}
+	return u.String()
+}
+func (o s3Object) versionId() *string {
+	if o.VersionId == "" {
+		return nil
+	}
+	return aws.String(o.VersionId)
+}
+func (h S3Handler) makeClient() (*s3.S3, error) {
+	region := h.Config.Region
+	if region == "" {
+		region = S3_DEFAULT_REGION
+	}
+	config := aws.NewConfig().
+		WithRegion(region).
+		WithS3ForcePathStyle(h.Config.PathStyle).
+		WithMaxRetries(h.Config.Retries).
+		WithHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: h.SkipInsecureSSL},
+			},
+		})
+	if h.Config.Endpoint != "" {
+		config = config.WithEndpoint(h.Config.Endpoint)
+	}
+	if h.Config.AccessKeyID != "" {
+		config = config.WithCredentials(credentials.NewStaticCredentials(
+			h.Config.AccessKeyID,
+			h.Config.SecretAccessKey,
+			h.Config.SessionToken,
+		))
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
+func (h S3Handler) GetZipFile(path string) (FileHandler, error) {
+	path, verifier, err := h.Verifier.WithChecksumFragment(path)
+	if err != nil {
+		return FileHandler{}, err
+	}
+	object, err := parseS3Object(path)
+	if err != nil {
+		return FileHandler{}, err
+	}
+	client, err := h.makeClient()
+	if err != nil {
+		return FileHandler{}, err
+	}
+	downloaded, err := h.fetch(client, object, verifier)
+	if err != nil {
+		return FileHandler{}, err
+	}
+	return localCopyToZip(object.Key, downloaded, h.Filter)
+}
+
+// GetSha1File give version id of the object (or its ETag when bucket is not versioned) without downloading it
+func (h S3Handler) GetSha1File(path string) (string, error) {
+	path, _, err := h.Verifier.WithChecksumFragment(path)
+	if err != nil {
+		return "", err
+	}
+	object, err := parseS3Object(path)
+	if err != nil {
+		return "", err
+	}
+	client, err := h.makeClient()
+	if err != nil {
+		return "", err
+	}
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket:    aws.String(object.Bucket),
+		Key:       aws.String(object.Key),
+		VersionId: object.versionId(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error occured when getting s3 object %s: %s", object, err.Error())
+	}
+	var sha1 string
+	versionId := aws.StringValue(head.VersionId)
+	if versionId != "" && versionId != "null" {
+		// "null" is the version of objects created before versioning was enabled
+		sha1 = "s3-version:" + versionId
+	} else {
+		sha1 = "etag:" + strings.Trim(aws.StringValue(head.ETag), `"`)
+	}
+	if IsTarFile(object.Key) || IsTarGzFile(object.Key) {
+		return h.Filter.Sha1(sha1), nil
+	}
+	return sha1, nil
+}
+func (h S3Handler) Detect(path string) bool {
+	path, _, err := ArtifactVerifier{}.WithChecksumFragment(path)
+	if err != nil {
+		return false
+	}
+	object, err := parseS3Object(path)
+	if err != nil {
+		return false
+	}
+	return IsZipFile(object.Key) || IsTarFile(object.Key) || IsTarGzFile(object.Key)
+}
+
+// fetch give a verified local copy of the object, it is taken from cache when enabled
+func (h S3Handler) fetch(client *s3.S3, object s3Object, verifier ArtifactVerifier) (localCopy, error) {
+	var downloaded localCopy
+	if h.Cache.IsEnabled() {
+		digest, err := h.download(client, object)
+		if err != nil {
+			return localCopy{}, err
+		}
+		downloaded = localCopy{
+			Path:   h.Cache.blobPath(digest),
+			Digest: digest,
+			Clean: func() error {
+				// file stays in cache
+				return nil
+			},
+		}
+	} else {
+		tmpFile, err := ioutil.TempFile("", "downloads-tf")
+		if err != nil {
+			return localCopy{}, err
+		}
+		cleanFunc := func() error {
+			return os.Remove(tmpFile.Name())
+		}
+		_, _, err = h.downloadToFile(client, object, tmpFile, "")
+		tmpFile.Close()
+		if err != nil {
+			cleanFunc()
+			return localCopy{}, err
+		}
+		digest, err := fileDigest(tmpFile.Name())
+		if err != nil {
+			cleanFunc()
+			return localCopy{}, err
+		}
+		downloaded = localCopy{
+			Path:   tmpFile.Name(),
+			Digest: digest,
+			Clean:  cleanFunc,
+		}
+	}
+	err := h.verify(client, object, downloaded, verifier)
+	if err != nil {
+		downloaded.Clean()
+		return localCopy{}, err
+	}
+	return downloaded, nil
+}
+
+// download put the object in cache and give its digest, object is only downloaded when its ETag changed
+func (h S3Handler) download(client *s3.S3, object s3Object) (string, error) {
+	entry, inCache := h.Cache.httpEntry(object.String())
+	ifNoneMatch := ""
+	if inCache {
+		ifNoneMatch = entry.ETag
+	}
+	blobFile, err := h.Cache.newBlobFile()
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(blobFile.Name())
+	etag, notModified, err := h.downloadToFile(client, object, blobFile, ifNoneMatch)
+	blobFile.Close()
+	if err != nil {
+		return "", err
+	}
+	if notModified {
+		log.Printf("[DEBUG] %s didn't change, cached file is used", object)
+		return entry.Digest, nil
+	}
+	digest, err := h.Cache.storeBlobFile(blobFile.Name())
+	if err != nil {
+		return "", err
+	}
+	err = h.Cache.setHttpEntry(httpCacheEntry{
+		Url:    object.String(),
+		ETag:   etag,
+		Digest: digest,
+	})
+	if err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// downloadToFile write the object in file and give its ETag, nothing is written when object still has ETag ifNoneMatch.
+// An interrupted download is resumed from where it stopped with a Range request on the same ETag.
+func (h S3Handler) downloadToFile(client *s3.S3, object s3Object, file *os.File, ifNoneMatch string) (string, bool, error) {
+	var written int64
+	var etag string
+	var lastErr error
+	for attempt := 0; attempt <= h.Config.Retries; attempt++ {
+		input := &s3.GetObjectInput{
+			Bucket:    aws.String(object.Bucket),
+			Key:       aws.String(object.Key),
+			VersionId: object.versionId(),
+		}
+		if ifNoneMatch != "" {
+			input.IfNoneMatch = aws.String(ifNoneMatch)
+		}
+		if written > 0 {
+			log.Printf("[INFO] download of %s resumed at %d bytes", object, written)
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", written))
+			input.IfMatch = aws.String(etag)
+		}
+		resp, err := client.GetObject(input)
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotModified {
+			return "", true, nil
+		}
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusPreconditionFailed {
+			// object changed during download, it starts again from the beginning
+			written = 0
+			err = truncateFile(file)
+			if err != nil {
+				return "", false, err
+			}
+			lastErr = reqErr
+			continue
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("Error occured when dowloading s3 object %s: %s", object, err.Error())
+		}
+		if written == 0 {
+			etag = aws.StringValue(resp.ETag)
+		}
+		n, err := io.Copy(file, resp.Body)
+		resp.Body.Close()
+		written += n
+		if err == nil {
+			return etag, false, nil
+		}
+		lastErr = fmt.Errorf("download interrupted after %d bytes: %s", written, err.Error())
+		log.Printf("[WARN] %s", lastErr.Error())
+	}
+	return "", false, fmt.Errorf("Error occured when dowloading s3 object %s after %d attempts: %s", object, h.Config.Retries+1, lastErr.Error())
+}
+
+// verify check pinned digest and signature (object <key>.asc) of a downloaded object
+func (h S3Handler) verify(client *s3.S3, object s3Object, downloaded localCopy, verifier ArtifactVerifier) error {
+	err := verifier.VerifyChecksum(object.String(), downloaded.Digest)
+	if err != nil {
+		return err
+	}
+	if verifier.PublicKey == "" {
+		return nil
+	}
+	resp, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(object.Bucket),
+		Key:    aws.String(object.Key + SIGNATURE_EXT),
+	})
+	if err != nil {
+		return fmt.Errorf("Signature of '%s' cannot be downloaded: %s", object, err.Error())
+	}
+	defer resp.Body.Close()
+	signature, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(downloaded.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return verifier.VerifySignature(object.String(), file, signature)
+}
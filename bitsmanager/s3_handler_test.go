@@ -0,0 +1,179 @@
+package bitsmanager_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+)
+
+var _ = Describe("S3Handler", func() {
+	var server *httptest.Server
+	var objects map[string][]byte
+	var versionId string
+	var requests []*http.Request
+	var cutAt int
+	var handler *S3Handler
+	s3Config := func() S3Config {
+		return S3Config{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "secret",
+			SessionToken:    "session-token",
+			Endpoint:        server.URL,
+			PathStyle:       true,
+			Retries:         1,
+		}
+	}
+	etagOf := func(content []byte) string {
+		h := sha256.Sum256(content)
+		return `"` + hex.EncodeToString(h[:8]) + `"`
+	}
+	readZip := func(path string) []byte {
+		fileHandler, err := handler.GetZipFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer fileHandler.Clean()
+		defer fileHandler.ZipFile.Close()
+		zipContent, err := ioutil.ReadAll(fileHandler.ZipFile)
+		Expect(err).ToNot(HaveOccurred())
+		return zipContent
+	}
+	gets := func() int {
+		count := 0
+		for _, req := range requests {
+			if req.Method == "GET" {
+				count++
+			}
+		}
+		return count
+	}
+	BeforeEach(func() {
+		objects = map[string][]byte{"/bucket/app.zip": []byte("zip content stored in a bucket")}
+		versionId = ""
+		requests = make([]*http.Request, 0)
+		cutAt = 0
+		// stand-in of s3 with path-style addressing, signatures are not checked
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests = append(requests, req)
+			content, ok := objects[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+				return
+			}
+			etag := etagOf(content)
+			w.Header().Set("ETag", etag)
+			if versionId != "" {
+				w.Header().Set("x-amz-version-id", versionId)
+			}
+			if req.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			if req.Header.Get("If-Match") != "" && req.Header.Get("If-Match") != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			start := 0
+			if req.Header.Get("Range") != "" {
+				_, err := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-", &start)
+				Expect(err).ToNot(HaveOccurred())
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)-start))
+				w.WriteHeader(http.StatusPartialContent)
+			} else {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			}
+			if req.Method == "HEAD" {
+				return
+			}
+			if cutAt > 0 {
+				// connection is closed in the middle of the body
+				w.Write(content[start:cutAt])
+				w.(http.Flusher).Flush()
+				cutAt = 0
+				panic(http.ErrAbortHandler)
+			}
+			w.Write(content[start:])
+		}))
+		handler = NewS3Handler(false, s3Config(), BitsCache{}, ArtifactVerifier{}, FileFilter{})
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	Context("Detect", func() {
+		It("should detect archives in a bucket", func() {
+			Expect(handler.Detect("s3://bucket/app.zip")).To(BeTrue())
+			Expect(handler.Detect("s3://bucket/dir/app.tgz?versionId=v1")).To(BeTrue())
+			Expect(handler.Detect("s3://bucket/app.zip#sha256=" + hex.EncodeToString(make([]byte, 32)))).To(BeTrue())
+		})
+		It("should not detect other paths", func() {
+			Expect(handler.Detect("s3://bucket/")).To(BeFalse())
+			Expect(handler.Detect("s3://bucket/app.txt")).To(BeFalse())
+			Expect(handler.Detect("https://bucket/app.zip")).To(BeFalse())
+		})
+	})
+	Context("GetSha1File", func() {
+		It("should give ETag of the object without downloading it", func() {
+			sha1, err := handler.GetSha1File("s3://bucket/app.zip")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sha1).To(Equal("etag:" + etagOf(objects["/bucket/app.zip"])[1:17]))
+			Expect(gets()).To(Equal(0))
+			Expect(requests[0].Method).To(Equal("HEAD"))
+			Expect(requests[0].URL.Path).To(Equal("/bucket/app.zip"))
+		})
+		It("should give version id of the object in a versioned bucket", func() {
+			versionId = "3HL4kqtJlcpXroDTDmJ"
+			sha1, err := handler.GetSha1File("s3://bucket/app.zip?versionId=" + versionId)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sha1).To(Equal("s3-version:" + versionId))
+			Expect(requests[0].URL.Query().Get("versionId")).To(Equal(versionId))
+		})
+		It("should fail when object doesn't exist", func() {
+			_, err := handler.GetSha1File("s3://bucket/missing.zip")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Context("GetZipFile", func() {
+		It("should download the object with the credentials", func() {
+			Expect(readZip("s3://bucket/app.zip")).To(Equal(objects["/bucket/app.zip"]))
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].URL.Path).To(Equal("/bucket/app.zip"))
+			Expect(requests[0].Header.Get("Authorization")).To(ContainSubstring("Credential=AKIDEXAMPLE/"))
+			Expect(requests[0].Header.Get("X-Amz-Security-Token")).To(Equal("session-token"))
+		})
+		It("should resume an interrupted download", func() {
+			cutAt = 10
+			Expect(readZip("s3://bucket/app.zip")).To(Equal(objects["/bucket/app.zip"]))
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[1].Header.Get("Range")).To(Equal("bytes=10-"))
+			Expect(requests[1].Header.Get("If-Match")).To(Equal(etagOf(objects["/bucket/app.zip"])))
+		})
+		It("should refuse an object which doesn't have the pinned checksum", func() {
+			h := sha256.Sum256([]byte("other content"))
+			_, err := handler.GetZipFile("s3://bucket/app.zip#sha256=" + hex.EncodeToString(h[:]))
+			Expect(err).To(HaveOccurred())
+		})
+		It("should not download again a cached object which didn't change", func() {
+			cacheDir, err := ioutil.TempDir("", "bits-cache")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(cacheDir)
+			handler = NewS3Handler(false, s3Config(), NewBitsCache(cacheDir), ArtifactVerifier{}, FileFilter{})
+
+			Expect(readZip("s3://bucket/app.zip")).To(Equal(objects["/bucket/app.zip"]))
+			Expect(readZip("s3://bucket/app.zip")).To(Equal(objects["/bucket/app.zip"]))
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[1].Header.Get("If-None-Match")).To(Equal(etagOf(objects["/bucket/app.zip"])))
+
+			objects["/bucket/app.zip"] = []byte("new zip content")
+			Expect(readZip("s3://bucket/app.zip")).To(Equal([]byte("new zip content")))
+		})
+	})
+})
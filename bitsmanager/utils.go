@@ -3,7 +3,10 @@ package bitsmanager
 import (
 	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"github.com/viant/toolbox"
 	"io"
 	"path/filepath"
@@ -26,9 +29,22 @@ var TARGZ_FILE_EXT []string = []string{
 	".tgz",
 }
 
-func GetSha1FromReader(reader io.ReadCloser) (string, error) {
+// GetSha256FromReader give digest of the full content, in the form of type:value (e.g.: sha256:a-sha256)
+func GetSha256FromReader(reader io.ReadCloser) (string, error) {
+	defer reader.Close()
+	h := sha256.New()
+	_, err := io.Copy(h, reader)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s", CHECKSUM_TYPE_SHA256, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// GetLegacySha1FromReader give fingerprint made by previous versions from the first bytes of the content only,
+// it is only used to migrate states
+func GetLegacySha1FromReader(reader io.ReadCloser) (string, error) {
 	buf := new(bytes.Buffer)
-	_, err := io.CopyN(buf, reader, CHUNK_FOR_SHA1)
+	_, err := io.CopyN(buf, reader, LEGACY_CHUNK_FOR_SHA1)
 	if err != nil && err != io.EOF {
 		return "", err
 	}
@@ -0,0 +1,131 @@
+package bitsmanager
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/crypto/openpgp"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const SIGNATURE_EXT = ".asc"
+
+var sha256ChecksumRegex = regexp.MustCompile("^(?i)(sha256[:=])?([0-9a-f]{64})$")
+
+// ArtifactVerifier refuse bits which are not the ones expected:
+// digest of a downloaded file must be Checksum (sha256:<hex>, sha256=<hex> or <hex>) and, for a git repo,
+// commit must be Checksum (full commit hash).
+// When PublicKey (armored keyring) is set, a downloaded file must have a detached signature (<url>.asc)
+// made by one of its keys and commit checked out from a git repo must be signed by one of them.
+type ArtifactVerifier struct {
+	Checksum  string
+	PublicKey string
+}
+
+func NewArtifactVerifier(checksum, publicKey string) ArtifactVerifier {
+	return ArtifactVerifier{
+		Checksum:  strings.TrimSpace(checksum),
+		PublicKey: publicKey,
+	}
+}
+
+// IsEnabled tells if a downloaded file must be verified
+func (v ArtifactVerifier) IsEnabled() bool {
+	return v.Checksum != "" || v.PublicKey != ""
+}
+
+// WithChecksumFragment remove a pinned digest given in fragment of an url (e.g.: https://host/app.zip#sha256=<hex>)
+// and give a verifier checking it
+func (v ArtifactVerifier) WithChecksumFragment(path string) (string, ArtifactVerifier, error) {
+	u, err := url.Parse(path)
+	if err != nil || !strings.HasPrefix(strings.ToLower(u.Fragment), CHECKSUM_TYPE_SHA256+"=") {
+		return path, v, nil
+	}
+	checksum := u.Fragment
+	u.Fragment = ""
+	if v.Checksum == "" {
+		v.Checksum = checksum
+		return u.String(), v, nil
+	}
+	expected, err := v.sha256Checksum()
+	if err != nil {
+		return "", v, err
+	}
+	fromFragment, err := ArtifactVerifier{Checksum: checksum}.sha256Checksum()
+	if err != nil {
+		return "", v, err
+	}
+	if expected != fromFragment {
+		return "", v, fmt.Errorf("Checksum given in path '%s' is different from path_checksum '%s'.", path, v.Checksum)
+	}
+	return u.String(), v, nil
+}
+
+// sha256Checksum give checksum in form sha256:<hex>
+func (v ArtifactVerifier) sha256Checksum() (string, error) {
+	matches := sha256ChecksumRegex.FindStringSubmatch(v.Checksum)
+	if matches == nil {
+		return "", fmt.Errorf("Checksum '%s' is not a sha256 digest, expected form is sha256:<hex>.", v.Checksum)
+	}
+	return fmt.Sprintf("%s:%s", CHECKSUM_TYPE_SHA256, strings.ToLower(matches[2])), nil
+}
+
+// VerifyChecksum check digest (sha256:<hex>) of a downloaded file
+func (v ArtifactVerifier) VerifyChecksum(path, digest string) error {
+	if v.Checksum == "" {
+		return nil
+	}
+	expected, err := v.sha256Checksum()
+	if err != nil {
+		return err
+	}
+	if expected != digest {
+		return fmt.Errorf("Checksum of '%s' is '%s' but '%s' was expected, file is refused.", path, digest, expected)
+	}
+	return nil
+}
+
+// VerifyCommit check commit of a git repo
+func (v ArtifactVerifier) VerifyCommit(gitUrl, commit string) error {
+	if v.Checksum == "" {
+		return nil
+	}
+	if !commitHashRegex.MatchString(v.Checksum) {
+		return fmt.Errorf("Checksum '%s' of git repository '%s' must be a full commit hash.", v.Checksum, gitUrl)
+	}
+	if !strings.EqualFold(v.Checksum, commit) {
+		return fmt.Errorf("Commit of git repository '%s' is '%s' but '%s' was expected, repository is refused.", gitUrl, commit, v.Checksum)
+	}
+	return nil
+}
+
+// VerifyCommitSignature check that a commit is signed, payload and signature are given by GitUtils.CommitSignature
+func (v ArtifactVerifier) VerifyCommitSignature(gitUrl, commit string, payload, signature []byte) error {
+	if v.PublicKey == "" {
+		return nil
+	}
+	if len(signature) == 0 {
+		return fmt.Errorf("Commit '%s' of git repository '%s' is not signed, repository is refused.", commit, gitUrl)
+	}
+	return v.VerifySignature(fmt.Sprintf("%s (commit %s)", gitUrl, commit), bytes.NewReader(payload), signature)
+}
+
+// VerifySignature check that signature is an armored detached signature of content made by one of the public keys
+func (v ArtifactVerifier) VerifySignature(path string, content io.Reader, signature []byte) error {
+	if v.PublicKey == "" {
+		return nil
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(v.PublicKey))
+	if err != nil {
+		return fmt.Errorf("Cannot read public key used to verify signatures: %s", err.Error())
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, content, bytes.NewBuffer(signature))
+	if err != nil {
+		return fmt.Errorf("Signature of '%s' is invalid, file is refused: %s", path, err.Error())
+	}
+	log.Printf("[INFO] signature of %s is valid, signed by key %X", path, signer.PrimaryKey.KeyId)
+	return nil
+}
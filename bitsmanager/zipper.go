@@ -0,0 +1,148 @@
+package bitsmanager
+
+import (
+	"archive/zip"
+	"code.cloudfoundry.org/cli/cf/errors"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// zip format can't store a date before 1980, every entries get this date to make zip reproducible
+var zipEntriesModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type zipEntry struct {
+	Name     string
+	FullPath string
+	Info     os.FileInfo
+}
+
+// appEntries give files and folders of the app which must be sent, sorted by name
+func appEntries(dir string, filter FileFilter) ([]zipEntry, error) {
+	entries := make([]zipEntry, 0)
+	err := filter.Walk(dir, func(name string, fullPath string, fileInfo os.FileInfo) error {
+		if fileInfo.IsDir() {
+			name += "/"
+		}
+		entries = append(entries, zipEntry{
+			Name:     name,
+			FullPath: fullPath,
+			Info:     fileInfo,
+		})
+		return nil
+	})
+	if err != nil {
+		return entries, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// normalizedMode keep only the executable bit of files to not depend on umask of the machine
+func normalizedMode(fileInfo os.FileInfo) os.FileMode {
+	if fileInfo.IsDir() {
+		return os.ModeDir | 0755
+	}
+	if fileInfo.Mode()&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// ZipDirectory write a reproducible zip of files of an app folder selected by filter, same content always gives the same zip:
+// entries are sorted, modification times are fixed and permissions are normalized
+func ZipDirectory(dir string, filter FileFilter, w io.Writer) error {
+	entries, err := appEntries(dir, filter)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.NewEmptyDirError(dir)
+	}
+	zipWriter := zip.NewWriter(w)
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:   entry.Name,
+			Method: zip.Deflate,
+		}
+		if entry.Info.IsDir() {
+			header.Method = zip.Store
+		}
+		header.SetModTime(zipEntriesModTime)
+		header.SetMode(normalizedMode(entry.Info))
+		zipFilePart, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if entry.Info.IsDir() {
+			continue
+		}
+		err = copyFile(zipFilePart, entry.FullPath)
+		if err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+// copyZipEntries copy folders and files of a zip in another one, entries for which skip returns true are not copied
+func copyZipEntries(zipReader *zip.Reader, zipWriter *zip.Writer, skip func(zipFile *zip.File) bool) error {
+	for _, zipFile := range zipReader.File {
+		if skip(zipFile) {
+			continue
+		}
+		header := zipFile.FileHeader
+		part, err := zipWriter.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		if zipFile.FileInfo().IsDir() {
+			continue
+		}
+		r, err := zipFile.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(part, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// GetTreeFingerprint give a fast fingerprint of an app folder made from path, size, modification time and mode of each file,
+// no file is read. It changes each time a file is touched, it is used to know if a folder must be zipped again.
+func GetTreeFingerprint(dir string, filter FileFilter) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	entries, err := appEntries(absDir, filter)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", absDir)
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%s %d %d %o\n", entry.Name, entry.Info.Size(), entry.Info.ModTime().UnixNano(), entry.Info.Mode())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,85 @@
+package bitsmanager_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+
+	"archive/zip"
+	"bytes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Zipper", func() {
+	var firstDir, secondDir string
+	writeFile := func(dir, name, content string, mode os.FileMode, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), mode)).To(Succeed())
+		Expect(os.Chmod(path, mode)).To(Succeed())
+		Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+	}
+	zipDir := func(dir string) []byte {
+		buf := new(bytes.Buffer)
+		Expect(ZipDirectory(dir, FileFilter{}, buf)).To(Succeed())
+		return buf.Bytes()
+	}
+	BeforeEach(func() {
+		var err error
+		firstDir, err = ioutil.TempDir("", "zipper-first")
+		Expect(err).ToNot(HaveOccurred())
+		secondDir, err = ioutil.TempDir("", "zipper-second")
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(firstDir)
+		os.RemoveAll(secondDir)
+	})
+	Describe("ZipDirectory", func() {
+		It("should give the same zip for the same content whatever dates, permissions and creation order", func() {
+			writeFile(firstDir, "b/run.sh", "#!/bin/sh", 0700, time.Now())
+			writeFile(firstDir, "a.txt", "a file", 0600, time.Now())
+			writeFile(secondDir, "a.txt", "a file", 0664, time.Now().Add(-time.Hour))
+			writeFile(secondDir, "b/run.sh", "#!/bin/sh", 0775, time.Now().Add(-time.Hour))
+
+			Expect(zipDir(firstDir)).To(Equal(zipDir(secondDir)))
+		})
+		It("should write sorted entries with fixed dates and normalized permissions", func() {
+			writeFile(firstDir, "b/run.sh", "#!/bin/sh", 0700, time.Now())
+			writeFile(firstDir, "a.txt", "a file", 0600, time.Now())
+			content := zipDir(firstDir)
+
+			reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+			Expect(err).ToNot(HaveOccurred())
+			names := make([]string, 0)
+			for _, file := range reader.File {
+				names = append(names, file.Name)
+				Expect(file.ModTime().Year()).To(Equal(1980))
+			}
+			Expect(names).To(Equal([]string{"a.txt", "b/", "b/run.sh"}))
+			Expect(reader.File[0].Mode()).To(Equal(os.FileMode(0644)))
+			Expect(reader.File[1].Mode()).To(Equal(os.ModeDir | 0755))
+			Expect(reader.File[2].Mode()).To(Equal(os.FileMode(0755)))
+		})
+	})
+	Describe("GetTreeFingerprint", func() {
+		It("should change only when a file is touched", func() {
+			modTime := time.Now().Add(-time.Hour)
+			writeFile(firstDir, "a.txt", "a file", 0644, modTime)
+			before, err := GetTreeFingerprint(firstDir, FileFilter{})
+			Expect(err).ToNot(HaveOccurred())
+
+			after, err := GetTreeFingerprint(firstDir, FileFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(after).To(Equal(before))
+
+			writeFile(firstDir, "a.txt", "a file", 0644, time.Now())
+			after, err = GetTreeFingerprint(firstDir, FileFilter{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(after).ToNot(Equal(before))
+		})
+	})
+})
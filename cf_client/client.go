@@ -7,6 +7,7 @@ import (
 	"code.cloudfoundry.org/cli/api/uaa"
 	uaaWrapper "code.cloudfoundry.org/cli/api/uaa/wrapper"
 	"code.cloudfoundry.org/cli/cf/api"
+	"code.cloudfoundry.org/cli/cf/api/appevents"
 	"code.cloudfoundry.org/cli/cf/api/appinstances"
 	"code.cloudfoundry.org/cli/cf/api/applications"
 	"code.cloudfoundry.org/cli/cf/api/authentication"
@@ -26,6 +27,7 @@ import (
 	"code.cloudfoundry.org/cli/cf/i18n"
 	"code.cloudfoundry.org/cli/cf/net"
 	"code.cloudfoundry.org/cli/cf/trace"
+	"fmt"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/encryption"
 	"io/ioutil"
@@ -62,8 +64,12 @@ type Client interface {
 	EnvVarGroup() environmentvariablegroups.Repository
 	Applications() applications.Repository
 	AppInstances() appinstances.Repository
+	AppEvents() appevents.Repository
 	ApplicationBits() bitsmanager.ApplicationBitsRepository
+	Deployments() DeploymentRepository
+	DockerCredentials() DockerCredentialsRepository
 	Logs() logs.Repository
+	NewLogs() (logs.Repository, error)
 	CCv3Client() *ccv3.Client
 }
 type CfClient struct {
@@ -96,7 +102,10 @@ type CfClient struct {
 	envVarGroup                 environmentvariablegroups.Repository
 	applications                applications.Repository
 	appInstances                appinstances.Repository
+	appEvents                   appevents.Repository
 	applicationBits             bitsmanager.ApplicationBitsRepository
+	deployments                 DeploymentRepository
+	dockerCredentials           DockerCredentialsRepository
 	logs                        logs.Repository
 	ccv3Client                  *ccv3.Client
 	uaaRepo                     authentication.UAARepository
@@ -244,7 +253,10 @@ func (client *CfClient) LoadRepositories() {
 	client.envVarGroup = environmentvariablegroups.NewCloudControllerRepository(repository, gateways.CloudControllerGateway)
 	client.applications = applications.NewCloudControllerRepository(repository, gateways.CloudControllerGateway)
 	client.appInstances = appinstances.NewCloudControllerAppInstancesRepository(repository, gateways.CloudControllerGateway)
+	client.appEvents = appevents.NewCloudControllerAppEventsRepository(repository, gateways.CloudControllerGateway)
 	client.applicationBits = bitsmanager.NewCloudControllerApplicationBitsRepository(repository, gateways.CloudControllerGateway)
+	client.deployments = NewCloudControllerDeploymentRepository(repository, gateways.CloudControllerGateway)
+	client.dockerCredentials = NewCloudControllerDockerCredentialsRepository(repository, gateways.CloudControllerGateway)
 	client.logs = logs.NewNoaaLogsRepository(repository, NewNOAAClient(repository, client.uaaClient), client.uaaRepo, 30*time.Second)
 }
 func (client CfClient) Gateways() CloudFoundryGateways {
@@ -337,12 +349,31 @@ func (client CfClient) Applications() applications.Repository {
 func (client CfClient) AppInstances() appinstances.Repository {
 	return client.appInstances
 }
+func (client CfClient) AppEvents() appevents.Repository {
+	return client.appEvents
+}
 func (client CfClient) ApplicationBits() bitsmanager.ApplicationBitsRepository {
 	return client.applicationBits
 }
+func (client CfClient) Deployments() DeploymentRepository {
+	return client.deployments
+}
+func (client CfClient) DockerCredentials() DockerCredentialsRepository {
+	return client.dockerCredentials
+}
 func (client CfClient) CCv3Client() *ccv3.Client {
 	return client.ccv3Client
 }
 func (client CfClient) Logs() logs.Repository {
 	return client.logs
 }
+
+// NewLogs give a logs repository with its own noaa consumer, closing it doesn't stop logs read from other repositories.
+// An error is given when cloud controller doesn't advertise a doppler endpoint.
+func (client CfClient) NewLogs() (logs.Repository, error) {
+	config := client.gateways.Config
+	if config.DopplerEndpoint() == "" {
+		return nil, fmt.Errorf("No doppler endpoint found, logs cannot be retrieved.")
+	}
+	return logs.NewNoaaLogsRepository(config, NewNOAAClient(config, client.uaaClient), client.uaaRepo, 30*time.Second), nil
+}
@@ -1,18 +1,54 @@
 package cf_client
 
+import (
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+	"time"
+)
+
 type Config struct {
-	AppName          string
-	AppVersion       string
-	ApiEndpoint      string
-	SkipInsecureSSL  bool
-	Username         string
-	Password         string
-	UserRefreshToken string
-	UserAccessToken  string
-	Locale           string
-	Verbose          bool
-	EncPrivateKey    string
-	Passphrase       string
+	AppName              string
+	AppVersion           string
+	ApiEndpoint          string
+	SkipInsecureSSL      bool
+	Username             string
+	Password             string
+	UserRefreshToken     string
+	UserAccessToken      string
+	Locale               string
+	Verbose              bool
+	EncPrivateKey        string
+	Passphrase           string
+	AppLogsDir           string
+	JournalDir           string
+	ResourceMatching     bool
+	GitSshPrivateKey     string
+	GitSshPassphrase     string
+	GitSshKnownHostsFile string
+	BitsCacheDir         string
+	ArtifactPublicKey    string
+	HttpCredentials      []bitsmanager.HttpCredential
+	HttpRetries          int
+	HttpTimeout          time.Duration
+	S3AccessKeyID        string
+	S3SecretAccessKey    string
+	S3SessionToken       string
+	S3Region             string
+	S3Endpoint           string
+	S3PathStyle          bool
+	MavenRepositories    []string
+}
+
+// S3Config give configuration of the s3 client used to download app and buildpack bits
+func (c Config) S3Config() bitsmanager.S3Config {
+	return bitsmanager.S3Config{
+		AccessKeyID:     c.S3AccessKeyID,
+		SecretAccessKey: c.S3SecretAccessKey,
+		SessionToken:    c.S3SessionToken,
+		Region:          c.S3Region,
+		Endpoint:        c.S3Endpoint,
+		PathStyle:       c.S3PathStyle,
+		Retries:         c.HttpRetries,
+	}
 }
 
 func (c *Config) SkipSSLValidation() bool {
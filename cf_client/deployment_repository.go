@@ -0,0 +1,264 @@
+package cf_client
+
+import (
+	"bytes"
+	"code.cloudfoundry.org/cli/cf/configuration/coreconfig"
+	"code.cloudfoundry.org/cli/cf/net"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+const (
+	V3PackageStateReady  = "READY"
+	V3PackageStateFailed = "FAILED"
+
+	V3BuildStateStaged = "STAGED"
+	V3BuildStateFailed = "FAILED"
+
+	V3DropletStateStaged  = "STAGED"
+	V3DropletStateFailed  = "FAILED"
+	V3DropletStateExpired = "EXPIRED"
+
+	V3DeploymentStateDeploying = "DEPLOYING"
+	V3DeploymentStateDeployed  = "DEPLOYED"
+	V3DeploymentStateCanceling = "CANCELING"
+	V3DeploymentStateCanceled  = "CANCELED"
+	V3DeploymentStateFailed    = "FAILED"
+
+	V3DeploymentStatusFinalized = "FINALIZED"
+)
+
+type V3Relationship struct {
+	Data struct {
+		GUID string `json:"guid"`
+	} `json:"data"`
+}
+
+func NewV3Relationship(guid string) V3Relationship {
+	r := V3Relationship{}
+	r.Data.GUID = guid
+	return r
+}
+
+type V3Package struct {
+	GUID  string `json:"guid,omitempty"`
+	Type  string `json:"type"`
+	State string `json:"state,omitempty"`
+}
+
+type V3Build struct {
+	GUID    string `json:"guid,omitempty"`
+	State   string `json:"state,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Droplet struct {
+		GUID string `json:"guid"`
+	} `json:"droplet"`
+}
+
+type V3Droplet struct {
+	GUID     string `json:"guid,omitempty"`
+	State    string `json:"state,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Checksum struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"checksum"`
+}
+
+// ChecksumString give checksum in the form of type:value (e.g.: sha256:a-sha256)
+func (d V3Droplet) ChecksumString() string {
+	if d.Checksum.Value == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%s", d.Checksum.Type, d.Checksum.Value)
+}
+
+type V3Deployment struct {
+	GUID   string `json:"guid,omitempty"`
+	State  string `json:"state,omitempty"`
+	Status struct {
+		Value  string `json:"value"`
+		Reason string `json:"reason"`
+	} `json:"status"`
+	Droplet struct {
+		GUID string `json:"guid"`
+	} `json:"droplet"`
+}
+
+// IsDeployed handles both the legacy "state" attribute and the newer "status" object
+func (d V3Deployment) IsDeployed() bool {
+	if d.State != "" {
+		return d.State == V3DeploymentStateDeployed
+	}
+	return d.Status.Value == V3DeploymentStatusFinalized && d.Status.Reason == V3DeploymentStateDeployed
+}
+
+// IsFailed tells if a deployment ended without being deployed
+func (d V3Deployment) IsFailed() bool {
+	if d.State != "" {
+		return d.State == V3DeploymentStateCanceled || d.State == V3DeploymentStateFailed
+	}
+	return d.Status.Value == V3DeploymentStatusFinalized && d.Status.Reason != V3DeploymentStateDeployed
+}
+
+func (d V3Deployment) StateDescription() string {
+	if d.State != "" {
+		return d.State
+	}
+	return fmt.Sprintf("%s (%s)", d.Status.Value, d.Status.Reason)
+}
+
+type DeploymentRepository interface {
+	CreatePackage(appGuid string) (V3Package, error)
+	GetPackage(packageGuid string) (V3Package, error)
+	GetLatestPackage(appGuid string) (V3Package, error)
+	CreateBuild(packageGuid string) (V3Build, error)
+	GetBuild(buildGuid string) (V3Build, error)
+	SetCurrentDroplet(appGuid string, dropletGuid string) error
+	GetCurrentDroplet(appGuid string) (V3Droplet, error)
+	GetDroplet(dropletGuid string) (V3Droplet, error)
+	CopyDroplet(sourceDropletGuid string, appGuid string) (V3Droplet, error)
+	CreateDeployment(appGuid string, dropletGuid string) (V3Deployment, error)
+	GetDeployment(deploymentGuid string) (V3Deployment, error)
+	CancelDeployment(deploymentGuid string) error
+}
+
+type CloudControllerDeploymentRepository struct {
+	config  coreconfig.Reader
+	gateway net.Gateway
+}
+
+func NewCloudControllerDeploymentRepository(config coreconfig.Reader, gateway net.Gateway) (repo CloudControllerDeploymentRepository) {
+	repo.config = config
+	repo.gateway = gateway
+	return
+}
+func (repo CloudControllerDeploymentRepository) CreatePackage(appGuid string) (V3Package, error) {
+	body := struct {
+		Type          string `json:"type"`
+		Relationships struct {
+			App V3Relationship `json:"app"`
+		} `json:"relationships"`
+	}{Type: "bits"}
+	body.Relationships.App = NewV3Relationship(appGuid)
+	var pkg V3Package
+	err := repo.doRequest("POST", "/v3/packages", body, &pkg)
+	return pkg, err
+}
+func (repo CloudControllerDeploymentRepository) GetPackage(packageGuid string) (V3Package, error) {
+	var pkg V3Package
+	err := repo.gateway.GetResource(fmt.Sprintf("%s/v3/packages/%s", repo.config.APIEndpoint(), packageGuid), &pkg)
+	return pkg, err
+}
+func (repo CloudControllerDeploymentRepository) GetLatestPackage(appGuid string) (V3Package, error) {
+	query := url.Values{}
+	query.Set("order_by", "-created_at")
+	query.Set("per_page", "1")
+	query.Set("states", V3PackageStateReady)
+	var pkgs struct {
+		Resources []V3Package `json:"resources"`
+	}
+	err := repo.gateway.GetResource(
+		fmt.Sprintf("%s/v3/apps/%s/packages?%s", repo.config.APIEndpoint(), appGuid, query.Encode()),
+		&pkgs,
+	)
+	if err != nil {
+		return V3Package{}, err
+	}
+	if len(pkgs.Resources) == 0 {
+		return V3Package{}, fmt.Errorf("No package ready to be staged can be found for app %s", appGuid)
+	}
+	return pkgs.Resources[0], nil
+}
+func (repo CloudControllerDeploymentRepository) CreateBuild(packageGuid string) (V3Build, error) {
+	body := struct {
+		Package struct {
+			GUID string `json:"guid"`
+		} `json:"package"`
+	}{}
+	body.Package.GUID = packageGuid
+	var build V3Build
+	err := repo.doRequest("POST", "/v3/builds", body, &build)
+	return build, err
+}
+func (repo CloudControllerDeploymentRepository) GetBuild(buildGuid string) (V3Build, error) {
+	var build V3Build
+	err := repo.gateway.GetResource(fmt.Sprintf("%s/v3/builds/%s", repo.config.APIEndpoint(), buildGuid), &build)
+	return build, err
+}
+func (repo CloudControllerDeploymentRepository) SetCurrentDroplet(appGuid string, dropletGuid string) error {
+	return repo.doRequest(
+		"PATCH",
+		fmt.Sprintf("/v3/apps/%s/relationships/current_droplet", appGuid),
+		NewV3Relationship(dropletGuid),
+		nil,
+	)
+}
+func (repo CloudControllerDeploymentRepository) GetCurrentDroplet(appGuid string) (V3Droplet, error) {
+	var droplet V3Droplet
+	err := repo.gateway.GetResource(fmt.Sprintf("%s/v3/apps/%s/droplets/current", repo.config.APIEndpoint(), appGuid), &droplet)
+	return droplet, err
+}
+func (repo CloudControllerDeploymentRepository) GetDroplet(dropletGuid string) (V3Droplet, error) {
+	var droplet V3Droplet
+	err := repo.gateway.GetResource(fmt.Sprintf("%s/v3/droplets/%s", repo.config.APIEndpoint(), dropletGuid), &droplet)
+	return droplet, err
+}
+func (repo CloudControllerDeploymentRepository) CopyDroplet(sourceDropletGuid string, appGuid string) (V3Droplet, error) {
+	body := struct {
+		Relationships struct {
+			App V3Relationship `json:"app"`
+		} `json:"relationships"`
+	}{}
+	body.Relationships.App = NewV3Relationship(appGuid)
+	query := url.Values{}
+	query.Set("source_guid", sourceDropletGuid)
+	var droplet V3Droplet
+	err := repo.doRequest("POST", "/v3/droplets?"+query.Encode(), body, &droplet)
+	return droplet, err
+}
+func (repo CloudControllerDeploymentRepository) CreateDeployment(appGuid string, dropletGuid string) (V3Deployment, error) {
+	body := struct {
+		Droplet struct {
+			GUID string `json:"guid"`
+		} `json:"droplet"`
+		Relationships struct {
+			App V3Relationship `json:"app"`
+		} `json:"relationships"`
+	}{}
+	body.Droplet.GUID = dropletGuid
+	body.Relationships.App = NewV3Relationship(appGuid)
+	var deployment V3Deployment
+	err := repo.doRequest("POST", "/v3/deployments", body, &deployment)
+	return deployment, err
+}
+func (repo CloudControllerDeploymentRepository) GetDeployment(deploymentGuid string) (V3Deployment, error) {
+	var deployment V3Deployment
+	err := repo.gateway.GetResource(fmt.Sprintf("%s/v3/deployments/%s", repo.config.APIEndpoint(), deploymentGuid), &deployment)
+	return deployment, err
+}
+func (repo CloudControllerDeploymentRepository) CancelDeployment(deploymentGuid string) error {
+	return repo.doRequest("POST", fmt.Sprintf("/v3/deployments/%s/actions/cancel", deploymentGuid), nil, nil)
+}
+func (repo CloudControllerDeploymentRepository) doRequest(method, path string, body interface{}, response interface{}) error {
+	var data io.ReadSeeker
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		data = bytes.NewReader(b)
+	}
+	req, err := repo.gateway.NewRequest(method, repo.config.APIEndpoint()+path, repo.config.AccessToken(), data)
+	if err != nil {
+		return err
+	}
+	if response == nil {
+		_, _, err = repo.gateway.PerformRequestForTextResponse(req)
+		return err
+	}
+	_, err = repo.gateway.PerformRequestForJSONResponse(req, response)
+	return err
+}
@@ -0,0 +1,138 @@
+package cf_client_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+
+	"code.cloudfoundry.org/cli/cf/i18n"
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("CloudControllerDeploymentRepository", func() {
+	type request struct {
+		Method string
+		Path   string
+		Query  string
+		Body   map[string]interface{}
+	}
+	var server *httptest.Server
+	var requests []request
+	var responses map[string]string
+	var repo DeploymentRepository
+	BeforeEach(func() {
+		requests = make([]request, 0)
+		responses = make(map[string]string)
+		// stand-in of cloud controller v3 api answering a json body for each method and path
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r := request{Method: req.Method, Path: req.URL.Path, Query: req.URL.RawQuery}
+			b, err := ioutil.ReadAll(req.Body)
+			Expect(err).ToNot(HaveOccurred())
+			if len(b) > 0 {
+				Expect(json.Unmarshal(b, &r.Body)).To(Succeed())
+			}
+			requests = append(requests, r)
+			response, ok := responses[req.Method+" "+req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"errors": [{"code": 10010, "title": "CF-ResourceNotFound", "detail": "not found"}]}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(response))
+		}))
+		config := NewTerraformRepository()
+		config.SetAPIEndpoint(server.URL)
+		config.SetAccessToken("bearer token")
+		i18n.T = i18n.Init(config)
+		repo = NewCloudControllerDeploymentRepository(config, NewCloudControllerGateway(config, NewCfLogger(false)))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("should create a deployment of a droplet for an app", func() {
+		responses["POST /v3/deployments"] = `{"guid": "deployment-guid", "state": "DEPLOYING"}`
+
+		deployment, err := repo.CreateDeployment("app-guid", "droplet-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.GUID).To(Equal("deployment-guid"))
+		Expect(deployment.IsDeployed()).To(BeFalse())
+		Expect(deployment.IsFailed()).To(BeFalse())
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Body).To(Equal(map[string]interface{}{
+			"droplet": map[string]interface{}{"guid": "droplet-guid"},
+			"relationships": map[string]interface{}{
+				"app": map[string]interface{}{"data": map[string]interface{}{"guid": "app-guid"}},
+			},
+		}))
+	})
+	It("should get a deployment with legacy state", func() {
+		responses["GET /v3/deployments/deployment-guid"] = `{"guid": "deployment-guid", "state": "DEPLOYED"}`
+
+		deployment, err := repo.GetDeployment("deployment-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.IsDeployed()).To(BeTrue())
+		Expect(deployment.StateDescription()).To(Equal("DEPLOYED"))
+	})
+	It("should get a deployment with status", func() {
+		responses["GET /v3/deployments/deployment-guid"] = `{"guid": "deployment-guid", "status": {"value": "FINALIZED", "reason": "CANCELED"}}`
+
+		deployment, err := repo.GetDeployment("deployment-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deployment.IsDeployed()).To(BeFalse())
+		Expect(deployment.IsFailed()).To(BeTrue())
+		Expect(deployment.StateDescription()).To(Equal("FINALIZED (CANCELED)"))
+	})
+	It("should give an error when deployment doesn't exist", func() {
+		_, err := repo.GetDeployment("unknown-guid")
+		Expect(err).To(HaveOccurred())
+	})
+	It("should cancel a deployment", func() {
+		responses["POST /v3/deployments/deployment-guid/actions/cancel"] = `{}`
+
+		Expect(repo.CancelDeployment("deployment-guid")).To(Succeed())
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Method).To(Equal("POST"))
+		Expect(requests[0].Path).To(Equal("/v3/deployments/deployment-guid/actions/cancel"))
+	})
+	It("should create a bits package for an app", func() {
+		responses["POST /v3/packages"] = `{"guid": "package-guid", "type": "bits", "state": "AWAITING_UPLOAD"}`
+
+		pkg, err := repo.CreatePackage("app-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pkg.GUID).To(Equal("package-guid"))
+		Expect(requests[0].Body["type"]).To(Equal("bits"))
+	})
+	It("should give the latest package ready to be staged", func() {
+		responses["GET /v3/apps/app-guid/packages"] = `{"resources": [{"guid": "package-guid", "type": "bits", "state": "READY"}]}`
+
+		pkg, err := repo.GetLatestPackage("app-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pkg.GUID).To(Equal("package-guid"))
+		Expect(requests[0].Query).To(Equal("order_by=-created_at&per_page=1&states=READY"))
+	})
+	It("should fail when app has no package ready to be staged", func() {
+		responses["GET /v3/apps/app-guid/packages"] = `{"resources": []}`
+
+		_, err := repo.GetLatestPackage("app-guid")
+		Expect(err).To(HaveOccurred())
+	})
+	It("should create a build of a package and give its droplet", func() {
+		responses["POST /v3/builds"] = `{"guid": "build-guid", "state": "STAGING"}`
+		responses["GET /v3/builds/build-guid"] = `{"guid": "build-guid", "state": "STAGED", "droplet": {"guid": "droplet-guid"}}`
+
+		build, err := repo.CreateBuild("package-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requests[0].Body).To(Equal(map[string]interface{}{
+			"package": map[string]interface{}{"guid": "package-guid"},
+		}))
+		build, err = repo.GetBuild(build.GUID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(build.State).To(Equal(V3BuildStateStaged))
+		Expect(build.Droplet.GUID).To(Equal("droplet-guid"))
+	})
+})
@@ -0,0 +1,40 @@
+package cf_client
+
+import (
+	"code.cloudfoundry.org/cli/cf/configuration/coreconfig"
+	"code.cloudfoundry.org/cli/cf/net"
+	"fmt"
+)
+
+type DockerCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type DockerCredentialsRepository interface {
+	Update(appGuid string, credentials DockerCredentials) error
+}
+
+type CloudControllerDockerCredentialsRepository struct {
+	config  coreconfig.Reader
+	gateway net.Gateway
+}
+
+func NewCloudControllerDockerCredentialsRepository(config coreconfig.Reader, gateway net.Gateway) (repo CloudControllerDockerCredentialsRepository) {
+	repo.config = config
+	repo.gateway = gateway
+	return
+}
+
+// Update set credentials used by cloud controller to pull image of a docker app from a private registry,
+// cloud foundry cli doesn't support them in its application models.
+func (repo CloudControllerDockerCredentialsRepository) Update(appGuid string, credentials DockerCredentials) error {
+	body := struct {
+		DockerCredentials DockerCredentials `json:"docker_credentials"`
+	}{credentials}
+	return repo.gateway.UpdateResourceFromStruct(
+		repo.config.APIEndpoint(),
+		fmt.Sprintf("/v2/apps/%s", appGuid),
+		body,
+	)
+}
@@ -4,11 +4,16 @@ import (
 	"code.cloudfoundry.org/cli/api/cloudcontroller/ccv3"
 	"code.cloudfoundry.org/cli/cf/api"
 	"code.cloudfoundry.org/cli/cf/api/apifakes"
+	"code.cloudfoundry.org/cli/cf/api/appevents"
+	"code.cloudfoundry.org/cli/cf/api/appevents/appeventsfakes"
 	"code.cloudfoundry.org/cli/cf/api/appinstances"
+	"code.cloudfoundry.org/cli/cf/api/appinstances/appinstancesfakes"
 	"code.cloudfoundry.org/cli/cf/api/applications"
+	"code.cloudfoundry.org/cli/cf/api/applications/applicationsfakes"
 	"code.cloudfoundry.org/cli/cf/api/environmentvariablegroups"
 	"code.cloudfoundry.org/cli/cf/api/featureflags"
 	"code.cloudfoundry.org/cli/cf/api/logs"
+	"code.cloudfoundry.org/cli/cf/api/logs/logsfakes"
 	"code.cloudfoundry.org/cli/cf/api/organizations"
 	"code.cloudfoundry.org/cli/cf/api/organizations/organizationsfakes"
 	"code.cloudfoundry.org/cli/cf/api/quotas"
@@ -58,6 +63,13 @@ type FakeCfClient struct {
 	userProvidedService         *apifakes.FakeUserProvidedServiceInstanceRepository
 	finder                      *FakeFinderRepository
 	applicationBits             *bitsmanagerfakes.FakeApplicationBitsRepository
+	deployments                 *FakeDeploymentRepository
+	dockerCredentials           *FakeDockerCredentialsRepository
+	applications                *applicationsfakes.FakeRepository
+	appInstances                *appinstancesfakes.FakeRepository
+	appEvents                   *appeventsfakes.FakeRepository
+	logs                        *logsfakes.FakeRepository
+	newLogsErr                  error
 }
 
 func NewFakeCfClient() *FakeCfClient {
@@ -68,6 +80,12 @@ func NewFakeCfClient() *FakeCfClient {
 func (c *FakeCfClient) GetClient() cf_client.Client {
 	return c
 }
+func (c *FakeCfClient) SetConfig(config cf_client.Config) {
+	c.config = config
+}
+func (c *FakeCfClient) SetNewLogsError(err error) {
+	c.newLogsErr = err
+}
 func (c *FakeCfClient) Init() {
 	c.config = cf_client.Config{
 		ApiEndpoint: "http://fake.api.endpoint.com",
@@ -94,6 +112,12 @@ func (c *FakeCfClient) Init() {
 	c.userProvidedService = new(apifakes.FakeUserProvidedServiceInstanceRepository)
 	c.applicationBits = new(bitsmanagerfakes.FakeApplicationBitsRepository)
 	c.finder = new(FakeFinderRepository)
+	c.deployments = new(FakeDeploymentRepository)
+	c.dockerCredentials = new(FakeDockerCredentialsRepository)
+	c.applications = new(applicationsfakes.FakeRepository)
+	c.appInstances = new(appinstancesfakes.FakeRepository)
+	c.appEvents = new(appeventsfakes.FakeRepository)
+	c.logs = new(logsfakes.FakeRepository)
 	c.decrypter = fake_encryption.NewFakeDecrypter()
 }
 func (client FakeCfClient) Organizations() organizations.OrganizationRepository {
@@ -185,16 +209,33 @@ func (client FakeCfClient) CCv3Client() *ccv3.Client {
 	return &ccv3.Client{}
 }
 func (client FakeCfClient) Applications() applications.Repository {
-	return applications.CloudControllerRepository{}
+	return client.applications
 }
 func (client FakeCfClient) AppInstances() appinstances.Repository {
-	return appinstances.CloudControllerAppInstancesRepository{}
+	return client.appInstances
+}
+func (client FakeCfClient) AppEvents() appevents.Repository {
+	return client.appEvents
 }
 func (client FakeCfClient) ApplicationBits() bitsmanager.ApplicationBitsRepository {
 	return client.applicationBits
 }
+func (client FakeCfClient) Deployments() cf_client.DeploymentRepository {
+	return client.deployments
+}
+func (client FakeCfClient) DockerCredentials() cf_client.DockerCredentialsRepository {
+	return client.dockerCredentials
+}
 func (client FakeCfClient) Logs() logs.Repository {
-	return &logs.NoaaLogsRepository{}
+	return client.logs
+}
+
+// NewLogs give the same fake as Logs(), or the error set with SetNewLogsError
+func (client FakeCfClient) NewLogs() (logs.Repository, error) {
+	if client.newLogsErr != nil {
+		return nil, client.newLogsErr
+	}
+	return client.logs, nil
 }
 
 // get Fake call -------
@@ -268,3 +309,21 @@ func (client FakeCfClient) FakeFinder() *FakeFinderRepository {
 func (client FakeCfClient) FakeApplicationBits() *bitsmanagerfakes.FakeApplicationBitsRepository {
 	return client.applicationBits
 }
+func (client FakeCfClient) FakeDeployments() *FakeDeploymentRepository {
+	return client.deployments
+}
+func (client FakeCfClient) FakeDockerCredentials() *FakeDockerCredentialsRepository {
+	return client.dockerCredentials
+}
+func (client FakeCfClient) FakeApplications() *applicationsfakes.FakeRepository {
+	return client.applications
+}
+func (client FakeCfClient) FakeAppInstances() *appinstancesfakes.FakeRepository {
+	return client.appInstances
+}
+func (client FakeCfClient) FakeAppEvents() *appeventsfakes.FakeRepository {
+	return client.appEvents
+}
+func (client FakeCfClient) FakeLogs() *logsfakes.FakeRepository {
+	return client.logs
+}
@@ -88,6 +88,20 @@ type FakeFinderRepository struct {
 		result1 models.ServiceInstance
 		result2 error
 	}
+	GetServiceFromSpaceStub        func(spaceGuid, name string) (models.ServiceInstance, error)
+	getServiceFromSpaceMutex       sync.RWMutex
+	getServiceFromSpaceArgsForCall []struct {
+		spaceGuid string
+		name      string
+	}
+	getServiceFromSpaceReturns struct {
+		result1 models.ServiceInstance
+		result2 error
+	}
+	getServiceFromSpaceReturnsOnCall map[int]struct {
+		result1 models.ServiceInstance
+		result2 error
+	}
 	GetSpaceFromCfStub        func(spaceGuid string) (models.Space, error)
 	getSpaceFromCfMutex       sync.RWMutex
 	getSpaceFromCfArgsForCall []struct {
@@ -438,6 +452,58 @@ func (fake *FakeFinderRepository) GetServiceFromCfReturnsOnCall(i int, result1 m
 	}{result1, result2}
 }
 
+func (fake *FakeFinderRepository) GetServiceFromSpace(spaceGuid string, name string) (models.ServiceInstance, error) {
+	fake.getServiceFromSpaceMutex.Lock()
+	ret, specificReturn := fake.getServiceFromSpaceReturnsOnCall[len(fake.getServiceFromSpaceArgsForCall)]
+	fake.getServiceFromSpaceArgsForCall = append(fake.getServiceFromSpaceArgsForCall, struct {
+		spaceGuid string
+		name      string
+	}{spaceGuid, name})
+	fake.recordInvocation("GetServiceFromSpace", []interface{}{spaceGuid, name})
+	fake.getServiceFromSpaceMutex.Unlock()
+	if fake.GetServiceFromSpaceStub != nil {
+		return fake.GetServiceFromSpaceStub(spaceGuid, name)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fake.getServiceFromSpaceReturns.result1, fake.getServiceFromSpaceReturns.result2
+}
+
+func (fake *FakeFinderRepository) GetServiceFromSpaceCallCount() int {
+	fake.getServiceFromSpaceMutex.RLock()
+	defer fake.getServiceFromSpaceMutex.RUnlock()
+	return len(fake.getServiceFromSpaceArgsForCall)
+}
+
+func (fake *FakeFinderRepository) GetServiceFromSpaceArgsForCall(i int) (string, string) {
+	fake.getServiceFromSpaceMutex.RLock()
+	defer fake.getServiceFromSpaceMutex.RUnlock()
+	return fake.getServiceFromSpaceArgsForCall[i].spaceGuid, fake.getServiceFromSpaceArgsForCall[i].name
+}
+
+func (fake *FakeFinderRepository) GetServiceFromSpaceReturns(result1 models.ServiceInstance, result2 error) {
+	fake.GetServiceFromSpaceStub = nil
+	fake.getServiceFromSpaceReturns = struct {
+		result1 models.ServiceInstance
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeFinderRepository) GetServiceFromSpaceReturnsOnCall(i int, result1 models.ServiceInstance, result2 error) {
+	fake.GetServiceFromSpaceStub = nil
+	if fake.getServiceFromSpaceReturnsOnCall == nil {
+		fake.getServiceFromSpaceReturnsOnCall = make(map[int]struct {
+			result1 models.ServiceInstance
+			result2 error
+		})
+	}
+	fake.getServiceFromSpaceReturnsOnCall[i] = struct {
+		result1 models.ServiceInstance
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeFinderRepository) GetSpaceFromCf(spaceGuid string) (models.Space, error) {
 	fake.getSpaceFromCfMutex.Lock()
 	ret, specificReturn := fake.getSpaceFromCfReturnsOnCall[len(fake.getSpaceFromCfArgsForCall)]
@@ -606,6 +672,8 @@ func (fake *FakeFinderRepository) Invocations() map[string][][]interface{} {
 	defer fake.getSecGroupFromCfMutex.RUnlock()
 	fake.getServiceFromCfMutex.RLock()
 	defer fake.getServiceFromCfMutex.RUnlock()
+	fake.getServiceFromSpaceMutex.RLock()
+	defer fake.getServiceFromSpaceMutex.RUnlock()
 	fake.getSpaceFromCfMutex.RLock()
 	defer fake.getSpaceFromCfMutex.RUnlock()
 	fake.getAppFromCfMutex.RLock()
@@ -6,6 +6,7 @@ import (
 	"code.cloudfoundry.org/cli/cf/models"
 	"code.cloudfoundry.org/cli/cf/net"
 	"fmt"
+	"net/url"
 )
 
 type FinderRepository interface {
@@ -15,6 +16,7 @@ type FinderRepository interface {
 	GetRouteFromCf(routeGuid string) (models.Route, error)
 	GetSecGroupFromCf(secGroupId string) (models.SecurityGroup, error)
 	GetServiceFromCf(svcGuid string) (models.ServiceInstance, error)
+	GetServiceFromSpace(spaceGuid, name string) (models.ServiceInstance, error)
 	GetSpaceFromCf(spaceGuid string) (models.Space, error)
 	GetAppFromCf(appGuid string) (models.Application, error)
 	GetServiceBindingsFromApp(appGuid string) ([]ServiceBindingFields, error)
@@ -150,6 +152,28 @@ func (f Finder) GetServiceFromCf(svcGuid string) (models.ServiceInstance, error)
 
 	return model, nil
 }
+
+// GetServiceFromSpace retrieve a service instance (managed or user provided) by its name in a space,
+// an empty service instance is given when it doesn't exist
+func (f Finder) GetServiceFromSpace(spaceGuid, name string) (models.ServiceInstance, error) {
+	instance := models.ServiceInstance{}
+	err := f.ccGateway.ListPaginatedResources(
+		f.config.ApiEndpoint,
+		fmt.Sprintf(
+			"/v2/spaces/%s/service_instances?return_user_provided_service_instances=true&q=%s",
+			spaceGuid,
+			url.QueryEscape("name:"+name),
+		),
+		ServiceInstanceResource{},
+		func(resource interface{}) bool {
+			if serviceInstanceResource, ok := resource.(ServiceInstanceResource); ok {
+				instance = serviceInstanceResource.ToModel()
+			}
+			return false
+		},
+	)
+	return instance, err
+}
 func (f Finder) GetSpaceFromCf(spaceGuid string) (models.Space, error) {
 	res := resources.SpaceResource{}
 	err := f.ccGateway.GetResource(
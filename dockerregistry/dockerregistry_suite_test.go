@@ -0,0 +1,13 @@
+package dockerregistry_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDockerregistry(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dockerregistry Suite")
+}
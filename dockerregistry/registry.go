@@ -0,0 +1,265 @@
+package dockerregistry
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultRegistry  = "registry-1.docker.io"
+	DefaultTag       = "latest"
+	digestHeader     = "Docker-Content-Digest"
+	manifestAccepted = "application/vnd.docker.distribution.manifest.v2+json, " +
+		"application/vnd.docker.distribution.manifest.list.v2+json, " +
+		"application/vnd.oci.image.manifest.v1+json, " +
+		"application/vnd.oci.image.index.v1+json"
+)
+
+type Image struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseImage split a docker image as it is given to cloud foundry (e.g.: myregistry.com:5000/myorg/myapp:mytag)
+// by following docker rules: registry is the first component if it contains a dot or a port or is localhost.
+func ParseImage(image string) (Image, error) {
+	if image == "" {
+		return Image{}, fmt.Errorf("Docker image cannot be empty")
+	}
+	img := Image{
+		Registry: DefaultRegistry,
+	}
+	remaining := image
+	if i := strings.Index(remaining, "@"); i >= 0 {
+		img.Digest = remaining[i+1:]
+		remaining = remaining[:i]
+	}
+	if i := strings.Index(remaining, "/"); i >= 0 {
+		first := remaining[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			img.Registry = first
+			remaining = remaining[i+1:]
+		}
+	}
+	if i := strings.LastIndex(remaining, ":"); i >= 0 {
+		img.Tag = remaining[i+1:]
+		remaining = remaining[:i]
+	}
+	if img.Tag == "" && img.Digest == "" {
+		img.Tag = DefaultTag
+	}
+	if img.Registry == DefaultRegistry && !strings.Contains(remaining, "/") {
+		remaining = "library/" + remaining
+	}
+	if remaining == "" {
+		return Image{}, fmt.Errorf("Docker image '%s' is not valid", image)
+	}
+	img.Repository = remaining
+	return img, nil
+}
+
+// Reference is what must be asked to registry to retrieve manifest, digest is preferred to tag
+func (i Image) Reference() string {
+	if i.Digest != "" {
+		return i.Digest
+	}
+	return i.Tag
+}
+
+type Client struct {
+	httpClient *http.Client
+}
+
+func NewClient(skipInsecureSSL bool) *Client {
+	tr := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: skipInsecureSSL},
+	}
+	return &Client{
+		httpClient: &http.Client{Transport: tr},
+	}
+}
+
+// GetDigest resolve the current digest of an image through the registry v2 api,
+// credentials are only used when registry ask for authentication.
+func (c Client) GetDigest(image, username, password string) (string, error) {
+	img, err := ParseImage(image)
+	if err != nil {
+		return "", err
+	}
+	if img.Digest != "" {
+		return img.Digest, nil
+	}
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", img.Registry, img.Repository, img.Reference())
+	resp, err := c.headManifest(manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization, err := c.authorize(resp.Header.Get("WWW-Authenticate"), img, username, password)
+		if err != nil {
+			return "", err
+		}
+		resp, err = c.headManifest(manifestURL, authorization)
+		if err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"Error occured when retrieving digest for image '%s': %d %s",
+			image,
+			resp.StatusCode,
+			http.StatusText(resp.StatusCode),
+		)
+	}
+	digest := resp.Header.Get(digestHeader)
+	if digest == "" {
+		return "", fmt.Errorf("Registry %s doesn't give any digest for image '%s'", img.Registry, image)
+	}
+	return digest, nil
+}
+func (c Client) headManifest(manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", manifestAccepted)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// authorize answer to a challenge given by registry, it can be a basic auth or a bearer token retrieved from the realm
+func (c Client) authorize(challenge string, img Image, username, password string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return "", fmt.Errorf("Registry %s requires credentials", img.Registry)
+		}
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(username, password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		token, err := c.requestToken(params, img, username, password)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", fmt.Errorf("Registry %s asks for an unsupported authentication: %s", img.Registry, challenge)
+}
+func (c Client) requestToken(params map[string]string, img Image, username, password string) (string, error) {
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("Registry %s doesn't give any realm to retrieve a token", img.Registry)
+	}
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+	query := tokenURL.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	scope, ok := params["scope"]
+	if !ok {
+		scope = fmt.Sprintf("repository:%s:pull", img.Repository)
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"Error occured when retrieving token from %s: %d %s: \n%s",
+			realm,
+			resp.StatusCode,
+			http.StatusText(resp.StatusCode),
+			string(b),
+		)
+	}
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.Unmarshal(b, &tokenResp)
+	if err != nil {
+		return "", err
+	}
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+	return tokenResp.AccessToken, nil
+}
+
+// parseChallenge parse a WWW-Authenticate header as: Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return challenge, params
+	}
+	scheme := challenge[:i]
+	rest := challenge[i+1:]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value = rest[1:]
+				rest = ""
+			} else {
+				value = rest[1 : end+1]
+				rest = rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value = rest
+				rest = ""
+			} else {
+				value = rest[:end]
+				rest = rest[end:]
+			}
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
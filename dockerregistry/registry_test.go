@@ -0,0 +1,99 @@
+package dockerregistry_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/dockerregistry"
+
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+const (
+	fakeToken  = "a-token"
+	fakeDigest = "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+)
+
+var _ = Describe("Registry", func() {
+	Describe("ParseImage", func() {
+		It("should use docker hub and library when only a name is given", func() {
+			img, err := ParseImage("nginx")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(img).To(Equal(Image{Registry: DefaultRegistry, Repository: "library/nginx", Tag: "latest"}))
+		})
+		It("should detect registry with port, repository and tag", func() {
+			img, err := ParseImage("localhost:5000/myorg/myapp:v1")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(img).To(Equal(Image{Registry: "localhost:5000", Repository: "myorg/myapp", Tag: "v1"}))
+		})
+		It("should keep digest when image is pinned", func() {
+			img, err := ParseImage("harbor.example.com/myorg/myapp@" + fakeDigest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(img).To(Equal(Image{Registry: "harbor.example.com", Repository: "myorg/myapp", Digest: fakeDigest}))
+			Expect(img.Reference()).To(Equal(fakeDigest))
+		})
+	})
+	Describe("GetDigest", func() {
+		var server *httptest.Server
+		var digest string
+		var client *Client
+		BeforeEach(func() {
+			digest = fakeDigest
+			client = NewClient(true)
+			server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/token" {
+					user, pass, ok := req.BasicAuth()
+					if !ok || user != "user" || pass != "password" {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					Expect(req.URL.Query().Get("scope")).To(Equal("repository:myorg/myapp:pull"))
+					fmt.Fprintf(w, `{"token": "%s"}`, fakeToken)
+					return
+				}
+				if req.Header.Get("Authorization") != "Bearer "+fakeToken {
+					w.Header().Set(
+						"WWW-Authenticate",
+						fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:myorg/myapp:pull"`, server.URL),
+					)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				if req.Method != "HEAD" || req.URL.Path != "/v2/myorg/myapp/manifests/latest" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Docker-Content-Digest", digest)
+				w.WriteHeader(http.StatusOK)
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		image := func() string {
+			return strings.TrimPrefix(server.URL, "https://") + "/myorg/myapp:latest"
+		}
+		It("should give digest by retrieving a token with credentials", func() {
+			d, err := client.GetDigest(image(), "user", "password")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(d).To(Equal(fakeDigest))
+		})
+		It("should give the new digest when tag has moved", func() {
+			digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+			d, err := client.GetDigest(image(), "user", "password")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(d).To(Equal(digest))
+		})
+		It("should return an error when credentials are wrong", func() {
+			_, err := client.GetDigest(image(), "user", "wrong")
+			Expect(err).To(HaveOccurred())
+		})
+		It("should not call registry when image is pinned by digest", func() {
+			d, err := client.GetDigest("localhost:1/myorg/myapp@"+fakeDigest, "", "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(d).To(Equal(fakeDigest))
+		})
+	})
+})
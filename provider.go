@@ -2,12 +2,16 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/plugin"
 	"github.com/hashicorp/terraform/terraform"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/encryption"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
 	"strings"
+	"time"
 )
 
 func Provider() terraform.ResourceProvider {
@@ -69,6 +73,145 @@ func Provider() terraform.ResourceProvider {
 				Default:     false,
 				Description: "Set to true to skip verification of the API endpoint. Not recommended!",
 			},
+			"app_logs_dir": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_APP_LOGS_DIR", ""),
+				Description: "Directory where staging and startup logs of each app are written during deployments.",
+			},
+			"resource_matching": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Set to false to always upload all files of apps instead of only files not already cached by Cloud Foundry.",
+			},
+			"git_ssh_private_key": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_GIT_SSH_PRIVATE_KEY", ""),
+				Description: "PEM encoded private key used to clone git repositories of apps through ssh, ssh agent is used when not set.",
+			},
+			"git_ssh_private_key_passphrase": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_GIT_SSH_PRIVATE_KEY_PASSPHRASE", ""),
+				Description: "Passphrase of the git ssh private key when it is encrypted.",
+			},
+			"git_ssh_known_hosts_file": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_GIT_SSH_KNOWN_HOSTS_FILE", ""),
+				Description: "Known hosts file used to verify git servers when cloning through ssh, ~/.ssh/known_hosts is used when not set.",
+			},
+			"bits_cache_dir": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_BITS_CACHE_DIR", ""),
+				Description: "Directory where downloaded app bits and git checkouts are cached between runs, cache is disabled when not set.",
+			},
+			"artifact_public_key": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_ARTIFACT_PUBLIC_KEY", ""),
+				Description: "Armored GPG public key(s), when set app bits downloaded from an url must have a valid detached signature <url>.asc made by one of them and commits deployed from git must be signed by one of them.",
+			},
+			"http_credential": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "Credentials and headers sent when downloading app bits from hosts matching a pattern.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"host": &schema.Schema{
+							Type:        schema.TypeString,
+							Required:    true,
+							Description: "Host pattern, e.g.: artifactory.example.com or *.example.com",
+						},
+						"username": &schema.Schema{
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"password": &schema.Schema{
+							Type:      schema.TypeString,
+							Optional:  true,
+							Sensitive: true,
+						},
+						"token": &schema.Schema{
+							Type:        schema.TypeString,
+							Optional:    true,
+							Sensitive:   true,
+							Description: "Sent as bearer token, username and password are ignored when set.",
+						},
+						"headers": &schema.Schema{
+							Type:     schema.TypeMap,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"http_retries": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_HTTP_RETRIES", 3),
+				Description: "Number of retries of a failed download of app bits, an interrupted download is resumed when possible.",
+			},
+			"http_timeout": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_HTTP_TIMEOUT", "1m"),
+				Description: "Timeout to connect and to receive response headers when downloading app bits.",
+			},
+			"s3_access_key_id": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_S3_ACCESS_KEY_ID", ""),
+				Description: "Access key used to download app and buildpack bits from s3://<bucket>/<key>, credentials are found like aws cli does when not set.",
+			},
+			"s3_secret_access_key": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_S3_SECRET_ACCESS_KEY", ""),
+				Description: "Secret of the s3 access key, it can be encrypted with enc_private_key.",
+			},
+			"s3_session_token": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_S3_SESSION_TOKEN", ""),
+				Description: "Session token of temporary s3 credentials, it can be encrypted with enc_private_key.",
+			},
+			"s3_region": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.MultiEnvDefaultFunc([]string{"CF_S3_REGION", "AWS_REGION"}, "us-east-1"),
+				Description: "Region of the s3 buckets.",
+			},
+			"s3_endpoint": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_S3_ENDPOINT", ""),
+				Description: "Endpoint of an S3-compatible storage (e.g.: https://minio.example.com), AWS is used when not set.",
+			},
+			"s3_path_style": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_S3_PATH_STYLE", false),
+				Description: "Set to true to address buckets as <endpoint>/<bucket> instead of <bucket>.<endpoint>, usually needed with s3_endpoint.",
+			},
+			"maven_repositories": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Urls of maven repositories where artifacts given as maven://<group>:<artifact>:<version> are searched in order, maven central is used when not set.",
+			},
+			"deployment_journal_dir": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("CF_DEPLOYMENT_JOURNAL_DIR", ""),
+				Description: "Directory where progress of app deployments is recorded to recover interrupted deployments, journal is disabled when not set.",
+			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
@@ -85,6 +228,8 @@ func Provider() terraform.ResourceProvider {
 			"cloudfoundry_isolation_segment": resources.LoadCfResource(resources.CfIsolationSegmentsResource{}),
 			"cloudfoundry_env_var_group":     resources.LoadCfResource(resources.CfEnvVarGroupResource{}),
 			"cloudfoundry_app":               resources.LoadCfResource(resources.CfAppsResource{}),
+			"cloudfoundry_app_manifest":      resources.LoadCfResource(resources.CfAppManifestResource{}),
+			"cloudfoundry_app_droplet":       resources.LoadCfResource(resources.CfAppDropletResource{}),
 		},
 
 		DataSourcesMap: map[string]*schema.Resource{
@@ -103,6 +248,7 @@ func Provider() terraform.ResourceProvider {
 			"cloudfoundry_isolation_segment": resources.LoadCfDataSource(resources.CfIsolationSegmentsResource{}),
 			"cloudfoundry_stack":             resources.LoadCfDataSource(resources.CfStackResource{}),
 			"cloudfoundry_app":               resources.LoadCfDataSource(resources.CfAppsResource{}),
+			"cloudfoundry_app_env":           resources.LoadCfDataSource(resources.CfAppEnvDataSource{}),
 		},
 
 		ConfigureFunc: providerConfigure,
@@ -114,18 +260,53 @@ func main() {
 }
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	config := cf_client.Config{
-		AppName:          "tf-provider",
-		AppVersion:       "0.10.0",
-		ApiEndpoint:      d.Get("api_endpoint").(string),
-		Username:         d.Get("username").(string),
-		Password:         d.Get("password").(string),
-		UserRefreshToken: parseToken(d.Get("user_refresh_token").(string)),
-		UserAccessToken:  parseToken(d.Get("user_access_token").(string)),
-		Locale:           "en_US",
-		Verbose:          d.Get("verbose").(bool),
-		SkipInsecureSSL:  d.Get("skip_ssl_validation").(bool),
-		EncPrivateKey:    d.Get("enc_private_key").(string),
-		Passphrase:       d.Get("enc_passphrase").(string),
+		AppName:              "tf-provider",
+		AppVersion:           "0.10.0",
+		ApiEndpoint:          d.Get("api_endpoint").(string),
+		Username:             d.Get("username").(string),
+		Password:             d.Get("password").(string),
+		UserRefreshToken:     parseToken(d.Get("user_refresh_token").(string)),
+		UserAccessToken:      parseToken(d.Get("user_access_token").(string)),
+		Locale:               "en_US",
+		Verbose:              d.Get("verbose").(bool),
+		SkipInsecureSSL:      d.Get("skip_ssl_validation").(bool),
+		EncPrivateKey:        d.Get("enc_private_key").(string),
+		Passphrase:           d.Get("enc_passphrase").(string),
+		AppLogsDir:           d.Get("app_logs_dir").(string),
+		JournalDir:           d.Get("deployment_journal_dir").(string),
+		ResourceMatching:     d.Get("resource_matching").(bool),
+		GitSshPrivateKey:     d.Get("git_ssh_private_key").(string),
+		GitSshPassphrase:     d.Get("git_ssh_private_key_passphrase").(string),
+		GitSshKnownHostsFile: d.Get("git_ssh_known_hosts_file").(string),
+		BitsCacheDir:         d.Get("bits_cache_dir").(string),
+		ArtifactPublicKey:    d.Get("artifact_public_key").(string),
+		HttpRetries:          d.Get("http_retries").(int),
+		S3AccessKeyID:        d.Get("s3_access_key_id").(string),
+		S3Region:             d.Get("s3_region").(string),
+		S3Endpoint:           d.Get("s3_endpoint").(string),
+		S3PathStyle:          d.Get("s3_path_style").(bool),
+		MavenRepositories:    make([]string, 0),
+	}
+	for _, repository := range d.Get("maven_repositories").([]interface{}) {
+		config.MavenRepositories = append(config.MavenRepositories, repository.(string))
+	}
+	var err error
+	config.HttpTimeout, err = time.ParseDuration(d.Get("http_timeout").(string))
+	if err != nil {
+		return nil, fmt.Errorf("'http_timeout' is not a valid duration: %s", err.Error())
+	}
+	decrypter := encryption.NewPgpDecrypter(config.EncPrivateKey, config.Passphrase)
+	config.HttpCredentials, err = httpCredentials(d, decrypter)
+	if err != nil {
+		return nil, err
+	}
+	config.S3SecretAccessKey, err = decrypter.Decrypt(d.Get("s3_secret_access_key").(string))
+	if err != nil {
+		return nil, err
+	}
+	config.S3SessionToken, err = decrypter.Decrypt(d.Get("s3_session_token").(string))
+	if err != nil {
+		return nil, err
 	}
 	if config.UserAccessToken == "" && (config.Username == "" || config.Password == "") {
 		return nil, errors.New("You must provide an 'user_access_token' or an admin 'username' and 'password'")
@@ -135,6 +316,34 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	}
 	return cf_client.NewCfClient(config)
 }
+
+// httpCredentials give credentials from http_credential blocks, password and token can be encrypted
+func httpCredentials(d *schema.ResourceData, decrypter encryption.Decrypter) ([]bitsmanager.HttpCredential, error) {
+	credentials := make([]bitsmanager.HttpCredential, 0)
+	for _, elem := range d.Get("http_credential").([]interface{}) {
+		credentialMap := elem.(map[string]interface{})
+		password, err := decrypter.Decrypt(credentialMap["password"].(string))
+		if err != nil {
+			return nil, err
+		}
+		token, err := decrypter.Decrypt(credentialMap["token"].(string))
+		if err != nil {
+			return nil, err
+		}
+		headers := make(map[string]string)
+		for key, value := range credentialMap["headers"].(map[string]interface{}) {
+			headers[key] = value.(string)
+		}
+		credentials = append(credentials, bitsmanager.HttpCredential{
+			Host:     credentialMap["host"].(string),
+			Username: credentialMap["username"].(string),
+			Password: password,
+			Token:    token,
+			Headers:  headers,
+		})
+	}
+	return credentials, nil
+}
 func parseToken(token string) string {
 	if token == "" {
 		return ""
@@ -0,0 +1,191 @@
+package resources
+
+import (
+	goerrors "errors"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/common"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	dropletStrategyRestart = "restart"
+)
+
+var validDropletStrategies = []string{dropletStrategyRestart, deploymentStrategyRolling}
+
+// CfAppDropletResource promote a droplet already staged in an app to another app (which can be in another space)
+// without staging it again.
+type CfAppDropletResource struct{}
+
+func (c CfAppDropletResource) Create(d *schema.ResourceData, meta interface{}) error {
+	return c.promote(d, meta)
+}
+func (c CfAppDropletResource) sourceDroplet(client cf_client.Client, d *schema.ResourceData) (cf_client.V3Droplet, error) {
+	if dropletGuid := d.Get("source_droplet_id").(string); dropletGuid != "" {
+		return client.Deployments().GetDroplet(dropletGuid)
+	}
+	if appGuid := d.Get("source_app_id").(string); appGuid != "" {
+		return client.Deployments().GetCurrentDroplet(appGuid)
+	}
+	return cf_client.V3Droplet{}, fmt.Errorf("One of source_app_id or source_droplet_id must be set")
+}
+func (c CfAppDropletResource) promote(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(cf_client.Client)
+	appGuid := d.Get("app_id").(string)
+	app, err := client.Finder().GetAppFromCf(appGuid)
+	if err != nil {
+		return err
+	}
+	if app.GUID == "" {
+		return fmt.Errorf("App %s cannot be found", appGuid)
+	}
+	source, err := c.sourceDroplet(client, d)
+	if err != nil {
+		return err
+	}
+	if source.State != cf_client.V3DropletStateStaged {
+		return fmt.Errorf("Droplet %s cannot be promoted because it is in state %s", source.GUID, source.State)
+	}
+	policy := ReadinessPolicy{Timeout: DefaultReadinessTimeout, DeployedAt: time.Now()}
+	log.Printf("[INFO] copying droplet %s to app %s", source.GUID, app.Name)
+	droplet, err := client.Deployments().CopyDroplet(source.GUID, appGuid)
+	if err != nil {
+		return err
+	}
+	err = common.PollingWithTimeout(func() (bool, error) {
+		droplet, err = client.Deployments().GetDroplet(droplet.GUID)
+		if err != nil {
+			return true, err
+		}
+		if droplet.State == cf_client.V3DropletStateStaged {
+			return true, nil
+		}
+		if droplet.State == cf_client.V3DropletStateFailed || droplet.State == cf_client.V3DropletStateExpired {
+			return true, fmt.Errorf("Copy of droplet %s failed with state %s: %s", source.GUID, droplet.State, droplet.Error)
+		}
+		return false, nil
+	}, 5*time.Second, policy.Remaining())
+	if err != nil {
+		return err
+	}
+	d.SetId(droplet.GUID)
+	d.Set("source_droplet_guid", source.GUID)
+	d.Set("checksum", droplet.ChecksumString())
+	d.Set("droplet_has_changed", "")
+
+	appResource := CfAppsResource{}
+	if strings.ToUpper(app.State) == stateStarted && d.Get("strategy").(string) == deploymentStrategyRolling {
+		return appResource.deployDroplet(client, app, droplet.GUID, policy)
+	}
+	err = client.Deployments().SetCurrentDroplet(appGuid, droplet.GUID)
+	if err != nil {
+		return err
+	}
+	if strings.ToUpper(app.State) != stateStarted {
+		return nil
+	}
+	return appResource.restartApp(client, app, policy)
+}
+func (c CfAppDropletResource) Read(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(cf_client.Client)
+	current, err := client.Deployments().GetCurrentDroplet(d.Get("app_id").(string))
+	if err != nil {
+		return err
+	}
+	source, err := c.sourceDroplet(client, d)
+	if err != nil {
+		return err
+	}
+	// a new droplet has been staged in source app or app doesn't run the promoted droplet anymore
+	if source.GUID != d.Get("source_droplet_guid").(string) || current.GUID != d.Id() {
+		log.Printf(
+			"[INFO] droplet of app %s must be promoted again (source droplet: %s, current droplet: %s)",
+			d.Get("app_id").(string),
+			source.GUID,
+			current.GUID,
+		)
+		d.Set("droplet_has_changed", "modified")
+		return nil
+	}
+	d.Set("checksum", current.ChecksumString())
+	d.Set("droplet_has_changed", "")
+	return nil
+}
+func (c CfAppDropletResource) Update(d *schema.ResourceData, meta interface{}) error {
+	if !d.HasChange("app_id") && !d.HasChange("source_app_id") &&
+		!d.HasChange("source_droplet_id") && !d.HasChange("droplet_has_changed") {
+		return nil
+	}
+	return c.promote(d, meta)
+}
+
+// Delete only forget the droplet, app keeps running it
+func (c CfAppDropletResource) Delete(d *schema.ResourceData, meta interface{}) error {
+	log.Printf(
+		"[INFO] droplet %s is removed from state but app %s still uses it",
+		d.Id(),
+		d.Get("app_id").(string),
+	)
+	return nil
+}
+func (c CfAppDropletResource) Exists(d *schema.ResourceData, meta interface{}) (bool, error) {
+	client := meta.(cf_client.Client)
+	app, err := client.Finder().GetAppFromCf(d.Get("app_id").(string))
+	if err != nil {
+		return false, err
+	}
+	return app.GUID != "", nil
+}
+func (c CfAppDropletResource) Schema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"app_id": &schema.Schema{
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"source_app_id": &schema.Schema{
+			Type:          schema.TypeString,
+			Optional:      true,
+			ConflictsWith: []string{"source_droplet_id"},
+		},
+		"source_droplet_id": &schema.Schema{
+			Type:          schema.TypeString,
+			Optional:      true,
+			ConflictsWith: []string{"source_app_id"},
+		},
+		"strategy": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+			Default:  dropletStrategyRestart,
+			ValidateFunc: func(elem interface{}, index string) ([]string, []error) {
+				strategy := elem.(string)
+				for _, validStrategy := range validDropletStrategies {
+					if validStrategy == strategy {
+						return make([]string, 0), make([]error, 0)
+					}
+				}
+				errMsg := fmt.Sprintf(
+					"Strategy '%s' is not valid, it must be one of %s",
+					strategy,
+					strings.Join(validDropletStrategies, ", "),
+				)
+				return make([]string, 0), []error{goerrors.New(errMsg)}
+			},
+		},
+		"source_droplet_guid": &schema.Schema{
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"checksum": &schema.Schema{
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"droplet_has_changed": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+	}
+}
@@ -0,0 +1,80 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"code.cloudfoundry.org/cli/cf/models"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+)
+
+var _ = Describe("AppDroplet", func() {
+	var resource *schema.Resource
+	var fakeClient *fake_cf_client.FakeCfClient
+	var meta interface{}
+	var resourceData *schema.ResourceData
+	makeDroplet := func(guid, state, checksum string) cf_client.V3Droplet {
+		droplet := cf_client.V3Droplet{GUID: guid, State: state}
+		droplet.Checksum.Type = "sha256"
+		droplet.Checksum.Value = checksum
+		return droplet
+	}
+	BeforeEach(func() {
+		resource = LoadCfResource(CfAppDropletResource{})
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		meta = fakeClient.GetClient()
+		resourceData = resource.Data(&terraform.InstanceState{})
+		resourceData.Set("app_id", "target-app")
+		resourceData.Set("source_app_id", "source-app")
+
+		app := models.Application{}
+		app.GUID = "target-app"
+		app.State = "stopped"
+		fakeClient.FakeFinder().GetAppFromCfReturns(app, nil)
+	})
+	Describe("Create", func() {
+		It("should copy current droplet from source app, set it current and record its checksum", func() {
+			fakeClient.FakeDeployments().GetCurrentDropletReturns(makeDroplet("source-droplet", "STAGED", "abc"), nil)
+			fakeClient.FakeDeployments().CopyDropletReturns(makeDroplet("new-droplet", "COPYING", ""), nil)
+			fakeClient.FakeDeployments().GetDropletReturns(makeDroplet("new-droplet", "STAGED", "abc"), nil)
+
+			err := resource.Create(resourceData, meta)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.FakeDeployments().GetCurrentDropletArgsForCall(0)).To(Equal("source-app"))
+			sourceGuid, appGuid := fakeClient.FakeDeployments().CopyDropletArgsForCall(0)
+			Expect(sourceGuid).To(Equal("source-droplet"))
+			Expect(appGuid).To(Equal("target-app"))
+			appGuid, dropletGuid := fakeClient.FakeDeployments().SetCurrentDropletArgsForCall(0)
+			Expect(appGuid).To(Equal("target-app"))
+			Expect(dropletGuid).To(Equal("new-droplet"))
+
+			Expect(resourceData.Id()).To(Equal("new-droplet"))
+			Expect(resourceData.Get("source_droplet_guid")).To(Equal("source-droplet"))
+			Expect(resourceData.Get("checksum")).To(Equal("sha256:abc"))
+		})
+		It("should not promote a droplet which is not staged", func() {
+			fakeClient.FakeDeployments().GetCurrentDropletReturns(makeDroplet("source-droplet", "PROCESSING_UPLOAD", ""), nil)
+
+			err := resource.Create(resourceData, meta)
+			Expect(err).To(HaveOccurred())
+			Expect(fakeClient.FakeDeployments().CopyDropletCallCount()).To(Equal(0))
+		})
+	})
+	Describe("Read", func() {
+		It("should mark droplet as changed when a new droplet is staged in source app", func() {
+			resourceData.SetId("new-droplet")
+			resourceData.Set("source_droplet_guid", "source-droplet")
+			fakeClient.FakeDeployments().GetCurrentDropletReturnsOnCall(0, makeDroplet("new-droplet", "STAGED", "abc"), nil)
+			fakeClient.FakeDeployments().GetCurrentDropletReturnsOnCall(1, makeDroplet("another-droplet", "STAGED", "def"), nil)
+
+			err := resource.Read(resourceData, meta)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resourceData.Get("droplet_has_changed")).To(Equal("modified"))
+		})
+	})
+})
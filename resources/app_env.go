@@ -0,0 +1,205 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"sort"
+)
+
+// CfAppEnvDataSource expose runtime environment of an app as given by /v2/apps/:guid/env
+type CfAppEnvDataSource struct{}
+
+type vcapService struct {
+	Name         string                 `json:"name"`
+	Label        string                 `json:"label"`
+	Plan         string                 `json:"plan"`
+	InstanceName string                 `json:"instance_name"`
+	BindingName  string                 `json:"binding_name"`
+	Tags         []string               `json:"tags"`
+	Credentials  map[string]interface{} `json:"credentials"`
+}
+
+func (c CfAppEnvDataSource) DataSourceSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"app_id": &schema.Schema{
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"environment_json": &schema.Schema{
+			Type:      schema.TypeMap,
+			Computed:  true,
+			Sensitive: true,
+		},
+		"system_env_json": &schema.Schema{
+			Type:      schema.TypeMap,
+			Computed:  true,
+			Sensitive: true,
+		},
+		"system_env_raw_json": &schema.Schema{
+			Type:      schema.TypeString,
+			Computed:  true,
+			Sensitive: true,
+		},
+		"application_env_json": &schema.Schema{
+			Type:     schema.TypeMap,
+			Computed: true,
+		},
+		"running_env_json": &schema.Schema{
+			Type:     schema.TypeMap,
+			Computed: true,
+		},
+		"staging_env_json": &schema.Schema{
+			Type:     schema.TypeMap,
+			Computed: true,
+		},
+		"application_uris": &schema.Schema{
+			Type:     schema.TypeList,
+			Computed: true,
+			Elem:     &schema.Schema{Type: schema.TypeString},
+		},
+		"vcap_services": &schema.Schema{
+			Type:     schema.TypeList,
+			Computed: true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"service": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"name": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"label": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"plan": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"instance_name": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"binding_name": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"tags": &schema.Schema{
+						Type:     schema.TypeList,
+						Computed: true,
+						Elem:     &schema.Schema{Type: schema.TypeString},
+					},
+					"credentials": &schema.Schema{
+						Type:      schema.TypeMap,
+						Computed:  true,
+						Sensitive: true,
+					},
+				},
+			},
+		},
+	}
+}
+func (c CfAppEnvDataSource) DataSourceRead(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(cf_client.Client)
+	appGuid := d.Get("app_id").(string)
+	env, err := client.Applications().ReadEnv(appGuid)
+	if err != nil {
+		return err
+	}
+	// system env is also given as is, nested values of VCAP_SERVICES are lost when it is flattened
+	systemEnv := env.System
+	if systemEnv == nil {
+		systemEnv = make(map[string]interface{})
+	}
+	rawSystemEnv, err := json.Marshal(systemEnv)
+	if err != nil {
+		return err
+	}
+	d.SetId(appGuid)
+	d.Set("environment_json", FlattenEnv(env.Environment))
+	d.Set("system_env_json", FlattenEnv(env.System))
+	d.Set("system_env_raw_json", string(rawSystemEnv))
+	d.Set("application_env_json", FlattenEnv(env.Application))
+	d.Set("running_env_json", FlattenEnv(env.Running))
+	d.Set("staging_env_json", FlattenEnv(env.Staging))
+
+	uris := make([]string, 0)
+	if vcapApp, ok := env.Application["VCAP_APPLICATION"].(map[string]interface{}); ok {
+		if appUris, ok := vcapApp["application_uris"].([]interface{}); ok {
+			for _, uri := range appUris {
+				uris = append(uris, fmt.Sprint(uri))
+			}
+		}
+	}
+	d.Set("application_uris", uris)
+
+	services, err := c.vcapServices(env.System["VCAP_SERVICES"])
+	if err != nil {
+		return err
+	}
+	return d.Set("vcap_services", services)
+}
+
+// vcapServices transform VCAP_SERVICES, which is a map of service name to its instances, in a flat list of instances
+func (c CfAppEnvDataSource) vcapServices(rawVcapServices interface{}) ([]interface{}, error) {
+	services := make([]interface{}, 0)
+	if rawVcapServices == nil {
+		return services, nil
+	}
+	b, err := json.Marshal(rawVcapServices)
+	if err != nil {
+		return services, err
+	}
+	var vcapServices map[string][]vcapService
+	err = json.Unmarshal(b, &vcapServices)
+	if err != nil {
+		return services, fmt.Errorf("VCAP_SERVICES is not valid: %s", err.Error())
+	}
+	serviceNames := make([]string, 0)
+	for serviceName, _ := range vcapServices {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+	for _, serviceName := range serviceNames {
+		for _, instance := range vcapServices[serviceName] {
+			tags := instance.Tags
+			if tags == nil {
+				tags = make([]string, 0)
+			}
+			services = append(services, map[string]interface{}{
+				"service":       serviceName,
+				"name":          instance.Name,
+				"label":         instance.Label,
+				"plan":          instance.Plan,
+				"instance_name": instance.InstanceName,
+				"binding_name":  instance.BindingName,
+				"tags":          tags,
+				"credentials":   FlattenEnv(instance.Credentials),
+			})
+		}
+	}
+	return services, nil
+}
+
+// FlattenEnv convert an env to a map of strings which can be stored by terraform,
+// values which are not strings (objects, lists, numbers, ...) are given as json
+func FlattenEnv(env map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range env {
+		if s, ok := value.(string); ok {
+			result[key] = s
+			continue
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			result[key] = fmt.Sprint(value)
+			continue
+		}
+		result[key] = string(b)
+	}
+	return result
+}
@@ -0,0 +1,508 @@
+package resources
+
+import (
+	"code.cloudfoundry.org/cli/cf/errors"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// CfAppManifestResource deploy all applications from a cf manifest,
+// each application is created and updated by CfAppsResource as it would be in a cloudfoundry_app resource.
+type CfAppManifestResource struct{}
+
+// manifestAppState is the state of an application as it would be in a cloudfoundry_app resource,
+// Meta contains schema version of the state to not migrate it again on each refresh
+type manifestAppState struct {
+	Name       string
+	ID         string
+	Attributes map[string]string
+	Meta       map[string]interface{}
+}
+
+func (c CfAppManifestResource) appResource() *schema.Resource {
+	return LoadCfResource(CfAppsResource{})
+}
+func (c CfAppManifestResource) generateId(d *schema.ResourceData) string {
+	return strconv.Itoa(hashcode.String(d.Get("space_id").(string) + "-" + d.Get("manifest_path").(string)))
+}
+
+// parseManifest read manifest with its variables, d can be a ResourceData or a ResourceDiff
+func (c CfAppManifestResource) parseManifest(d interface {
+	Get(string) interface{}
+}) (AppManifest, error) {
+	vars := make(map[string]string)
+	for key, value := range d.Get("vars").(map[string]interface{}) {
+		vars[key] = fmt.Sprint(value)
+	}
+	return ParseAppManifest(d.Get("manifest_path").(string), vars)
+}
+
+// appStates read states of applications stored in the applications attribute
+func (c CfAppManifestResource) appStates(applications interface{}) map[string]manifestAppState {
+	states := make(map[string]manifestAppState)
+	for _, elem := range applications.([]interface{}) {
+		appMap := elem.(map[string]interface{})
+		appState := manifestAppState{
+			Name:       appMap["name"].(string),
+			ID:         appMap["id"].(string),
+			Attributes: make(map[string]string),
+			Meta:       make(map[string]interface{}),
+		}
+		json.Unmarshal([]byte(appMap["attributes"].(string)), &appState.Attributes)
+		if meta, ok := appMap["meta"].(string); ok && meta != "" {
+			json.Unmarshal([]byte(meta), &appState.Meta)
+		}
+		states[appState.Name] = appState
+	}
+	return states
+}
+func (c CfAppManifestResource) setAppStates(d *schema.ResourceData, manifest AppManifest, states map[string]manifestAppState) error {
+	apps := make([]interface{}, 0)
+	appendApp := func(appState manifestAppState) {
+		attributes, _ := json.Marshal(appState.Attributes)
+		meta, _ := json.Marshal(appState.Meta)
+		apps = append(apps, map[string]interface{}{
+			"name":       appState.Name,
+			"id":         appState.ID,
+			"attributes": string(attributes),
+			"meta":       string(meta),
+		})
+	}
+	// keep order from manifest first to have a stable state
+	for _, app := range manifest.Applications {
+		if appState, ok := states[app.Name]; ok {
+			appendApp(appState)
+			delete(states, app.Name)
+		}
+	}
+	for _, appState := range states {
+		appendApp(appState)
+	}
+	return d.Set("applications", apps)
+}
+func (c CfAppManifestResource) instanceState(appState manifestAppState) *terraform.InstanceState {
+	if appState.ID == "" {
+		return nil
+	}
+	attributes := make(map[string]string)
+	for key, value := range appState.Attributes {
+		attributes[key] = value
+	}
+	meta := make(map[string]interface{})
+	for key, value := range appState.Meta {
+		meta[key] = value
+	}
+	return &terraform.InstanceState{
+		ID:         appState.ID,
+		Attributes: attributes,
+		Meta:       meta,
+	}
+}
+
+// appConfig create the configuration that a user would have written in a cloudfoundry_app resource for this app,
+// d can be a ResourceData or a ResourceDiff
+func (c CfAppManifestResource) appConfig(d interface {
+	Get(string) interface{}
+}, meta interface{}, app ManifestApp) (*terraform.ResourceConfig, error) {
+	client := meta.(cf_client.Client)
+	spaceGuid := d.Get("space_id").(string)
+	raw := map[string]interface{}{
+		"name":                  app.Name,
+		"space_id":              spaceGuid,
+		"path":                  app.Path,
+		"started":               d.Get("started").(bool),
+		"no_blue_green_deploy":  d.Get("no_blue_green_deploy").(bool),
+		"no_blue_green_restage": d.Get("no_blue_green_restage").(bool),
+		"rolling_restart":       d.Get("rolling_restart").(bool),
+	}
+	if strategy := d.Get("deployment_strategy").(string); strategy != "" {
+		raw["deployment_strategy"] = strategy
+	}
+	stackGuid := d.Get("stack_id").(string)
+	if app.Stack != "" {
+		stack, err := client.Stack().FindByName(app.Stack)
+		if err != nil {
+			return nil, err
+		}
+		stackGuid = stack.GUID
+	}
+	if stackGuid == "" {
+		return nil, fmt.Errorf("No stack defined for application '%s', set it in manifest or with stack_id", app.Name)
+	}
+	raw["stack_id"] = stackGuid
+	if app.Instances != nil {
+		raw["instances"] = *app.Instances
+	}
+	if app.Memory != "" {
+		raw["memory"] = app.Memory
+	}
+	if app.DiskQuota != "" {
+		raw["disk_quota"] = app.DiskQuota
+	}
+	if app.Command != "" {
+		raw["command"] = app.Command
+	}
+	if app.Buildpack != "" {
+		raw["buildpack"] = app.Buildpack
+	}
+	if app.HealthCheckType != "" {
+		raw["health_check_type"] = app.HealthCheckType
+	}
+	if app.HealthCheckHTTPEndpoint != "" {
+		raw["health_check_http_endpoint"] = app.HealthCheckHTTPEndpoint
+	}
+	if app.Timeout != 0 {
+		raw["health_check_timeout"] = app.Timeout
+	}
+	if app.Docker.Image != "" {
+		raw["docker_image"] = app.Docker.Image
+	}
+	if app.Docker.Username != "" {
+		raw["docker_username"] = app.Docker.Username
+		raw["docker_password"] = d.Get("docker_password").(string)
+	}
+	env := make(map[string]interface{})
+	for key, value := range app.EnvAsString() {
+		env[key] = value
+	}
+	if len(env) > 0 {
+		raw["env_var"] = env
+	}
+
+	if !app.NoRoute && len(app.Routes) > 0 {
+		space, err := client.Finder().GetSpaceFromCf(spaceGuid)
+		if err != nil {
+			return nil, err
+		}
+		routes := make([]interface{}, 0)
+		for _, route := range app.Routes {
+			routeGuid, err := c.findRouteGuid(client, space.Organization.GUID, route.Route)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, routeGuid)
+		}
+		raw["routes"] = routes
+	}
+	if len(app.Services) > 0 {
+		services := make([]interface{}, 0)
+		for _, serviceName := range app.Services {
+			instance, err := client.Finder().GetServiceFromSpace(spaceGuid, serviceName)
+			if err != nil {
+				return nil, err
+			}
+			if instance.GUID == "" {
+				return nil, fmt.Errorf("Service instance '%s' used by application '%s' cannot be found", serviceName, app.Name)
+			}
+			services = append(services, instance.GUID)
+		}
+		raw["services"] = services
+	}
+
+	rawConfig, err := config.NewRawConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+	resourceConfig := terraform.NewResourceConfig(rawConfig)
+	_, errs := c.appResource().Validate(resourceConfig)
+	if len(errs) > 0 {
+		errMsgs := make([]string, len(errs))
+		for i, err := range errs {
+			errMsgs[i] = err.Error()
+		}
+		return nil, fmt.Errorf("Application '%s' is not valid: %s", app.Name, strings.Join(errMsgs, ", "))
+	}
+	return resourceConfig, nil
+}
+
+// findRouteGuid retrieve a route from an url in the form of host.domain[:port][/path],
+// as in cf cli it first tries to use the full host as a domain before splitting it into host and domain
+func (c CfAppManifestResource) findRouteGuid(client cf_client.Client, orgGuid, routeUrl string) (string, error) {
+	hostAndDomain := routeUrl
+	path := ""
+	if i := strings.Index(hostAndDomain, "/"); i >= 0 {
+		path = hostAndDomain[i:]
+		hostAndDomain = hostAndDomain[:i]
+	}
+	port := 0
+	if i := strings.LastIndex(hostAndDomain, ":"); i >= 0 {
+		var err error
+		port, err = strconv.Atoi(hostAndDomain[i+1:])
+		if err != nil {
+			return "", fmt.Errorf("Route '%s' has an invalid port", routeUrl)
+		}
+		hostAndDomain = hostAndDomain[:i]
+	}
+	candidates := [][]string{{"", hostAndDomain}}
+	if i := strings.Index(hostAndDomain, "."); i >= 0 {
+		candidates = append(candidates, []string{hostAndDomain[:i], hostAndDomain[i+1:]})
+	}
+	for _, candidate := range candidates {
+		domain, err := client.Domain().FindByNameInOrg(candidate[1], orgGuid)
+		if _, ok := err.(*errors.ModelNotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		route, err := client.Route().Find(candidate[0], domain, path, port)
+		if _, ok := err.(*errors.ModelNotFoundError); ok {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return route.GUID, nil
+	}
+	return "", fmt.Errorf("Route '%s' cannot be found, it must be created before (e.g.: with a cloudfoundry_route resource)", routeUrl)
+}
+func (c CfAppManifestResource) Create(d *schema.ResourceData, meta interface{}) error {
+	err := c.deploy(d, meta)
+	// even on failure apps already deployed must be kept in state
+	if len(c.appStates(d.Get("applications"))) > 0 {
+		d.SetId(c.generateId(d))
+	}
+	return err
+}
+func (c CfAppManifestResource) deploy(d *schema.ResourceData, meta interface{}) error {
+	manifest, err := c.parseManifest(d)
+	if err != nil {
+		return err
+	}
+	appResource := c.appResource()
+	// applications are planned as computed when they change, their states are the ones before the update
+	applications, _ := d.GetChange("applications")
+	states := c.appStates(applications)
+	defer c.setAppStates(d, manifest, states)
+	for _, app := range manifest.Applications {
+		resourceConfig, err := c.appConfig(d, meta, app)
+		if err != nil {
+			return err
+		}
+		state := c.instanceState(states[app.Name])
+		diff, err := appResource.Diff(state, resourceConfig, meta)
+		if err != nil {
+			return err
+		}
+		if diff == nil || diff.Empty() {
+			continue
+		}
+		log.Printf("[INFO] deploying application %s from manifest %s", app.Name, d.Get("manifest_path").(string))
+		newState, err := appResource.Apply(state, diff, meta)
+		if newState != nil && newState.ID != "" {
+			states[app.Name] = manifestAppState{Name: app.Name, ID: newState.ID, Attributes: newState.Attributes, Meta: newState.Meta}
+		}
+		if err != nil {
+			return fmt.Errorf("Error when deploying application '%s' from manifest: %s", app.Name, err.Error())
+		}
+	}
+	for name, appState := range states {
+		if c.isInManifest(manifest, name) {
+			continue
+		}
+		log.Printf("[INFO] deleting application %s which has been removed from manifest %s", name, d.Get("manifest_path").(string))
+		_, err := appResource.Apply(c.instanceState(appState), &terraform.InstanceDiff{Destroy: true}, meta)
+		if err != nil {
+			return err
+		}
+		delete(states, name)
+	}
+	return nil
+}
+func (c CfAppManifestResource) isInManifest(manifest AppManifest, name string) bool {
+	for _, app := range manifest.Applications {
+		if app.Name == name {
+			return true
+		}
+	}
+	return false
+}
+func (c CfAppManifestResource) Read(d *schema.ResourceData, meta interface{}) error {
+	manifest, err := c.parseManifest(d)
+	if err != nil {
+		return err
+	}
+	appResource := c.appResource()
+	states := c.appStates(d.Get("applications"))
+	for name, appState := range states {
+		newState, err := appResource.Refresh(c.instanceState(appState), meta)
+		if err != nil {
+			return err
+		}
+		if newState == nil {
+			log.Printf("[WARN] application %s from manifest no longer exists in your Cloud Foundry", name)
+			delete(states, name)
+			continue
+		}
+		states[name] = manifestAppState{Name: name, ID: newState.ID, Attributes: newState.Attributes, Meta: newState.Meta}
+	}
+	if len(states) == 0 {
+		log.Printf(
+			"[WARN] removing manifest %s from state because none of its applications exist in your Cloud Foundry",
+			d.Get("manifest_path").(string),
+		)
+		d.SetId("")
+		return nil
+	}
+	return c.setAppStates(d, manifest, states)
+}
+
+// CustomizeDiff plan an update of applications when an application must be deployed (as a cloudfoundry_app resource
+// would show a change), created or deleted to follow the manifest
+func (c CfAppManifestResource) CustomizeDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if diff.Id() == "" {
+		return nil
+	}
+	hasChanged, err := c.hasChanged(diff, meta)
+	if err != nil {
+		return err
+	}
+	if !hasChanged {
+		return nil
+	}
+	log.Printf("[INFO] applications of manifest %s have changed", diff.Get("manifest_path").(string))
+	return diff.SetNewComputed("applications")
+}
+func (c CfAppManifestResource) hasChanged(diff *schema.ResourceDiff, meta interface{}) (bool, error) {
+	manifest, err := c.parseManifest(diff)
+	if err != nil {
+		return false, err
+	}
+	appResource := c.appResource()
+	states := c.appStates(diff.Get("applications"))
+	for name := range states {
+		if !c.isInManifest(manifest, name) {
+			return true, nil
+		}
+	}
+	for _, app := range manifest.Applications {
+		if _, ok := states[app.Name]; !ok {
+			return true, nil
+		}
+		resourceConfig, err := c.appConfig(diff, meta, app)
+		if err != nil {
+			return false, err
+		}
+		appDiff, err := appResource.Diff(c.instanceState(states[app.Name]), resourceConfig, meta)
+		if err != nil {
+			return false, err
+		}
+		if appDiff != nil && !appDiff.Empty() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (c CfAppManifestResource) Update(d *schema.ResourceData, meta interface{}) error {
+	return c.deploy(d, meta)
+}
+func (c CfAppManifestResource) Delete(d *schema.ResourceData, meta interface{}) error {
+	appResource := c.appResource()
+	for _, appState := range c.appStates(d.Get("applications")) {
+		_, err := appResource.Apply(c.instanceState(appState), &terraform.InstanceDiff{Destroy: true}, meta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exists tell if at least one application of the manifest still exists in Cloud Foundry
+func (c CfAppManifestResource) Exists(d *schema.ResourceData, meta interface{}) (bool, error) {
+	client := meta.(cf_client.Client)
+	for _, appState := range c.appStates(d.Get("applications")) {
+		if appState.ID == "" {
+			continue
+		}
+		app, err := client.Finder().GetAppFromCf(appState.ID)
+		if err != nil {
+			return false, err
+		}
+		if app.GUID != "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (c CfAppManifestResource) Schema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"manifest_path": &schema.Schema{
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"vars": &schema.Schema{
+			Type:      schema.TypeMap,
+			Optional:  true,
+			Elem:      schema.TypeString,
+			Sensitive: true,
+		},
+		"space_id": &schema.Schema{
+			Type:     schema.TypeString,
+			Required: true,
+			ForceNew: true,
+		},
+		"stack_id": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"docker_password": &schema.Schema{
+			Type:      schema.TypeString,
+			Optional:  true,
+			Sensitive: true,
+		},
+		"started": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+			Default:  true,
+		},
+		"no_blue_green_restage": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"no_blue_green_deploy": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"rolling_restart": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"deployment_strategy": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"applications": &schema.Schema{
+			Type:     schema.TypeList,
+			Computed: true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"name": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"id": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"attributes": &schema.Schema{
+						Type:      schema.TypeString,
+						Computed:  true,
+						Sensitive: true,
+					},
+					"meta": &schema.Schema{
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+				},
+			},
+		},
+	}
+}
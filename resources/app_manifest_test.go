@@ -0,0 +1,233 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"code.cloudfoundry.org/cli/cf/models"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("CfAppManifestResource", func() {
+	var fakeClient *fake_cf_client.FakeCfClient
+	var meta interface{}
+	var resource *schema.Resource
+	var manifestDir string
+	var manifestPath string
+	// apps known by cloud controller by guid, an app is created with the guid of its name
+	var cfApps map[string]models.Application
+	writeManifest := func(content string) {
+		err := ioutil.WriteFile(manifestPath, []byte(content), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	}
+	resourceConfig := func() *terraform.ResourceConfig {
+		rawConfig, err := config.NewRawConfig(map[string]interface{}{
+			"manifest_path": manifestPath,
+			"space_id":      "space-guid",
+			"stack_id":      "stack-guid",
+			"started":       false,
+			// applications are updated in place
+			"no_blue_green_deploy": true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return terraform.NewResourceConfig(rawConfig)
+	}
+	plan := func(state *terraform.InstanceState) *terraform.InstanceDiff {
+		diff, err := resource.Diff(state, resourceConfig(), meta)
+		Expect(err).ToNot(HaveOccurred())
+		return diff
+	}
+	deploy := func(state *terraform.InstanceState) *terraform.InstanceState {
+		newState, err := resource.Apply(state, plan(state), meta)
+		Expect(err).ToNot(HaveOccurred())
+		return newState
+	}
+	BeforeEach(func() {
+		var err error
+		manifestDir, err = ioutil.TempDir("", "app-manifest")
+		Expect(err).ToNot(HaveOccurred())
+		manifestPath = filepath.Join(manifestDir, "manifest.yml")
+		err = os.Mkdir(filepath.Join(manifestDir, "app"), 0755)
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(manifestDir, "app", "index.html"), []byte("hello"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+		writeManifest(`---
+path: app
+applications:
+- name: first
+  instances: 1
+  memory: 64M
+- name: second
+  memory: 128M
+`)
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		meta = fakeClient.GetClient()
+		resource = LoadCfResource(CfAppManifestResource{})
+
+		cfApps = make(map[string]models.Application)
+		saveApp := func(guid string, params models.AppParams) models.Application {
+			app := cfApps[guid]
+			app.GUID = guid
+			app.SpaceGUID = "space-guid"
+			app.Stack = &models.Stack{GUID: "stack-guid"}
+			app.State = "stopped"
+			if params.Name != nil {
+				app.Name = *params.Name
+			}
+			if params.InstanceCount != nil {
+				app.InstanceCount = *params.InstanceCount
+			}
+			if params.Memory != nil {
+				app.Memory = *params.Memory
+			}
+			if params.DiskQuota != nil {
+				app.DiskQuota = *params.DiskQuota
+			}
+			if params.Diego != nil {
+				app.Diego = *params.Diego
+			}
+			if params.HealthCheckType != nil {
+				app.HealthCheckType = *params.HealthCheckType
+			}
+			cfApps[guid] = app
+			return app
+		}
+		fakeClient.FakeApplications().CreateStub = func(params models.AppParams) (models.Application, error) {
+			return saveApp(*params.Name+"-guid", params), nil
+		}
+		fakeClient.FakeApplications().UpdateStub = func(appGuid string, params models.AppParams) (models.Application, error) {
+			return saveApp(appGuid, params), nil
+		}
+		fakeClient.FakeFinder().GetAppFromCfStub = func(appGuid string) (models.Application, error) {
+			return cfApps[appGuid], nil
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(manifestDir)
+	})
+	It("should create each application of the manifest", func() {
+		state := deploy(nil)
+
+		Expect(fakeClient.FakeApplications().CreateCallCount()).To(Equal(2))
+		Expect(state.Attributes["applications.#"]).To(Equal("2"))
+		Expect(state.Attributes["applications.0.name"]).To(Equal("first"))
+		Expect(state.Attributes["applications.0.id"]).To(Equal("first-guid"))
+		Expect(state.Attributes["applications.1.id"]).To(Equal("second-guid"))
+	})
+	It("should find services of applications in space of the manifest", func() {
+		writeManifest(`---
+path: app
+applications:
+- name: first
+  services:
+  - db
+`)
+		fakeClient.FakeFinder().GetServiceFromSpaceReturns(models.ServiceInstance{
+			ServiceInstanceFields: models.ServiceInstanceFields{GUID: "db-guid", Name: "db"},
+		}, nil)
+
+		state := deploy(nil)
+		spaceGuid, name := fakeClient.FakeFinder().GetServiceFromSpaceArgsForCall(0)
+		Expect(spaceGuid).To(Equal("space-guid"))
+		Expect(name).To(Equal("db"))
+		Expect(state.Attributes["applications.0.attributes"]).To(ContainSubstring("db-guid"))
+	})
+	It("should fail when a service of an application doesn't exist in space", func() {
+		writeManifest(`---
+path: app
+applications:
+- name: first
+  services:
+  - db
+`)
+		_, err := resource.Apply(nil, plan(nil), meta)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Service instance 'db' used by application 'first' cannot be found"))
+	})
+	Context("when applications are deployed", func() {
+		var state *terraform.InstanceState
+		BeforeEach(func() {
+			state = deploy(nil)
+			var err error
+			state, err = resource.Refresh(state, meta)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("should not plan any change when manifest and applications didn't change", func() {
+			diff := plan(state)
+			Expect(diff == nil || diff.Empty()).To(BeTrue())
+		})
+		It("should keep schema version of applications to not migrate them again", func() {
+			Expect(state.Attributes["applications.0.meta"]).To(ContainSubstring(`"schema_version":"1"`))
+			Expect(state.Attributes["applications.1.meta"]).To(ContainSubstring(`"schema_version":"1"`))
+		})
+		It("should update an application changed in manifest", func() {
+			writeManifest(`---
+path: app
+applications:
+- name: first
+  instances: 2
+  memory: 64M
+- name: second
+  memory: 128M
+`)
+			diff := plan(state)
+			Expect(diff.Attributes).To(HaveKey("applications.#"))
+			Expect(diff.Attributes["applications.#"].NewComputed).To(BeTrue())
+
+			newState, err := resource.Apply(state, diff, meta)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fakeClient.FakeApplications().UpdateCallCount()).To(Equal(1))
+			appGuid, params := fakeClient.FakeApplications().UpdateArgsForCall(0)
+			Expect(appGuid).To(Equal("first-guid"))
+			Expect(*params.InstanceCount).To(Equal(2))
+			Expect(newState.Attributes["applications.#"]).To(Equal("2"))
+			Expect(newState.Attributes["applications.0.attributes"]).To(ContainSubstring(`"instances":"2"`))
+		})
+		It("should plan an update when an application changed in Cloud Foundry", func() {
+			app := cfApps["second-guid"]
+			app.Memory = 256
+			cfApps["second-guid"] = app
+			state, err := resource.Refresh(state, meta)
+			Expect(err).ToNot(HaveOccurred())
+
+			diff := plan(state)
+			Expect(diff.Attributes["applications.#"].NewComputed).To(BeTrue())
+		})
+		It("should delete an application removed from manifest", func() {
+			writeManifest(`---
+path: app
+applications:
+- name: first
+  instances: 1
+  memory: 64M
+`)
+			newState := deploy(state)
+			Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(1))
+			Expect(fakeClient.FakeApplications().DeleteArgsForCall(0)).To(Equal("second-guid"))
+			Expect(newState.Attributes["applications.#"]).To(Equal("1"))
+		})
+		It("should remove from state applications which no longer exist and plan their creation", func() {
+			delete(cfApps, "second-guid")
+			state, err := resource.Refresh(state, meta)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.Attributes["applications.#"]).To(Equal("1"))
+			Expect(state.Attributes["applications.0.name"]).To(Equal("first"))
+
+			diff := plan(state)
+			Expect(diff.Attributes["applications.#"].NewComputed).To(BeTrue())
+		})
+		It("should remove manifest from state when none of its applications exist", func() {
+			cfApps = make(map[string]models.Application)
+			state, err := resource.Refresh(state, meta)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state).To(BeNil())
+		})
+	})
+})
@@ -4,14 +4,17 @@ import (
 	"code.cloudfoundry.org/cli/cf/errors"
 	"code.cloudfoundry.org/cli/cf/formatters"
 	"code.cloudfoundry.org/cli/cf/models"
+	goerrors "errors"
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/common"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/dockerregistry"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/rewind"
 	"github.com/viant/toolbox"
 	"log"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -19,8 +22,20 @@ import (
 const (
 	stateStopped = "STOPPED"
 	stateStarted = "STARTED"
+
+	deploymentStrategyBlueGreen = "blue-green"
+	deploymentStrategyRolling   = "rolling"
 )
 
+var validDeploymentStrategies = []string{deploymentStrategyBlueGreen, deploymentStrategyRolling, deploymentStrategyCanary}
+
+// settingsKeys are attributes which only change how the provider deploys the app,
+// a change on them alone must never trigger a restage
+var settingsKeys = []string{
+	"deployment_strategy", "track_digest", "readiness", "smoke_test", "canary",
+	"keep_previous_for", "rollback", "previous_has_expired", "rolling_restart", "orphaned_venerable_id",
+}
+
 type CfAppsResource struct{}
 type AppParams struct {
 	models.AppParams
@@ -82,17 +97,75 @@ func (c CfAppsResource) resourceObject(d *schema.ResourceData) (AppParams, error
 		ServiceIds: serviceIds,
 	}, nil
 }
-func (c CfAppsResource) MakeBitsManager(meta interface{}) bitsmanager.BitsManager {
+func (c CfAppsResource) MakeBitsManager(meta interface{}, filter bitsmanager.FileFilter, overlay bitsmanager.Overlay, pathChecksum string) bitsmanager.BitsManager {
 	client := meta.(cf_client.Client)
+	cache := bitsmanager.NewBitsCache(client.Config().BitsCacheDir)
+	verifier := bitsmanager.NewArtifactVerifier(pathChecksum, client.Config().ArtifactPublicKey)
+	httpConfig := bitsmanager.HttpClientConfig{
+		Credentials: client.Config().HttpCredentials,
+		Retries:     client.Config().HttpRetries,
+		Timeout:     client.Config().HttpTimeout,
+	}
 	return bitsmanager.NewCloudControllerBitsManager(
 		client.ApplicationBits(),
 		[]bitsmanager.Handler{
-			bitsmanager.NewLocalHandler(),
-			bitsmanager.NewHttpHandler(client.Config().SkipInsecureSSL),
-			bitsmanager.NewGitHandler(client.Config().SkipInsecureSSL),
+			bitsmanager.NewLocalHandler(cache, filter),
+			bitsmanager.NewHttpHandler(client.Config().SkipInsecureSSL, httpConfig, cache, verifier, filter),
+			bitsmanager.NewMavenHandler(client.Config().SkipInsecureSSL, client.Config().MavenRepositories, httpConfig, cache, verifier, filter),
+			bitsmanager.NewS3Handler(client.Config().SkipInsecureSSL, client.Config().S3Config(), cache, verifier, filter),
+			bitsmanager.NewGitHandler(client.Config().SkipInsecureSSL, bitsmanager.GitSshConfig{
+				PrivateKey:     client.Config().GitSshPrivateKey,
+				Passphrase:     client.Config().GitSshPassphrase,
+				KnownHostsFile: client.Config().GitSshKnownHostsFile,
+			}, cache, verifier, filter),
 		},
+		client.Config().ResourceMatching,
+		overlay,
 	)
 }
+
+// fileFilter give patterns selecting files to send from excludes and includes, d can be a ResourceData or a ResourceDiff
+func (c CfAppsResource) fileFilter(d interface {
+	Get(string) interface{}
+}) bitsmanager.FileFilter {
+	filter := bitsmanager.FileFilter{
+		Excludes: make([]string, 0),
+		Includes: make([]string, 0),
+	}
+	for _, pattern := range d.Get("excludes").([]interface{}) {
+		filter.Excludes = append(filter.Excludes, pattern.(string))
+	}
+	for _, pattern := range d.Get("includes").([]interface{}) {
+		filter.Includes = append(filter.Includes, pattern.(string))
+	}
+	return filter
+}
+
+// overlay give files to add in app bits from file blocks, d can be a ResourceData or a ResourceDiff
+func (c CfAppsResource) overlay(d interface {
+	Get(string) interface{}
+}) bitsmanager.Overlay {
+	overlay := make(bitsmanager.Overlay, 0)
+	for _, elem := range d.Get("file").([]interface{}) {
+		file := elem.(map[string]interface{})
+		overlay = append(overlay, bitsmanager.OverlayFile{
+			Destination: file["destination"].(string),
+			Content:     file["content"].(string),
+			Source:      file["source"].(string),
+		})
+	}
+	return overlay
+}
+
+// pathChecksumRegex match a sha256 digest of a file (sha256:<hex>, sha256=<hex> or <hex>) or a full git commit hash
+var pathChecksumRegex = regexp.MustCompile("^(?i)((sha256[:=])?[0-9a-f]{64}|[0-9a-f]{40})$")
+
+func validatePathChecksum(elem interface{}, index string) ([]string, []error) {
+	if !pathChecksumRegex.MatchString(elem.(string)) {
+		return make([]string, 0), []error{fmt.Errorf("%s must be a sha256 digest (sha256:<hex>) or a full git commit hash", index)}
+	}
+	return make([]string, 0), make([]error, 0)
+}
 func (c CfAppsResource) Create(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(cf_client.Client)
 	if ok, _ := c.Exists(d, meta); ok {
@@ -101,15 +174,35 @@ func (c CfAppsResource) Create(d *schema.ResourceData, meta interface{}) error {
 			client.Config().ApiEndpoint,
 			d.Get("name").(string),
 		)
-		d.Set("bits_has_changed", "modified")
 	}
-	return c.createOrUpdate(d, meta)
+	err := c.createOrUpdate(d, meta)
+	if err != nil {
+		return err
+	}
+	return c.storeDockerDigest(d, meta)
 }
 func (c CfAppsResource) createOrUpdate(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(cf_client.Client)
+	err := c.RecoverDeployment(d, meta)
+	if err != nil {
+		return err
+	}
 	if d.Id() == "" {
 		return c.createApp(d, meta, d.Get("started").(bool), true)
 	}
+	err = c.DeleteOrphanedVenerable(d, meta)
+	if err != nil {
+		return err
+	}
+	if c.IsRollback(d) {
+		return c.rollback(d, meta)
+	}
+	if c.IsPreviousAppExpired(d) {
+		err := c.deletePreviousApp(d, meta)
+		if err != nil {
+			return err
+		}
+	}
 	if c.IsRoutesUpdate(d) {
 		app, err := client.Finder().GetAppFromCf(d.Id())
 		if err != nil {
@@ -133,6 +226,15 @@ func (c CfAppsResource) createOrUpdate(d *schema.ResourceData, meta interface{})
 		_, err := client.Applications().Update(d.Id(), models.AppParams{Name: &name, InstanceCount: &instances})
 		return err
 	}
+	if c.IsSettingsUpdate(d) {
+		return nil
+	}
+	if c.IsBitsDiff(d) && c.IsRollingStrategy(d) {
+		return c.updateRolling(d, meta, true)
+	}
+	if c.IsBitsDiff(d) && c.IsCanaryStrategy(d) {
+		return c.updateCanary(d, meta, true)
+	}
 	if c.IsBitsDiff(d) && d.Get("no_blue_green_deploy").(bool) {
 		a := models.Application{}
 		a.GUID = d.Id()
@@ -144,11 +246,24 @@ func (c CfAppsResource) createOrUpdate(d *schema.ResourceData, meta interface{})
 		if err != nil {
 			return err
 		}
-		return c.startApp(client, a)
+		policy, err := NewReadinessPolicy(d)
+		if err != nil {
+			return err
+		}
+		return c.startApp(client, a, policy)
 	}
 	if c.IsBitsDiff(d) {
 		return c.updateBgDeploy(d, meta)
 	}
+	if c.IsRollingRestartUpdate(d) {
+		return c.updateRollingRestart(d, meta)
+	}
+	if c.IsRollingStrategy(d) {
+		return c.updateRolling(d, meta, false)
+	}
+	if c.IsCanaryStrategy(d) {
+		return c.updateCanary(d, meta, false)
+	}
 	if d.Get("no_blue_green_restage").(bool) {
 		appParams, err := c.resourceObject(d)
 		if err != nil {
@@ -160,31 +275,195 @@ func (c CfAppsResource) createOrUpdate(d *schema.ResourceData, meta interface{})
 		if err != nil {
 			return err
 		}
-		return c.restartApp(client, a)
+		err = c.updateDockerCredentials(d, meta)
+		if err != nil {
+			return err
+		}
+		policy, err := NewReadinessPolicy(d)
+		if err != nil {
+			return err
+		}
+		return c.restartApp(client, a, policy)
 	}
 	return c.updateBgRestage(d, meta)
 }
 func (c CfAppsResource) updateBg(actionList []rewind.Action) error {
 	actions := rewind.Actions{
 		Actions:              actionList,
-		RewindFailureMessage: "Oh no. Something's gone wrong. I've tried to roll back but you should check to see if everything is OK.",
+		RewindFailureMessage: rewindFailureMessage,
 	}
 	return actions.Execute()
 }
 func (c CfAppsResource) updateBgRestage(d *schema.ResourceData, meta interface{}) error {
-	err := c.updateBg(c.rewindActionsBgRestage(d, meta))
+	err := c.updateBgJournaled(d, meta, c.rewindActionsBgRestage(d, meta))
 	if err != nil {
 		return fmt.Errorf("Error when trying to update the app %s in blue-green restage mode: %s", d.Get("name").(string), err.Error())
 	}
 	return nil
 }
 func (c CfAppsResource) updateBgDeploy(d *schema.ResourceData, meta interface{}) error {
-	err := c.updateBg(c.rewindActionsBgDeploy(d, meta))
+	err := c.updateBgJournaled(d, meta, c.rewindActionsBgDeploy(d, meta))
 	if err != nil {
 		return fmt.Errorf("Error when trying to update the app %s in blue-green deploy mode: %s", d.Get("name").(string), err.Error())
 	}
 	return nil
 }
+func (c CfAppsResource) IsRollingStrategy(d *schema.ResourceData) bool {
+	return d.Get("deployment_strategy").(string) == deploymentStrategyRolling
+}
+
+// updateRolling update app in place and roll out a new droplet by using cloud controller v3 deployments,
+// instances are replaced one by one and app is never stopped.
+// If sendBits is false the last package uploaded is restaged
+func (c CfAppsResource) updateRolling(d *schema.ResourceData, meta interface{}, sendBits bool) error {
+	client := meta.(cf_client.Client)
+	appParams, err := c.resourceObject(d)
+	if err != nil {
+		return err
+	}
+	policy, err := NewReadinessPolicy(d)
+	if err != nil {
+		return err
+	}
+	// state is managed by the deployment itself
+	appParams.State = nil
+	app, err := client.Applications().Update(d.Id(), appParams.AppParams)
+	if err != nil {
+		return err
+	}
+	err = c.updateDockerCredentials(d, meta)
+	if err != nil {
+		return err
+	}
+	err = c.updateRoutes(d, meta, app)
+	if err != nil {
+		return err
+	}
+	currentServices := make([]string, 0)
+	if d.HasChange("services") {
+		currentTfServices, _ := d.GetChange("services")
+		currentServices = common.SchemaSetToStringList(currentTfServices.(*schema.Set))
+	}
+	err = c.BindServices(client, app, appParams.ServiceIds, currentServices)
+	if err != nil {
+		return err
+	}
+
+	var pkg cf_client.V3Package
+	// docker package only reference the image, restaging it is enough to pull the image again
+	if sendBits && !c.isDockerApp(d) {
+		pkg, err = c.uploadPackage(d, meta, policy)
+	} else {
+		pkg, err = client.Deployments().GetLatestPackage(d.Id())
+	}
+	if err != nil {
+		return err
+	}
+	build, err := c.stagePackage(client, app, pkg.GUID, policy)
+	if err != nil {
+		return err
+	}
+	if !d.Get("started").(bool) || strings.ToUpper(app.State) != stateStarted {
+		err = client.Deployments().SetCurrentDroplet(d.Id(), build.Droplet.GUID)
+		if err != nil {
+			return err
+		}
+		if d.Get("started").(bool) {
+			err = c.startApp(client, app, policy)
+		}
+	} else {
+		err = c.deployDroplet(client, app, build.Droplet.GUID, policy)
+	}
+	if err != nil {
+		return fmt.Errorf("Error when trying to update the app %s in rolling mode: %s", d.Get("name").(string), err.Error())
+	}
+	if !sendBits || c.isDockerApp(d) {
+		return nil
+	}
+	return c.updateSha1(d, meta)
+}
+func (c CfAppsResource) uploadPackage(d *schema.ResourceData, meta interface{}, policy ReadinessPolicy) (cf_client.V3Package, error) {
+	client := meta.(cf_client.Client)
+	bm := c.MakeBitsManager(meta, c.fileFilter(d), c.overlay(d), d.Get("path_checksum").(string))
+	pkg, err := client.Deployments().CreatePackage(d.Id())
+	if err != nil {
+		return cf_client.V3Package{}, err
+	}
+	err = bm.UploadPackage(pkg.GUID, d.Get("path").(string))
+	if err != nil {
+		return cf_client.V3Package{}, err
+	}
+	err = common.PollingWithTimeout(func() (bool, error) {
+		pkg, err = client.Deployments().GetPackage(pkg.GUID)
+		if err != nil {
+			return true, err
+		}
+		if pkg.State == cf_client.V3PackageStateReady {
+			return true, nil
+		}
+		if pkg.State == cf_client.V3PackageStateFailed {
+			return true, fmt.Errorf("Processing upload failed for package %s", pkg.GUID)
+		}
+		return false, nil
+	}, 5*time.Second, policy.Remaining())
+	return pkg, err
+}
+func (c CfAppsResource) stagePackage(client cf_client.Client, a models.Application, packageGuid string, policy ReadinessPolicy) (cf_client.V3Build, error) {
+	build, err := client.Deployments().CreateBuild(packageGuid)
+	if err != nil {
+		return cf_client.V3Build{}, err
+	}
+	err = common.PollingWithTimeout(func() (bool, error) {
+		build, err = client.Deployments().GetBuild(build.GUID)
+		if err != nil {
+			return true, err
+		}
+		if build.State == cf_client.V3BuildStateStaged {
+			return true, nil
+		}
+		if build.State == cf_client.V3BuildStateFailed {
+			return true, fmt.Errorf("Staging failed for app %s: %s", a.Name, build.Error)
+		}
+		return false, nil
+	}, 5*time.Second, policy.Remaining())
+	if err != nil {
+		return cf_client.V3Build{}, c.createErrorFromLog(err, client, a)
+	}
+	return build, nil
+}
+func (c CfAppsResource) deployDroplet(client cf_client.Client, a models.Application, dropletGuid string, policy ReadinessPolicy) error {
+	created, err := client.Deployments().CreateDeployment(a.GUID, dropletGuid)
+	if err != nil {
+		return err
+	}
+	// last known state of the deployment, it is kept when a poll fails
+	deployment := created
+	err = common.PollingWithTimeout(func() (bool, error) {
+		current, err := client.Deployments().GetDeployment(created.GUID)
+		if err != nil {
+			return true, err
+		}
+		deployment = current
+		if deployment.IsDeployed() {
+			return true, nil
+		}
+		if deployment.IsFailed() {
+			return true, fmt.Errorf("Deployment %s failed with state %s", created.GUID, deployment.StateDescription())
+		}
+		return false, nil
+	}, 5*time.Second, policy.Remaining())
+	if err == nil {
+		return nil
+	}
+	if !deployment.IsFailed() {
+		log.Printf("[INFO] canceling deployment %s for app %s", created.GUID, a.Name)
+		cancelErr := client.Deployments().CancelDeployment(created.GUID)
+		if cancelErr != nil {
+			err = fmt.Errorf("%s and failed to cancel deployment (error: %s)", err.Error(), cancelErr.Error())
+		}
+	}
+	return c.createErrorFromLog(err, client, a)
+}
 func (c CfAppsResource) updateRoutes(d *schema.ResourceData, meta interface{}, a models.Application) error {
 	client := meta.(cf_client.Client)
 	currentRoutes := make([]string, 0)
@@ -205,6 +484,10 @@ func (c CfAppsResource) createApp(d *schema.ResourceData, meta interface{}, star
 		return err
 	}
 	d.SetId(app.GUID)
+	err = c.updateDockerCredentials(d, meta)
+	if err != nil {
+		return err
+	}
 	err = c.updateRoutes(d, meta, app)
 	if err != nil {
 		return err
@@ -228,7 +511,11 @@ func (c CfAppsResource) createApp(d *schema.ResourceData, meta interface{}, star
 	if !started {
 		return nil
 	}
-	err = c.startApp(client, app)
+	policy, err := NewReadinessPolicy(d)
+	if err != nil {
+		return err
+	}
+	err = c.startApp(client, app, policy)
 	if err != nil {
 		return err
 	}
@@ -250,75 +537,98 @@ func (c CfAppsResource) rewindActionsBgDeploy(d *schema.ResourceData, meta inter
 		origAppName = newAppName.(string)
 	}
 	origAppGuid := d.Id()
+	deleteNewApp := c.deleteNewApp(d, client, origAppGuid)
 	return []rewind.Action{
+		c.renameVenerableAction(client, origAppGuid, origAppName),
 		{
-			Forward: func() error {
-				return c.renameApplication(client, origAppGuid, venerableAppName(origAppName))
-			},
-		},
-		{
+			Name: "create new app",
 			Forward: func() error {
 				return c.createApp(d, meta, d.Get("started").(bool), true)
 			},
-			ReversePrevious: func() error {
-				client.Applications().Delete(d.Id())
-				return c.renameApplication(client, origAppGuid, origAppName)
-			},
+			Reverse:         deleteNewApp,
+			ReversePrevious: deleteNewApp,
 		},
+		c.smokeTestAction(d, meta),
 		{
+			Name: "retire old app",
 			Forward: func() error {
-				return client.Applications().Delete(origAppGuid)
+				return c.retireApp(d, meta, origAppGuid)
 			},
 		},
 	}
 }
 func (c CfAppsResource) rewindActionsBgRestage(d *schema.ResourceData, meta interface{}) []rewind.Action {
 	client := meta.(cf_client.Client)
-	bm := c.MakeBitsManager(meta)
+	bm := c.MakeBitsManager(meta, c.fileFilter(d), c.overlay(d), d.Get("path_checksum").(string))
 	oldAppName, newAppName := d.GetChange("name")
 	origAppName := oldAppName.(string)
 	if origAppName == "" {
 		origAppName = newAppName.(string)
 	}
 	origAppGuid := d.Id()
-	defaultReverse := func() error {
-		client.Applications().Delete(d.Id())
-		return c.renameApplication(client, origAppGuid, origAppName)
-	}
+	deleteNewApp := c.deleteNewApp(d, client, origAppGuid)
 	return []rewind.Action{
+		c.renameVenerableAction(client, origAppGuid, origAppName),
 		{
-			Forward: func() error {
-				return c.renameApplication(client, origAppGuid, venerableAppName(origAppName))
-			},
-		},
-		{
+			Name: "create new app",
 			Forward: func() error {
 				return c.createApp(d, meta, false, false)
 			},
-			ReversePrevious: defaultReverse,
+			Reverse:         deleteNewApp,
+			ReversePrevious: deleteNewApp,
 		},
 		{
+			Name: "copy bits",
 			Forward: func() error {
 				return bm.CopyBits(origAppGuid, d.Id())
 			},
-			ReversePrevious: defaultReverse,
 		},
 		{
+			Name: "start new app",
 			Forward: func() error {
 				if !d.Get("started").(bool) {
 					return nil
 				}
-				return c.startApp(client, models.Application{ApplicationFields: models.ApplicationFields{GUID: d.Id()}})
+				policy, err := NewReadinessPolicy(d)
+				if err != nil {
+					return err
+				}
+				return c.startApp(client, models.Application{ApplicationFields: models.ApplicationFields{GUID: d.Id()}}, policy)
 			},
-			ReversePrevious: defaultReverse,
 		},
+		c.smokeTestAction(d, meta),
 		{
+			Name: "retire old app",
 			Forward: func() error {
-				return client.Applications().Delete(origAppGuid)
+				return c.retireApp(d, meta, origAppGuid)
 			},
 		},
 	}
 }
+func (c CfAppsResource) renameVenerableAction(client cf_client.Client, origAppGuid, origAppName string) rewind.Action {
+	return rewind.Action{
+		Name: "rename old app",
+		Forward: func() error {
+			return c.renameApplication(client, origAppGuid, venerableAppName(origAppName))
+		},
+		Reverse: func() error {
+			return c.renameApplication(client, origAppGuid, origAppName)
+		},
+	}
+}
+
+// deleteNewApp give a function which removes app created next to the original one
+// and gives back guid of original app to the resource
+func (c CfAppsResource) deleteNewApp(d *schema.ResourceData, client cf_client.Client, origAppGuid string) func() error {
+	return func() error {
+		if d.Id() == origAppGuid {
+			return nil
+		}
+		err := client.Applications().Delete(d.Id())
+		d.SetId(origAppGuid)
+		return err
+	}
+}
 func venerableAppName(appName string) string {
 	return fmt.Sprintf("%s-venerable", appName)
 }
@@ -330,12 +640,12 @@ func (c CfAppsResource) renameApplication(client cf_client.Client, appGuid strin
 	}
 	return nil
 }
-func (c CfAppsResource) restartApp(client cf_client.Client, a models.Application) error {
+func (c CfAppsResource) restartApp(client cf_client.Client, a models.Application, policy ReadinessPolicy) error {
 	err := c.stopApp(client, a)
 	if err != nil {
 		return err
 	}
-	err = c.startApp(client, a)
+	err = c.startApp(client, a, policy)
 	if err != nil {
 		return err
 	}
@@ -344,11 +654,22 @@ func (c CfAppsResource) restartApp(client cf_client.Client, a models.Application
 func (c CfAppsResource) IsRoutesUpdate(d *schema.ResourceData) bool {
 	return c.IsKeyUpdate(d, "routes")
 }
+func (c CfAppsResource) IsSettingsUpdate(d *schema.ResourceData) bool {
+	for schemaKey, _ := range c.Schema() {
+		if d.HasChange(schemaKey) && !toolbox.HasSliceAnyElements(settingsKeys, schemaKey) {
+			return false
+		}
+	}
+	return true
+}
 func (c CfAppsResource) IsKeyUpdate(d *schema.ResourceData, key string) bool {
 	if !d.HasChange(key) {
 		return false
 	}
 	for schemaKey, _ := range c.Schema() {
+		if toolbox.HasSliceAnyElements(settingsKeys, schemaKey) {
+			continue
+		}
 		if d.HasChange(schemaKey) && schemaKey != key {
 			return false
 		}
@@ -360,6 +681,9 @@ func (c CfAppsResource) IsScaleAndRename(d *schema.ResourceData) bool {
 		return false
 	}
 	for schemaKey, _ := range c.Schema() {
+		if toolbox.HasSliceAnyElements(settingsKeys, schemaKey) {
+			continue
+		}
 		if d.HasChange(schemaKey) && schemaKey != "instances" && schemaKey != "name" {
 			return false
 		}
@@ -372,14 +696,17 @@ func (c CfAppsResource) IsRenameUpdate(d *schema.ResourceData) bool {
 func (c CfAppsResource) IsScaleUpdate(d *schema.ResourceData) bool {
 	return c.IsKeyUpdate(d, "instances")
 }
-func (c CfAppsResource) startApp(client cf_client.Client, a models.Application) error {
+func (c CfAppsResource) startApp(client cf_client.Client, a models.Application, policy ReadinessPolicy) error {
+	stopLogs := c.StreamLogs(client, a)
+	defer stopLogs()
 	state := stateStarted
 	_, err := client.Applications().Update(a.GUID, models.AppParams{State: &state})
 	if err != nil {
 		return err
 	}
+	var app models.Application
 	err = common.PollingWithTimeout(func() (bool, error) {
-		app, err := client.Applications().GetApp(a.GUID)
+		app, err = client.Applications().GetApp(a.GUID)
 		if err != nil {
 			return true, err
 		}
@@ -390,30 +717,11 @@ func (c CfAppsResource) startApp(client cf_client.Client, a models.Application)
 			return true, fmt.Errorf("Staging failed for app %s", a.Name)
 		}
 		return false, nil
-	}, 5*time.Second, 15*time.Minute)
+	}, 5*time.Second, policy.Remaining())
 	if err != nil {
 		return c.createErrorFromLog(err, client, a)
 	}
-	err = common.Polling(func() (bool, error) {
-		appInstances, err := client.AppInstances().GetInstances(a.GUID)
-		if err != nil {
-			return true, err
-		}
-		if a.InstanceCount == 0 {
-			return true, nil
-		}
-		for i, instance := range appInstances {
-			if instance.State == models.InstanceStarting {
-				continue
-			}
-			if instance.State == models.InstanceRunning {
-				return true, nil
-			}
-			return true, fmt.Errorf("Instance %d failed with state %s for app %s", i, instance.State, a.Name)
-		}
-
-		return false, nil
-	}, 5*time.Second)
+	err = c.waitForInstances(client, app, policy)
 	if err != nil {
 		return c.createErrorFromLog(err, client, a)
 	}
@@ -509,12 +817,20 @@ func (c CfAppsResource) BindRoutes(client cf_client.Client, a models.Application
 	return nil
 }
 func (c CfAppsResource) SendBits(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(cf_client.Client)
-	bm := c.MakeBitsManager(meta)
+	if c.isDockerApp(d) {
+		// cloud controller pulls image itself, there is no bits to send
+		return nil
+	}
+	bm := c.MakeBitsManager(meta, c.fileFilter(d), c.overlay(d), d.Get("path_checksum").(string))
 	err := bm.Upload(d.Id(), d.Get("path").(string))
 	if err != nil {
 		return err
 	}
+	return c.updateSha1(d, meta)
+}
+func (c CfAppsResource) updateSha1(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(cf_client.Client)
+	bm := c.MakeBitsManager(meta, c.fileFilter(d), c.overlay(d), d.Get("path_checksum").(string))
 	localSha1, err := bm.GetSha1(d.Get("path").(string))
 	if err != nil {
 		return err
@@ -528,33 +844,163 @@ func (c CfAppsResource) SendBits(d *schema.ResourceData, meta interface{}) error
 	return nil
 }
 func (c CfAppsResource) IsBitsDiff(d *schema.ResourceData) bool {
-	return d.HasChange("bits_has_changed") || d.Get("bits_has_changed").(string) != ""
+	// bits_has_changed is deprecated but a change on it still forces a redeploy
+	return d.HasChange("path") ||
+		d.HasChange("path_sha1") ||
+		d.HasChange("remote_sha1") ||
+		d.HasChange("docker_digest") ||
+		d.HasChange("bits_has_changed")
 }
-func (c CfAppsResource) updateBitsDiff(d *schema.ResourceData, meta interface{}) error {
-	if d.Get("path").(string) == "" {
+
+// CustomizeDiff show in plan changes which can't be seen from configuration:
+// a previous app kept after its rollback window is flagged in previous_has_expired to be deleted,
+// a leftover venerable app is flagged in orphaned_venerable_id to be deleted
+// and a change on bits is shown on path_sha1, remote_sha1 or docker_digest
+func (c CfAppsResource) CustomizeDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if diff.Id() == "" {
 		return nil
 	}
+	if c.IsPreviousAppExpired(diff) {
+		log.Printf("[INFO] rollback window of previous version of app %s has passed", diff.Get("name").(string))
+		err := diff.SetNew("previous_has_expired", previousAppExpired)
+		if err != nil {
+			return err
+		}
+	}
+	err := c.customizeOrphanedVenerableDiff(diff, meta)
+	if err != nil {
+		return err
+	}
+	return c.customizeBitsDiff(diff, meta)
+}
+
+// customizeBitsDiff compare fingerprint of local bits and bits on cloud controller with the ones stored in state,
+// a change is shown on path_sha1, remote_sha1 or docker_digest in plan when bits must be redeployed
+func (c CfAppsResource) customizeBitsDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if diff.Get("docker_image").(string) != "" {
+		return c.customizeDockerDigestDiff(diff, meta)
+	}
+	path := diff.Get("path").(string)
+	if path == "" {
+		return nil
+	}
+	if diff.HasChange("path") {
+		err := diff.SetNewComputed("path_sha1")
+		if err != nil {
+			return err
+		}
+		return diff.SetNewComputed("remote_sha1")
+	}
 	client := meta.(cf_client.Client)
-	bm := c.MakeBitsManager(meta)
-	isDiffLocal, sha1Local, err := bm.IsDiff(d.Get("path").(string), d.Get("path_sha1").(string))
+	bm := c.MakeBitsManager(meta, c.fileFilter(diff), c.overlay(diff), diff.Get("path_checksum").(string))
+	isDiffLocal, sha1Local, err := bm.IsDiff(path, diff.Get("path_sha1").(string))
 	if err != nil {
 		return err
 	}
-	isDiffRmt, sha1Rmt, err := client.ApplicationBits().IsDiff(d.Id(), d.Get("remote_sha1").(string))
+	isDiffRmt, _, err := client.ApplicationBits().IsDiff(diff.Id(), diff.Get("remote_sha1").(string))
 	if err != nil {
 		return err
 	}
+	if isDiffLocal {
+		log.Printf("[INFO] bits of app %s have changed locally, new sha1 is %s", diff.Get("name").(string), sha1Local)
+		err = diff.SetNew("path_sha1", sha1Local)
+		if err != nil {
+			return err
+		}
+	}
 	if isDiffLocal || isDiffRmt {
-		d.Set("path_sha1", sha1Local)
-		d.Set("remote_sha1", sha1Rmt)
-		d.Set("bits_has_changed", "modified")
+		// remote sha1 is only known after bits has been uploaded
+		return diff.SetNewComputed("remote_sha1")
+	}
+	return nil
+}
+
+func (c CfAppsResource) isDockerApp(d *schema.ResourceData) bool {
+	return d.Get("docker_image").(string) != ""
+}
+func (c CfAppsResource) updateDockerCredentials(d *schema.ResourceData, meta interface{}) error {
+	username := d.Get("docker_username").(string)
+	if !c.isDockerApp(d) || (username == "" && !d.HasChange("docker_username")) {
 		return nil
 	}
-	d.Set("bits_has_changed", "")
+	client := meta.(cf_client.Client)
+	password, err := client.Decrypter().Decrypt(d.Get("docker_password").(string))
+	if err != nil {
+		return err
+	}
+	return client.DockerCredentials().Update(d.Id(), cf_client.DockerCredentials{
+		Username: username,
+		Password: password,
+	})
+}
+func (c CfAppsResource) resolveDockerDigest(meta interface{}, image, username, encryptedPassword string) (string, error) {
+	client := meta.(cf_client.Client)
+	password, err := client.Decrypter().Decrypt(encryptedPassword)
+	if err != nil {
+		return "", err
+	}
+	registry := dockerregistry.NewClient(client.Config().SkipInsecureSSL)
+	return registry.GetDigest(image, username, password)
+}
+
+// storeDockerDigest keep digest of the image which has been deployed, this is done only after a successful deployment
+// to not lose a change of digest if deployment failed
+func (c CfAppsResource) storeDockerDigest(d *schema.ResourceData, meta interface{}) error {
+	if !c.isDockerApp(d) || !d.Get("track_digest").(bool) {
+		d.Set("docker_digest", "")
+		return nil
+	}
+	digest, err := c.resolveDockerDigest(
+		meta,
+		d.Get("docker_image").(string),
+		d.Get("docker_username").(string),
+		d.Get("docker_password").(string),
+	)
+	if err != nil {
+		return err
+	}
+	d.Set("docker_digest", digest)
 	return nil
 }
+
+// customizeDockerDigestDiff show a change on docker_digest when tag of the docker image points to a new digest,
+// this will redeploy app which make cloud controller pull the new image
+func (c CfAppsResource) customizeDockerDigestDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if !diff.Get("track_digest").(bool) {
+		return nil
+	}
+	currentDigest := diff.Get("docker_digest").(string)
+	if currentDigest == "" {
+		// digest is stored after next deployment
+		return nil
+	}
+	digest, err := c.resolveDockerDigest(
+		meta,
+		diff.Get("docker_image").(string),
+		diff.Get("docker_username").(string),
+		diff.Get("docker_password").(string),
+	)
+	if err != nil {
+		return err
+	}
+	if currentDigest == digest {
+		return nil
+	}
+	log.Printf(
+		"[INFO] image %s of app %s has changed from digest %s to %s",
+		diff.Get("docker_image").(string),
+		diff.Get("name").(string),
+		currentDigest,
+		digest,
+	)
+	return diff.SetNew("docker_digest", digest)
+}
 func (c CfAppsResource) Read(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(cf_client.Client)
+	err := c.ReportInterruptedDeployment(d, meta)
+	if err != nil {
+		return err
+	}
 
 	app, err := client.Finder().GetAppFromCf(d.Id())
 	if err != nil {
@@ -603,13 +1049,21 @@ func (c CfAppsResource) Read(d *schema.ResourceData, meta interface{}) error {
 		schemaServices.Add(binding.ServiceInstanceGUID)
 	}
 	d.Set("services", schemaServices)
-	return c.updateBitsDiff(d, meta)
+	return c.readPreviousApp(d, meta)
 }
 func (c CfAppsResource) Update(d *schema.ResourceData, meta interface{}) error {
-	return c.createOrUpdate(d, meta)
+	err := c.createOrUpdate(d, meta)
+	if err != nil {
+		return err
+	}
+	return c.storeDockerDigest(d, meta)
 }
 func (c CfAppsResource) Delete(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(cf_client.Client)
+	err := c.deletePreviousApp(d, meta)
+	if err != nil {
+		return err
+	}
 	return client.Applications().Delete(d.Id())
 }
 func (c CfAppsResource) existsWithoutSpaceId(d *schema.ResourceData, meta interface{}) (bool, error) {
@@ -720,6 +1174,23 @@ func (c CfAppsResource) Schema() map[string]*schema.Schema {
 			Optional: true,
 			ForceNew: true,
 		},
+		"docker_username": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"docker_password": &schema.Schema{
+			Type:      schema.TypeString,
+			Optional:  true,
+			Sensitive: true,
+		},
+		"track_digest": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"docker_digest": &schema.Schema{
+			Type:     schema.TypeString,
+			Computed: true,
+		},
 		"diego": &schema.Schema{
 			Type:     schema.TypeBool,
 			Optional: true,
@@ -759,14 +1230,97 @@ func (c CfAppsResource) Schema() map[string]*schema.Schema {
 			Type:     schema.TypeBool,
 			Optional: true,
 		},
+		"rolling_restart": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
 		"no_blue_green_deploy": &schema.Schema{
 			Type:     schema.TypeBool,
 			Optional: true,
 		},
+		"readiness":  readinessSchema(),
+		"smoke_test": smokeTestSchema(),
+		"canary":     canarySchema(),
+		"keep_previous_for": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validateDuration,
+		},
+		"rollback": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"previous_app_id": &schema.Schema{
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"previous_expires_at": &schema.Schema{
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"previous_has_expired": &schema.Schema{
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"orphaned_venerable_id": &schema.Schema{
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"deployment_strategy": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+			ValidateFunc: func(elem interface{}, index string) ([]string, []error) {
+				strategy := elem.(string)
+				if strategy == "" || toolbox.HasSliceAnyElements(validDeploymentStrategies, strategy) {
+					return make([]string, 0), make([]error, 0)
+				}
+				errMsg := fmt.Sprintf(
+					"Deployment strategy '%s' is not valid, it must be one of %s",
+					strategy,
+					strings.Join(validDeploymentStrategies, ", "),
+				)
+				return make([]string, 0), []error{goerrors.New(errMsg)}
+			},
+		},
 		"path": &schema.Schema{
 			Type:     schema.TypeString,
 			Required: true,
 		},
+		"path_checksum": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validatePathChecksum,
+		},
+		"excludes": &schema.Schema{
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem:     &schema.Schema{Type: schema.TypeString},
+		},
+		"includes": &schema.Schema{
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem:     &schema.Schema{Type: schema.TypeString},
+		},
+		"file": &schema.Schema{
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"destination": &schema.Schema{
+						Type:     schema.TypeString,
+						Required: true,
+					},
+					"content": &schema.Schema{
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"source": &schema.Schema{
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+				},
+			},
+		},
 		"path_sha1": &schema.Schema{
 			Type:     schema.TypeString,
 			Computed: true,
@@ -776,8 +1330,9 @@ func (c CfAppsResource) Schema() map[string]*schema.Schema {
 			Computed: true,
 		},
 		"bits_has_changed": &schema.Schema{
-			Type:     schema.TypeString,
-			Optional: true,
+			Type:       schema.TypeString,
+			Optional:   true,
+			Deprecated: "Bits changes are now detected during plan and shown on path_sha1, remote_sha1 or docker_digest, this attribute can be removed",
 		},
 	}
 }
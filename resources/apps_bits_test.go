@@ -0,0 +1,98 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("CfAppsResource bits diff", func() {
+	var resource *schema.Resource
+	var fakeClient *fake_cf_client.FakeCfClient
+	var meta interface{}
+	var appPath string
+	var pathSha1 string
+	resourceConfig := func(path string) *terraform.ResourceConfig {
+		rawConfig, err := config.NewRawConfig(map[string]interface{}{
+			"name":     "my-app",
+			"space_id": "space-guid",
+			"path":     path,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return terraform.NewResourceConfig(rawConfig)
+	}
+	state := func(path, pathSha1, remoteSha1 string) *terraform.InstanceState {
+		appState := &terraform.InstanceState{ID: "app-guid"}
+		resourceData := resource.Data(appState)
+		resourceData.Set("name", "my-app")
+		resourceData.Set("space_id", "space-guid")
+		resourceData.Set("path", path)
+		resourceData.Set("path_sha1", pathSha1)
+		resourceData.Set("remote_sha1", remoteSha1)
+		return resourceData.State()
+	}
+	BeforeEach(func() {
+		resource = LoadCfResource(CfAppsResource{})
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		meta = fakeClient.GetClient()
+
+		var err error
+		appPath, err = ioutil.TempDir("", "app-bits")
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(appPath, "index.html"), []byte("hello"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+		pathSha1, err = CfAppsResource{}.MakeBitsManager(meta, bitsmanager.FileFilter{}, nil, "").GetSha1(appPath)
+		Expect(err).ToNot(HaveOccurred())
+		fakeClient.FakeApplicationBits().IsDiffReturns(false, "remote-sha1", nil)
+	})
+	AfterEach(func() {
+		os.RemoveAll(appPath)
+	})
+	It("should register diff customization of the resource", func() {
+		Expect(resource.CustomizeDiff).ToNot(BeNil())
+	})
+	It("should not plan bits change when bits are the same", func() {
+		diff, err := resource.Diff(state(appPath, pathSha1, "remote-sha1"), resourceConfig(appPath), meta)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Attributes).ToNot(HaveKey("path_sha1"))
+		Expect(diff.Attributes).ToNot(HaveKey("remote_sha1"))
+	})
+	It("should plan new sha1 when local bits changed", func() {
+		diff, err := resource.Diff(state(appPath, "old-sha1", "remote-sha1"), resourceConfig(appPath), meta)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Attributes).To(HaveKey("path_sha1"))
+		Expect(diff.Attributes["path_sha1"].Old).To(Equal("old-sha1"))
+		Expect(diff.Attributes["path_sha1"].New).To(Equal(pathSha1))
+		Expect(diff.Attributes).To(HaveKey("remote_sha1"))
+		Expect(diff.Attributes["remote_sha1"].NewComputed).To(BeTrue())
+	})
+	It("should plan a new remote sha1 when bits changed on cloud controller", func() {
+		fakeClient.FakeApplicationBits().IsDiffReturns(true, "another-sha1", nil)
+
+		diff, err := resource.Diff(state(appPath, pathSha1, "remote-sha1"), resourceConfig(appPath), meta)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Attributes).ToNot(HaveKey("path_sha1"))
+		Expect(diff.Attributes).To(HaveKey("remote_sha1"))
+		Expect(diff.Attributes["remote_sha1"].NewComputed).To(BeTrue())
+
+		appGuid, currentSha1 := fakeClient.FakeApplicationBits().IsDiffArgsForCall(0)
+		Expect(appGuid).To(Equal("app-guid"))
+		Expect(currentSha1).To(Equal("remote-sha1"))
+	})
+	It("should not compute fingerprint of a new path", func() {
+		diff, err := resource.Diff(state("/old/path", pathSha1, "remote-sha1"), resourceConfig(appPath), meta)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff.Attributes["path_sha1"].NewComputed).To(BeTrue())
+		Expect(diff.Attributes["remote_sha1"].NewComputed).To(BeTrue())
+		Expect(fakeClient.FakeApplicationBits().IsDiffCallCount()).To(Equal(0))
+	})
+})
@@ -0,0 +1,251 @@
+package resources
+
+import (
+	"code.cloudfoundry.org/cli/cf/models"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/rewind"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	deploymentStrategyCanary = "canary"
+	defaultCanaryCheckPeriod = 1 * time.Minute
+)
+
+var defaultCanarySteps = []int{25, 50, 100}
+
+// CanaryPolicy define how traffic is shifted from old app to new app,
+// new app starts with a few instances and is scaled up by steps (percentage of final instances)
+// while old app is scaled down, each step must stay healthy during check period.
+type CanaryPolicy struct {
+	Instances   int
+	CheckPeriod time.Duration
+	Steps       []int
+}
+
+func NewCanaryPolicy(d *schema.ResourceData) (CanaryPolicy, error) {
+	policy := CanaryPolicy{
+		Instances:   1,
+		CheckPeriod: defaultCanaryCheckPeriod,
+		Steps:       defaultCanarySteps,
+	}
+	canaryList := d.Get("canary").([]interface{})
+	if len(canaryList) == 0 || canaryList[0] == nil {
+		return policy, nil
+	}
+	canary := canaryList[0].(map[string]interface{})
+	policy.Instances = canary["instances"].(int)
+	var err error
+	if checkPeriod := canary["check_period"].(string); checkPeriod != "" {
+		policy.CheckPeriod, err = time.ParseDuration(checkPeriod)
+		if err != nil {
+			return policy, err
+		}
+	}
+	steps := make([]int, 0)
+	for _, step := range canary["steps"].([]interface{}) {
+		steps = append(steps, step.(int))
+	}
+	if len(steps) > 0 {
+		policy.Steps = steps
+	}
+	return policy, nil
+}
+
+// StepInstances give the number of instances of new app for each step, first one is the canary
+// and last one is always the total of instances
+func (p CanaryPolicy) StepInstances(total int) []int {
+	canaryInstances := p.Instances
+	if canaryInstances < 1 {
+		canaryInstances = 1
+	}
+	if canaryInstances > total {
+		canaryInstances = total
+	}
+	stepInstances := []int{canaryInstances}
+	current := canaryInstances
+	steps := append(make([]int, 0, len(p.Steps)+1), p.Steps...)
+	for _, step := range append(steps, 100) {
+		instances := int(math.Ceil(float64(total) * float64(step) / 100))
+		if instances > total {
+			instances = total
+		}
+		if instances <= current {
+			continue
+		}
+		stepInstances = append(stepInstances, instances)
+		current = instances
+	}
+	return stepInstances
+}
+func (c CfAppsResource) IsCanaryStrategy(d *schema.ResourceData) bool {
+	return d.Get("deployment_strategy").(string) == deploymentStrategyCanary
+}
+
+// updateCanary deploy a new app next to the old one on same routes and shift instances from old app to new app by steps.
+// A stopped app has no traffic to shift, blue-green deployment is used instead.
+func (c CfAppsResource) updateCanary(d *schema.ResourceData, meta interface{}, sendBits bool) error {
+	if !d.Get("started").(bool) || d.Get("instances").(int) == 0 {
+		if sendBits {
+			return c.updateBgDeploy(d, meta)
+		}
+		return c.updateBgRestage(d, meta)
+	}
+	actions, err := c.rewindActionsCanary(d, meta, sendBits)
+	if err == nil {
+		err = c.updateBgJournaled(d, meta, actions)
+	}
+	if err != nil {
+		return fmt.Errorf("Error when trying to update the app %s in canary mode: %s", d.Get("name").(string), err.Error())
+	}
+	return nil
+}
+func (c CfAppsResource) rewindActionsCanary(d *schema.ResourceData, meta interface{}, sendBits bool) ([]rewind.Action, error) {
+	client := meta.(cf_client.Client)
+	var bm bitsmanager.BitsManager
+	if !sendBits {
+		bm = c.MakeBitsManager(meta, c.fileFilter(d), c.overlay(d), d.Get("path_checksum").(string))
+	}
+	canaryPolicy, err := NewCanaryPolicy(d)
+	if err != nil {
+		return nil, err
+	}
+	readinessPolicy, err := NewReadinessPolicy(d)
+	if err != nil {
+		return nil, err
+	}
+	if readinessPolicy.StablePeriod < canaryPolicy.CheckPeriod {
+		readinessPolicy.StablePeriod = canaryPolicy.CheckPeriod
+	}
+	oldAppName, newAppName := d.GetChange("name")
+	origAppName := oldAppName.(string)
+	if origAppName == "" {
+		origAppName = newAppName.(string)
+	}
+	origAppGuid := d.Id()
+	origApp, err := client.Finder().GetAppFromCf(origAppGuid)
+	if err != nil {
+		return nil, err
+	}
+	origInstances := origApp.InstanceCount
+	totalInstances := d.Get("instances").(int)
+
+	deleteNewApp := c.deleteNewApp(d, client, origAppGuid)
+	newApp := func(instances int) models.Application {
+		app := models.Application{}
+		app.GUID = d.Id()
+		app.Name = d.Get("name").(string)
+		app.InstanceCount = instances
+		return app
+	}
+	stepInstances := canaryPolicy.StepInstances(totalInstances)
+	actions := []rewind.Action{
+		c.renameVenerableAction(client, origAppGuid, origAppName),
+		{
+			Name: "create new app",
+			Forward: func() error {
+				err := c.createApp(d, meta, false, sendBits)
+				if err != nil || sendBits {
+					return err
+				}
+				return bm.CopyBits(origAppGuid, d.Id())
+			},
+			Reverse:         deleteNewApp,
+			ReversePrevious: deleteNewApp,
+		},
+		{
+			Name: "start canary",
+			Forward: func() error {
+				log.Printf("[INFO] starting canary of app %s with %d instance(s)", d.Get("name").(string), stepInstances[0])
+				_, err := client.Applications().Update(d.Id(), models.AppParams{InstanceCount: &stepInstances[0]})
+				if err != nil {
+					return err
+				}
+				return c.startApp(client, newApp(stepInstances[0]), readinessPolicy)
+			},
+		},
+		c.smokeTestAction(d, meta),
+	}
+	for i, instances := range stepInstances {
+		instances := instances
+		if i > 0 {
+			actions = append(actions, rewind.Action{
+				Name: fmt.Sprintf("scale new app to %d instance(s)", instances),
+				Forward: func() error {
+					log.Printf("[INFO] scaling canary of app %s to %d/%d instance(s)", d.Get("name").(string), instances, totalInstances)
+					_, err := client.Applications().Update(d.Id(), models.AppParams{InstanceCount: &instances})
+					if err != nil {
+						return err
+					}
+					return c.waitForInstances(client, newApp(instances), readinessPolicy)
+				},
+			})
+		}
+		// old app is not scaled down on last step, it is deleted right after
+		if i == len(stepInstances)-1 || origInstances <= 1 {
+			continue
+		}
+		oldInstances := origInstances - int(math.Ceil(float64(origInstances)*float64(instances)/float64(totalInstances)))
+		if oldInstances < 1 {
+			oldInstances = 1
+		}
+		actions = append(actions, rewind.Action{
+			Name: fmt.Sprintf("scale old app to %d instance(s)", oldInstances),
+			Forward: func() error {
+				_, err := client.Applications().Update(origAppGuid, models.AppParams{InstanceCount: &oldInstances})
+				return err
+			},
+			Reverse: func() error {
+				_, err := client.Applications().Update(origAppGuid, models.AppParams{InstanceCount: &origInstances})
+				return err
+			},
+		})
+	}
+	return append(actions, rewind.Action{
+		Name: "retire old app",
+		Forward: func() error {
+			return c.retireApp(d, meta, origAppGuid)
+		},
+	}), nil
+}
+func canarySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"instances": &schema.Schema{
+					Type:     schema.TypeInt,
+					Optional: true,
+					Default:  1,
+				},
+				"check_period": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "1m",
+					ValidateFunc: validateDuration,
+				},
+				"steps": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeInt,
+						ValidateFunc: func(elem interface{}, index string) ([]string, []error) {
+							step := elem.(int)
+							if step < 1 || step > 100 {
+								return make([]string, 0), []error{fmt.Errorf("%s must be a percentage between 1 and 100", index)}
+							}
+							return make([]string, 0), make([]error, 0)
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,239 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"code.cloudfoundry.org/cli/cf/models"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"time"
+)
+
+var _ = Describe("CanaryPolicy", func() {
+	Describe("NewCanaryPolicy", func() {
+		It("should give default policy when canary is not set", func() {
+			resourceData := LoadCfResource(CfAppsResource{}).Data(&terraform.InstanceState{})
+
+			policy, err := NewCanaryPolicy(resourceData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(policy).To(Equal(CanaryPolicy{
+				Instances:   1,
+				CheckPeriod: time.Minute,
+				Steps:       []int{25, 50, 100},
+			}))
+		})
+		It("should load canary from schema", func() {
+			resourceData := LoadCfResource(CfAppsResource{}).Data(&terraform.InstanceState{})
+			err := resourceData.Set("canary", []interface{}{
+				map[string]interface{}{
+					"instances":    2,
+					"check_period": "30s",
+					"steps":        []interface{}{10, 50},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			policy, err := NewCanaryPolicy(resourceData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(policy).To(Equal(CanaryPolicy{
+				Instances:   2,
+				CheckPeriod: 30 * time.Second,
+				Steps:       []int{10, 50},
+			}))
+		})
+	})
+	Describe("StepInstances", func() {
+		It("should start with canary instances and finish with all instances", func() {
+			policy := CanaryPolicy{Instances: 1, Steps: []int{25, 50, 100}}
+			Expect(policy.StepInstances(10)).To(Equal([]int{1, 3, 5, 10}))
+		})
+		It("should always finish with all instances even if last step is not 100%", func() {
+			policy := CanaryPolicy{Instances: 2, Steps: []int{50}}
+			Expect(policy.StepInstances(8)).To(Equal([]int{2, 4, 8}))
+		})
+		It("should skip steps which don't add instances", func() {
+			policy := CanaryPolicy{Instances: 1, Steps: []int{10, 20, 50}}
+			Expect(policy.StepInstances(2)).To(Equal([]int{1, 2}))
+		})
+		It("should never run more canary instances than total", func() {
+			policy := CanaryPolicy{Instances: 5}
+			Expect(policy.StepInstances(3)).To(Equal([]int{3}))
+		})
+	})
+})
+
+var _ = Describe("CfAppsResource canary deployment", func() {
+	var fakeClient *fake_cf_client.FakeCfClient
+	var meta interface{}
+	var resource *schema.Resource
+	var state *terraform.InstanceState
+	var diff *terraform.InstanceDiff
+	// calls made to cloud controller in order
+	var calls []string
+	// instances of each app, new app instances are running after startingPolls polls unless they crash
+	var instanceCounts map[string]int
+	var startingPolls int
+	var crashAt int
+	update := func() (*terraform.InstanceState, error) {
+		return resource.Apply(state, diff, meta)
+	}
+	BeforeEach(func() {
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		meta = fakeClient.GetClient()
+		resource = LoadCfResource(CfAppsResource{})
+		state = &terraform.InstanceState{
+			ID: "orig-guid",
+			Attributes: map[string]string{
+				"name":                      "my-app",
+				"space_id":                  "space-guid",
+				"stack_id":                  "stack-guid",
+				"memory":                    "512M",
+				"disk_quota":                "1G",
+				"instances":                 "4",
+				"started":                   "true",
+				"deployment_strategy":       "canary",
+				"command":                   "old-command",
+				"canary.#":                  "1",
+				"canary.0.instances":        "1",
+				"canary.0.check_period":     "0s",
+				"canary.0.steps.#":          "1",
+				"canary.0.steps.0":          "50",
+				"readiness.#":               "1",
+				"readiness.0.stable_period": "0s",
+			},
+		}
+		// a change of command restages bits of old app in the new one
+		diff = &terraform.InstanceDiff{Attributes: map[string]*terraform.ResourceAttrDiff{
+			"command": {Old: "old-command", New: "new-command"},
+		}}
+
+		calls = make([]string, 0)
+		instanceCounts = map[string]int{"orig-guid": 4}
+		startingPolls = 0
+		crashAt = 0
+		origApp := models.Application{}
+		origApp.GUID = "orig-guid"
+		origApp.Name = "my-app"
+		origApp.InstanceCount = 4
+		fakeClient.FakeFinder().GetAppFromCfReturns(origApp, nil)
+		fakeClient.FakeApplications().CreateStub = func(params models.AppParams) (models.Application, error) {
+			calls = append(calls, fmt.Sprintf("create %s", *params.Name))
+			app := models.Application{}
+			app.GUID = "new-guid"
+			app.Name = *params.Name
+			return app, nil
+		}
+		fakeClient.FakeApplications().UpdateStub = func(appGuid string, params models.AppParams) (models.Application, error) {
+			switch {
+			case params.Name != nil:
+				calls = append(calls, fmt.Sprintf("rename %s to %s", appGuid, *params.Name))
+			case params.InstanceCount != nil:
+				calls = append(calls, fmt.Sprintf("scale %s to %d", appGuid, *params.InstanceCount))
+				instanceCounts[appGuid] = *params.InstanceCount
+			case params.State != nil:
+				calls = append(calls, fmt.Sprintf("%s %s", *params.State, appGuid))
+			}
+			app := models.Application{}
+			app.GUID = appGuid
+			return app, nil
+		}
+		fakeClient.FakeApplications().DeleteStub = func(appGuid string) error {
+			calls = append(calls, fmt.Sprintf("delete %s", appGuid))
+			return nil
+		}
+		fakeClient.FakeApplications().GetAppStub = func(appGuid string) (models.Application, error) {
+			app := models.Application{}
+			app.GUID = appGuid
+			app.Name = "my-app"
+			app.PackageState = "STAGED"
+			app.InstanceCount = instanceCounts[appGuid]
+			return app, nil
+		}
+		polls := 0
+		fakeClient.FakeAppInstances().GetInstancesStub = func(appGuid string) ([]models.AppInstanceFields, error) {
+			polls++
+			state := models.InstanceRunning
+			if polls <= startingPolls {
+				state = models.InstanceStarting
+			}
+			if crashAt > 0 && instanceCounts[appGuid] >= crashAt {
+				state = models.InstanceCrashed
+			}
+			instances := make([]models.AppInstanceFields, instanceCounts[appGuid])
+			for i := range instances {
+				instances[i] = models.AppInstanceFields{State: state, Since: time.Now()}
+			}
+			return instances, nil
+		}
+	})
+	It("should start a canary, shift instances by steps and retire old app", func() {
+		newState, err := update()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(newState.ID).To(Equal("new-guid"))
+
+		Expect(calls).To(Equal([]string{
+			"rename orig-guid to my-app-venerable",
+			"create my-app",
+			"scale new-guid to 1",
+			"STARTED new-guid",
+			"scale orig-guid to 3",
+			"scale new-guid to 2",
+			"scale orig-guid to 2",
+			"scale new-guid to 4",
+			"delete orig-guid",
+		}))
+		origGuid, newGuid := fakeClient.FakeApplicationBits().CopyBitsArgsForCall(0)
+		Expect(origGuid).To(Equal("orig-guid"))
+		Expect(newGuid).To(Equal("new-guid"))
+	})
+	It("should wait that canary is ready before promoting it", func() {
+		startingPolls = 1
+
+		_, err := update()
+		Expect(err).ToNot(HaveOccurred())
+		// canary is seen starting, then running before next step
+		Expect(fakeClient.FakeAppInstances().GetInstancesCallCount()).To(BeNumerically(">=", 4))
+		Expect(calls).To(ContainElement("scale new-guid to 4"))
+	})
+	It("should roll back when canary crashes", func() {
+		crashAt = 1
+
+		newState, err := update()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("in canary mode"))
+		Expect(err.Error()).To(ContainSubstring("crashed"))
+		Expect(newState.ID).To(Equal("orig-guid"))
+
+		Expect(calls).To(Equal([]string{
+			"rename orig-guid to my-app-venerable",
+			"create my-app",
+			"scale new-guid to 1",
+			"STARTED new-guid",
+			"delete new-guid",
+			"rename orig-guid to my-app",
+		}))
+	})
+	It("should give back its instances to old app when a step fails", func() {
+		crashAt = 2
+
+		newState, err := update()
+		Expect(err).To(HaveOccurred())
+		Expect(newState.ID).To(Equal("orig-guid"))
+
+		Expect(calls).To(Equal([]string{
+			"rename orig-guid to my-app-venerable",
+			"create my-app",
+			"scale new-guid to 1",
+			"STARTED new-guid",
+			"scale orig-guid to 3",
+			"scale new-guid to 2",
+			"scale orig-guid to 4",
+			"delete new-guid",
+			"rename orig-guid to my-app",
+		}))
+	})
+})
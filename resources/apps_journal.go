@@ -0,0 +1,326 @@
+package resources
+
+import (
+	"code.cloudfoundry.org/cli/cf/errors"
+	"code.cloudfoundry.org/cli/cf/models"
+	"encoding/json"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/rewind"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const rewindFailureMessage = "Oh no. Something's gone wrong. I've tried to roll back but you should check to see if everything is OK."
+
+// DeploymentJournal record progress of a deployment which creates a new app next to the original one
+type DeploymentJournal struct {
+	OrigAppGuid    string    `json:"orig_app_guid"`
+	OrigAppName    string    `json:"orig_app_name"`
+	OrigInstances  int       `json:"orig_instances"`
+	SpaceGuid      string    `json:"space_guid"`
+	NewAppGuid     string    `json:"new_app_guid"`
+	Steps          int       `json:"steps"`
+	CompletedSteps []string  `json:"completed_steps"`
+	StartedAt      time.Time `json:"started_at"`
+}
+
+// ReadyToFinish is true when only the retirement of the original app was left to do
+func (j DeploymentJournal) ReadyToFinish() bool {
+	return j.NewAppGuid != "" && len(j.CompletedSteps) >= j.Steps-1
+}
+
+// JournalStore keep deployment journals as json files named by guid of original app
+type JournalStore struct {
+	Dir string
+}
+
+func (s JournalStore) path(appGuid string) string {
+	return filepath.Join(s.Dir, appGuid+".json")
+}
+func (s JournalStore) Save(journal DeploymentJournal) error {
+	err := os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	// journal is written in a temporary file first to never leave a truncated journal
+	tmpPath := s.path(journal.OrigAppGuid) + ".tmp"
+	err = ioutil.WriteFile(tmpPath, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path(journal.OrigAppGuid))
+}
+
+// Load give journal of a deployment involving this app (as original or as new app), nil is given if there is none
+func (s JournalStore) Load(appGuid string) (*DeploymentJournal, error) {
+	return s.find(func(journal DeploymentJournal) bool {
+		return journal.OrigAppGuid == appGuid || (journal.NewAppGuid != "" && journal.NewAppGuid == appGuid)
+	})
+}
+
+// LoadByName give journal of a deployment of an app by its name in a space, nil is given if there is none
+func (s JournalStore) LoadByName(appName, spaceGuid string) (*DeploymentJournal, error) {
+	return s.find(func(journal DeploymentJournal) bool {
+		return journal.OrigAppName == appName && journal.SpaceGuid == spaceGuid
+	})
+}
+func (s JournalStore) find(match func(journal DeploymentJournal) bool) (*DeploymentJournal, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(s.Dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var journal DeploymentJournal
+		err = json.Unmarshal(b, &journal)
+		if err != nil {
+			log.Printf("[WARN] skipping invalid deployment journal %s: %s", file.Name(), err.Error())
+			continue
+		}
+		if match(journal) {
+			return &journal, nil
+		}
+	}
+	return nil, nil
+}
+func (s JournalStore) Remove(journal DeploymentJournal) error {
+	err := os.Remove(s.path(journal.OrigAppGuid))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+func (c CfAppsResource) journalStore(meta interface{}) JournalStore {
+	client := meta.(cf_client.Client)
+	return JournalStore{Dir: client.Config().JournalDir}
+}
+
+// updateBgJournaled run actions of a deployment creating a new app and record each completed step in a journal.
+// Journal is kept when rewind failed to let next run recover the deployment.
+func (c CfAppsResource) updateBgJournaled(d *schema.ResourceData, meta interface{}, actionList []rewind.Action) error {
+	client := meta.(cf_client.Client)
+	store := c.journalStore(meta)
+	if store.Dir == "" {
+		return c.updateBg(actionList)
+	}
+	origApp, err := client.Finder().GetAppFromCf(d.Id())
+	if err != nil {
+		return err
+	}
+	journal := DeploymentJournal{
+		OrigAppGuid:    d.Id(),
+		OrigAppName:    origApp.Name,
+		OrigInstances:  origApp.InstanceCount,
+		SpaceGuid:      origApp.SpaceGUID,
+		Steps:          len(actionList),
+		CompletedSteps: make([]string, 0),
+		StartedAt:      time.Now().UTC(),
+	}
+	saveJournal := func() {
+		err := store.Save(journal)
+		if err != nil {
+			log.Printf("[WARN] cannot record deployment journal of app %s: %s", journal.OrigAppName, err.Error())
+		}
+	}
+	saveJournal()
+	actions := rewind.Actions{
+		Actions:              actionList,
+		RewindFailureMessage: rewindFailureMessage,
+		OnStepCompleted: func(step int, action rewind.Action) {
+			journal.CompletedSteps = append(journal.CompletedSteps, action.Name)
+			if d.Id() != journal.OrigAppGuid {
+				journal.NewAppGuid = d.Id()
+			}
+			saveJournal()
+		},
+	}
+	err = actions.Execute()
+	if rewindErr, ok := err.(*rewind.Error); ok && len(rewindErr.RewindErrors) > 0 {
+		log.Printf("[WARN] deployment journal of app %s is kept to recover deployment on next run", journal.OrigAppName)
+		return err
+	}
+	removeErr := store.Remove(journal)
+	if removeErr != nil {
+		log.Printf("[WARN] cannot remove deployment journal of app %s: %s", journal.OrigAppName, removeErr.Error())
+	}
+	return err
+}
+
+// RecoverDeployment finish or roll back a deployment which has been interrupted (e.g.: terraform was killed),
+// it is finished only if all steps but the retirement of original app were completed.
+// When resource has no id yet, journal is searched by name of the app in its space.
+// It changes apps on Cloud Foundry and must only be called on apply.
+func (c CfAppsResource) RecoverDeployment(d *schema.ResourceData, meta interface{}) error {
+	store := c.journalStore(meta)
+	if store.Dir == "" {
+		return nil
+	}
+	var journal *DeploymentJournal
+	var err error
+	if d.Id() == "" {
+		journal, err = store.LoadByName(d.Get("name").(string), d.Get("space_id").(string))
+	} else {
+		journal, err = store.Load(d.Id())
+	}
+	if err != nil || journal == nil {
+		return err
+	}
+	client := meta.(cf_client.Client)
+	newAppGuid := journal.NewAppGuid
+	if newAppGuid == "" {
+		// deployment may have been interrupted while new app was created
+		app, err := client.Applications().ReadFromSpace(journal.OrigAppName, journal.SpaceGuid)
+		if _, ok := err.(*errors.ModelNotFoundError); err != nil && !ok {
+			return err
+		}
+		if err == nil && app.GUID != journal.OrigAppGuid {
+			newAppGuid = app.GUID
+		}
+	}
+	origApp, err := client.Finder().GetAppFromCf(journal.OrigAppGuid)
+	if err != nil {
+		return err
+	}
+	var newApp models.Application
+	if newAppGuid != "" {
+		newApp, err = client.Finder().GetAppFromCf(newAppGuid)
+		if err != nil {
+			return err
+		}
+	}
+	if journal.ReadyToFinish() && newApp.GUID != "" {
+		log.Printf("[INFO] finishing interrupted deployment of app %s started at %s", journal.OrigAppName, journal.StartedAt)
+		d.SetId(newApp.GUID)
+		if origApp.GUID != "" {
+			err = c.retireApp(d, meta, origApp.GUID)
+			if err != nil {
+				return err
+			}
+		}
+		return store.Remove(*journal)
+	}
+	log.Printf("[INFO] rolling back interrupted deployment of app %s started at %s", journal.OrigAppName, journal.StartedAt)
+	if newApp.GUID != "" {
+		err = client.Applications().Delete(newApp.GUID)
+		if err != nil {
+			return err
+		}
+	}
+	if origApp.GUID != "" {
+		err = c.renameApplication(client, origApp.GUID, journal.OrigAppName)
+		if err != nil {
+			return err
+		}
+		if journal.OrigInstances > 0 && origApp.InstanceCount != journal.OrigInstances {
+			_, err = client.Applications().Update(origApp.GUID, models.AppParams{InstanceCount: &journal.OrigInstances})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	d.SetId(journal.OrigAppGuid)
+	return store.Remove(*journal)
+}
+
+// ReportInterruptedDeployment warn about a deployment of the app which has been interrupted, nothing is changed:
+// deployment is finished or rolled back on next apply (app is seen renamed <name>-venerable or removed in plan).
+func (c CfAppsResource) ReportInterruptedDeployment(d *schema.ResourceData, meta interface{}) error {
+	store := c.journalStore(meta)
+	if store.Dir == "" {
+		return nil
+	}
+	journal, err := store.Load(d.Id())
+	if err != nil || journal == nil {
+		return err
+	}
+	log.Printf(
+		"[WARN] deployment of app %s started at %s has been interrupted, it will be finished or rolled back on next apply",
+		journal.OrigAppName,
+		journal.StartedAt,
+	)
+	return nil
+}
+
+// customizeOrphanedVenerableDiff flag an app named <name>-venerable in space of the app when it is not the app of the resource,
+// it is a leftover of an interrupted deployment (even when its journal has already been removed) and is deleted on next apply.
+func (c CfAppsResource) customizeOrphanedVenerableDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	orphanGuid, err := c.findOrphanedVenerable(diff, meta)
+	if err != nil {
+		return err
+	}
+	if orphanGuid == "" {
+		return nil
+	}
+	log.Printf("[WARN] app %s (%s) is a leftover of an interrupted deployment, it will be deleted on next apply", venerableAppName(diff.Get("name").(string)), orphanGuid)
+	return diff.SetNew("orphaned_venerable_id", orphanGuid)
+}
+
+// findOrphanedVenerable give guid of app <name>-venerable when it is not the app of the resource, d can be a ResourceData or a ResourceDiff
+func (c CfAppsResource) findOrphanedVenerable(d interface {
+	Get(string) interface{}
+	Id() string
+}, meta interface{}) (string, error) {
+	if c.journalStore(meta).Dir == "" {
+		return "", nil
+	}
+	client := meta.(cf_client.Client)
+	app, err := client.Applications().ReadFromSpace(venerableAppName(d.Get("name").(string)), d.Get("space_id").(string))
+	if _, ok := err.(*errors.ModelNotFoundError); ok {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if app.GUID == d.Id() {
+		return "", nil
+	}
+	return app.GUID, nil
+}
+
+// DeleteOrphanedVenerable delete venerable app flagged during plan and remove journal of its deployment if any,
+// it is checked again that app is still <name>-venerable and not the app of the resource.
+func (c CfAppsResource) DeleteOrphanedVenerable(d *schema.ResourceData, meta interface{}) error {
+	orphanGuid := d.Get("orphaned_venerable_id").(string)
+	if orphanGuid == "" || orphanGuid == d.Id() {
+		return nil
+	}
+	d.Set("orphaned_venerable_id", "")
+	currentGuid, err := c.findOrphanedVenerable(d, meta)
+	if err != nil {
+		return err
+	}
+	if currentGuid != orphanGuid {
+		log.Printf("[WARN] app %s is not named %s anymore, it is not deleted", orphanGuid, venerableAppName(d.Get("name").(string)))
+		return nil
+	}
+	client := meta.(cf_client.Client)
+	log.Printf("[INFO] deleting app %s (%s) left by an interrupted deployment", venerableAppName(d.Get("name").(string)), orphanGuid)
+	err = client.Applications().Delete(orphanGuid)
+	if _, ok := err.(*errors.ModelNotFoundError); err != nil && !ok {
+		return err
+	}
+	store := c.journalStore(meta)
+	journal, err := store.Load(orphanGuid)
+	if err != nil || journal == nil || journal.OrigAppGuid != orphanGuid {
+		return err
+	}
+	return store.Remove(*journal)
+}
@@ -0,0 +1,297 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"code.cloudfoundry.org/cli/cf/errors"
+	"code.cloudfoundry.org/cli/cf/models"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("JournalStore", func() {
+	var store JournalStore
+	var journal DeploymentJournal
+	BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "journal")
+		Expect(err).ToNot(HaveOccurred())
+		store = JournalStore{Dir: filepath.Join(dir, "journal")}
+		journal = DeploymentJournal{
+			OrigAppGuid:    "orig-guid",
+			OrigAppName:    "my-app",
+			OrigInstances:  2,
+			SpaceGuid:      "space-guid",
+			Steps:          4,
+			CompletedSteps: []string{"rename old app"},
+			StartedAt:      time.Date(2017, 11, 2, 10, 0, 0, 0, time.UTC),
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(filepath.Dir(store.Dir))
+	})
+	It("should give no journal when directory doesn't exist", func() {
+		loaded, err := store.Load("orig-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded).To(BeNil())
+	})
+	It("should load a saved journal by guid of original app or of new app", func() {
+		Expect(store.Save(journal)).To(Succeed())
+
+		loaded, err := store.Load("orig-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*loaded).To(Equal(journal))
+
+		loaded, err = store.Load("new-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded).To(BeNil())
+
+		journal.NewAppGuid = "new-guid"
+		Expect(store.Save(journal)).To(Succeed())
+		loaded, err = store.Load("new-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded.OrigAppGuid).To(Equal("orig-guid"))
+	})
+	It("should load a saved journal by name of the app in its space", func() {
+		Expect(store.Save(journal)).To(Succeed())
+
+		loaded, err := store.LoadByName("my-app", "space-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*loaded).To(Equal(journal))
+
+		loaded, err = store.LoadByName("my-app", "other-space-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded).To(BeNil())
+	})
+	It("should not give journal anymore when removed", func() {
+		Expect(store.Save(journal)).To(Succeed())
+		Expect(store.Remove(journal)).To(Succeed())
+
+		loaded, err := store.Load("orig-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(loaded).To(BeNil())
+		Expect(store.Remove(journal)).To(Succeed())
+	})
+	Describe("DeploymentJournal", func() {
+		It("should be ready to finish only when retirement of original app is the only step left", func() {
+			Expect(journal.ReadyToFinish()).To(BeFalse())
+
+			journal.NewAppGuid = "new-guid"
+			journal.CompletedSteps = []string{"rename old app", "create new app"}
+			Expect(journal.ReadyToFinish()).To(BeFalse())
+
+			journal.CompletedSteps = append(journal.CompletedSteps, "smoke test")
+			Expect(journal.ReadyToFinish()).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("CfAppsResource deployment journal", func() {
+	var fakeClient *fake_cf_client.FakeCfClient
+	var meta interface{}
+	var store JournalStore
+	var journal DeploymentJournal
+	appResource := CfAppsResource{}
+	resourceData := func(id, orphanedVenerableId string) *terraform.InstanceState {
+		return &terraform.InstanceState{
+			ID: id,
+			Attributes: map[string]string{
+				"name":                  "my-app",
+				"space_id":              "space-guid",
+				"stack_id":              "stack-guid",
+				"orphaned_venerable_id": orphanedVenerableId,
+			},
+		}
+	}
+	plan := func(id string) *terraform.InstanceDiff {
+		rawConfig, err := config.NewRawConfig(map[string]interface{}{
+			"name":     "my-app",
+			"space_id": "space-guid",
+			"stack_id": "stack-guid",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		diff, err := LoadCfResource(appResource).Diff(resourceData(id, ""), terraform.NewResourceConfig(rawConfig), meta)
+		Expect(err).ToNot(HaveOccurred())
+		return diff
+	}
+	orphanedVenerableId := func(diff *terraform.InstanceDiff) string {
+		if diff == nil || diff.Attributes["orphaned_venerable_id"] == nil {
+			return ""
+		}
+		return diff.Attributes["orphaned_venerable_id"].New
+	}
+	BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "journal")
+		Expect(err).ToNot(HaveOccurred())
+		store = JournalStore{Dir: dir}
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		fakeClient.SetConfig(cf_client.Config{JournalDir: dir})
+		meta = fakeClient.GetClient()
+		journal = DeploymentJournal{
+			OrigAppGuid:    "venerable-guid",
+			OrigAppName:    "my-app",
+			OrigInstances:  2,
+			SpaceGuid:      "space-guid",
+			NewAppGuid:     "new-guid",
+			Steps:          4,
+			CompletedSteps: []string{"rename old app", "create new app"},
+			StartedAt:      time.Date(2017, 11, 2, 10, 0, 0, 0, time.UTC),
+		}
+		fakeClient.FakeApplications().ReadFromSpaceReturns(models.Application{
+			ApplicationFields: models.ApplicationFields{GUID: "venerable-guid", Name: "my-app-venerable"},
+		}, nil)
+	})
+	AfterEach(func() {
+		os.RemoveAll(store.Dir)
+	})
+	Describe("orphaned venerable app", func() {
+		It("should flag venerable app in plan when it is not the app of the resource", func() {
+			diff := plan("new-guid")
+			Expect(orphanedVenerableId(diff)).To(Equal("venerable-guid"))
+
+			name, spaceGuid := fakeClient.FakeApplications().ReadFromSpaceArgsForCall(0)
+			Expect(name).To(Equal("my-app-venerable"))
+			Expect(spaceGuid).To(Equal("space-guid"))
+		})
+		It("should not flag venerable app when it is the app of the resource", func() {
+			Expect(orphanedVenerableId(plan("venerable-guid"))).To(BeEmpty())
+		})
+		It("should not flag anything when there is no venerable app", func() {
+			fakeClient.FakeApplications().ReadFromSpaceReturns(models.Application{}, errors.NewModelNotFoundError("app", "my-app-venerable"))
+			Expect(orphanedVenerableId(plan("new-guid"))).To(BeEmpty())
+		})
+		It("should not flag anything when journal is disabled", func() {
+			fakeClient.SetConfig(cf_client.Config{})
+			Expect(orphanedVenerableId(plan("new-guid"))).To(BeEmpty())
+			Expect(fakeClient.FakeApplications().ReadFromSpaceCallCount()).To(Equal(0))
+		})
+		It("should still flag venerable app once an interrupted deployment has been recovered", func() {
+			fakeClient.FakeFinder().GetAppFromCfStub = func(appGuid string) (models.Application, error) {
+				return models.Application{ApplicationFields: models.ApplicationFields{GUID: appGuid, InstanceCount: 1}}, nil
+			}
+			// venerable app is still found by its name after recovery, as if its deletion was lost
+			journal.CompletedSteps = append(journal.CompletedSteps, "start new app")
+			Expect(store.Save(journal)).To(Succeed())
+			d := LoadCfResource(appResource).Data(resourceData("venerable-guid", ""))
+			Expect(appResource.RecoverDeployment(d, meta)).To(Succeed())
+			Expect(d.Id()).To(Equal("new-guid"))
+			loaded, err := store.Load("venerable-guid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(BeNil())
+
+			Expect(orphanedVenerableId(plan("new-guid"))).To(Equal("venerable-guid"))
+		})
+	})
+	Describe("DeleteOrphanedVenerable", func() {
+		It("should delete flagged app and remove journal of its deployment", func() {
+			Expect(store.Save(journal)).To(Succeed())
+			d := LoadCfResource(appResource).Data(resourceData("new-guid", "venerable-guid"))
+
+			Expect(appResource.DeleteOrphanedVenerable(d, meta)).To(Succeed())
+			Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(1))
+			Expect(fakeClient.FakeApplications().DeleteArgsForCall(0)).To(Equal("venerable-guid"))
+			Expect(d.Get("orphaned_venerable_id")).To(BeEmpty())
+			loaded, err := store.Load("venerable-guid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(BeNil())
+		})
+		It("should delete flagged app which is not recorded in a journal", func() {
+			d := LoadCfResource(appResource).Data(resourceData("new-guid", "venerable-guid"))
+
+			Expect(appResource.DeleteOrphanedVenerable(d, meta)).To(Succeed())
+			Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(1))
+			Expect(fakeClient.FakeApplications().DeleteArgsForCall(0)).To(Equal("venerable-guid"))
+		})
+		It("should not delete an app which is not named as venerable app anymore", func() {
+			fakeClient.FakeApplications().ReadFromSpaceReturns(models.Application{}, errors.NewModelNotFoundError("app", "my-app-venerable"))
+			d := LoadCfResource(appResource).Data(resourceData("new-guid", "venerable-guid"))
+
+			Expect(appResource.DeleteOrphanedVenerable(d, meta)).To(Succeed())
+			Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(0))
+		})
+		It("should not delete app of the resource", func() {
+			d := LoadCfResource(appResource).Data(resourceData("venerable-guid", "venerable-guid"))
+
+			Expect(appResource.DeleteOrphanedVenerable(d, meta)).To(Succeed())
+			Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(0))
+		})
+		It("should ignore an app already deleted", func() {
+			Expect(store.Save(journal)).To(Succeed())
+			fakeClient.FakeApplications().DeleteReturns(errors.NewModelNotFoundError("app", "venerable-guid"))
+			d := LoadCfResource(appResource).Data(resourceData("new-guid", "venerable-guid"))
+
+			Expect(appResource.DeleteOrphanedVenerable(d, meta)).To(Succeed())
+			loaded, err := store.Load("venerable-guid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(BeNil())
+		})
+	})
+	Describe("RecoverDeployment", func() {
+		BeforeEach(func() {
+			fakeClient.FakeFinder().GetAppFromCfStub = func(appGuid string) (models.Application, error) {
+				return models.Application{ApplicationFields: models.ApplicationFields{GUID: appGuid, InstanceCount: 1}}, nil
+			}
+		})
+		It("should roll back a deployment of an app which is not in state anymore", func() {
+			Expect(store.Save(journal)).To(Succeed())
+			d := LoadCfResource(appResource).Data(resourceData("", ""))
+
+			Expect(appResource.RecoverDeployment(d, meta)).To(Succeed())
+			Expect(d.Id()).To(Equal("venerable-guid"))
+			Expect(fakeClient.FakeApplications().DeleteArgsForCall(0)).To(Equal("new-guid"))
+			Expect(fakeClient.FakeApplications().UpdateCallCount()).To(Equal(2))
+			appGuid, params := fakeClient.FakeApplications().UpdateArgsForCall(0)
+			Expect(appGuid).To(Equal("venerable-guid"))
+			Expect(*params.Name).To(Equal("my-app"))
+			_, params = fakeClient.FakeApplications().UpdateArgsForCall(1)
+			Expect(*params.InstanceCount).To(Equal(2))
+			loaded, err := store.Load("venerable-guid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).To(BeNil())
+		})
+		It("should finish a deployment when only retirement of original app was left", func() {
+			journal.CompletedSteps = append(journal.CompletedSteps, "start new app")
+			Expect(store.Save(journal)).To(Succeed())
+			d := LoadCfResource(appResource).Data(resourceData("venerable-guid", ""))
+
+			Expect(appResource.RecoverDeployment(d, meta)).To(Succeed())
+			Expect(d.Id()).To(Equal("new-guid"))
+			Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(1))
+			Expect(fakeClient.FakeApplications().DeleteArgsForCall(0)).To(Equal("venerable-guid"))
+		})
+		It("should only be reported on refresh", func() {
+			Expect(store.Save(journal)).To(Succeed())
+			fakeClient.FakeFinder().GetAppFromCfStub = func(appGuid string) (models.Application, error) {
+				app := models.Application{}
+				app.GUID = appGuid
+				app.Name = "my-app-venerable"
+				app.Stack = &models.Stack{GUID: "stack-guid"}
+				return app, nil
+			}
+
+			state, err := LoadCfResource(appResource).Refresh(resourceData("venerable-guid", ""), meta)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state.ID).To(Equal("venerable-guid"))
+			// app is seen renamed, plan shows a change which recovers deployment on apply
+			Expect(state.Attributes["name"]).To(Equal("my-app-venerable"))
+			Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(0))
+			Expect(fakeClient.FakeApplications().UpdateCallCount()).To(Equal(0))
+			loaded, err := store.Load("venerable-guid")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(loaded).ToNot(BeNil())
+		})
+		It("should do nothing without journal", func() {
+			d := LoadCfResource(appResource).Data(resourceData("", ""))
+			Expect(appResource.RecoverDeployment(d, meta)).To(Succeed())
+			Expect(d.Id()).To(BeEmpty())
+			Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(0))
+		})
+	})
+})
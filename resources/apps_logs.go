@@ -0,0 +1,96 @@
+package resources
+
+import (
+	"code.cloudfoundry.org/cli/cf/api/logs"
+	"code.cloudfoundry.org/cli/cf/models"
+	"fmt"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var logFileNameSanitizer = regexp.MustCompile(`[^\w\.-]`)
+
+// StreamLogs tail logs of an app while it stages and starts, logs are written to terraform log
+// and to a file per app when app_logs_dir is set in provider.
+// Each stream has its own consumer, several apps can stream their logs at the same time.
+// The returned function must be called to stop streaming, it doesn't wait for remaining logs.
+func (c CfAppsResource) StreamLogs(client cf_client.Client, a models.Application) func() {
+	appName := a.Name
+	if appName == "" {
+		appName = a.GUID
+	}
+	logsRepo, err := client.NewLogs()
+	if err != nil {
+		log.Printf("[DEBUG] logs of app %s will not be streamed: %s", appName, err.Error())
+		return func() {}
+	}
+	logFile := c.openLogFile(client, appName)
+
+	logChan := make(chan logs.Loggable)
+	errChan := make(chan error, 1)
+	stop := make(chan struct{})
+	logsRepo.TailLogsFor(a.GUID, func() {
+		log.Printf("[INFO] streaming logs of app %s", appName)
+	}, logChan, errChan)
+	go func(stop <-chan struct{}) {
+		defer func() {
+			logsRepo.Close()
+			if logFile != nil {
+				logFile.Close()
+			}
+		}()
+		for {
+			select {
+			case loggable, ok := <-logChan:
+				if !ok {
+					return
+				}
+				log.Printf("[INFO] [app %s] %s", appName, loggable.ToSimpleLog())
+				if logFile != nil {
+					fmt.Fprintln(logFile, loggable.ToLog(time.Local))
+				}
+			case err, ok := <-errChan:
+				if !ok {
+					errChan = nil
+					continue
+				}
+				if err != nil {
+					log.Printf("[WARN] error when streaming logs of app %s: %s", appName, err.Error())
+				}
+			case <-stop:
+				// closing consumer closes logChan once buffered logs are written
+				logsRepo.Close()
+				stop = nil
+			}
+		}
+	}(stop)
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			close(stop)
+		})
+	}
+}
+func (c CfAppsResource) openLogFile(client cf_client.Client, appName string) *os.File {
+	logsDir := client.Config().AppLogsDir
+	if logsDir == "" {
+		return nil
+	}
+	err := os.MkdirAll(logsDir, 0755)
+	if err != nil {
+		log.Printf("[WARN] cannot create logs directory %s: %s", logsDir, err.Error())
+		return nil
+	}
+	logPath := filepath.Join(logsDir, logFileNameSanitizer.ReplaceAllString(appName, "_")+".log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("[WARN] cannot open log file %s: %s", logPath, err.Error())
+		return nil
+	}
+	return logFile
+}
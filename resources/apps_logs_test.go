@@ -0,0 +1,120 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"code.cloudfoundry.org/cli/cf/api/logs"
+	"code.cloudfoundry.org/cli/cf/models"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type fakeLoggable string
+
+func (l fakeLoggable) ToLog(loc *time.Location) string {
+	return "[APP/0] OUT " + string(l)
+}
+func (l fakeLoggable) ToSimpleLog() string {
+	return string(l)
+}
+func (l fakeLoggable) GetSourceName() string {
+	return "APP"
+}
+
+var _ = Describe("CfAppsResource logs streaming", func() {
+	var fakeClient *fake_cf_client.FakeCfClient
+	var logsDir string
+	var closed chan struct{}
+	appResource := CfAppsResource{}
+	app := func(guid, name string) models.Application {
+		a := models.Application{}
+		a.GUID = guid
+		a.Name = name
+		return a
+	}
+	logFileContent := func(name string) func() string {
+		return func() string {
+			b, _ := ioutil.ReadFile(filepath.Join(logsDir, name+".log"))
+			return string(b)
+		}
+	}
+	BeforeEach(func() {
+		var err error
+		logsDir, err = ioutil.TempDir("", "app-logs")
+		Expect(err).ToNot(HaveOccurred())
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		fakeClient.SetConfig(cf_client.Config{AppLogsDir: logsDir})
+
+		// consumer sends logs until it is closed
+		consumerClosed := make(chan struct{})
+		closed = consumerClosed
+		var closeOnce sync.Once
+		fakeClient.FakeLogs().CloseStub = func() {
+			closeOnce.Do(func() {
+				close(consumerClosed)
+			})
+		}
+		fakeClient.FakeLogs().TailLogsForStub = func(appGuid string, onConnect func(), logChan chan<- logs.Loggable, errChan chan<- error) {
+			onConnect()
+			go func() {
+				logChan <- fakeLoggable("staging " + appGuid)
+				<-consumerClosed
+				close(logChan)
+				close(errChan)
+			}()
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(logsDir)
+	})
+	It("should write logs of the app in its file until streaming is stopped", func() {
+		stop := appResource.StreamLogs(fakeClient.GetClient(), app("app-guid", "my-app"))
+
+		Eventually(logFileContent("my-app")).Should(Equal("[APP/0] OUT staging app-guid\n"))
+		Expect(fakeClient.FakeLogs().CloseCallCount()).To(Equal(0))
+
+		stop()
+		Eventually(closed).Should(BeClosed())
+		// stopping again does nothing
+		stop()
+	})
+	It("should release consumer when streaming ends with an error", func() {
+		fakeClient.FakeLogs().TailLogsForStub = func(appGuid string, onConnect func(), logChan chan<- logs.Loggable, errChan chan<- error) {
+			go func() {
+				errChan <- errors.New("websocket closed")
+				close(logChan)
+				close(errChan)
+			}()
+		}
+		stop := appResource.StreamLogs(fakeClient.GetClient(), app("app-guid", "my-app"))
+
+		Eventually(fakeClient.FakeLogs().CloseCallCount).Should(BeNumerically(">=", 1))
+		stop()
+	})
+	It("should stream logs of several apps at the same time", func() {
+		stopFirst := appResource.StreamLogs(fakeClient.GetClient(), app("first-guid", "first"))
+		stopSecond := appResource.StreamLogs(fakeClient.GetClient(), app("second-guid", "second"))
+		defer stopFirst()
+		defer stopSecond()
+
+		Expect(fakeClient.FakeLogs().TailLogsForCallCount()).To(Equal(2))
+		Eventually(logFileContent("first")).Should(ContainSubstring("staging first-guid"))
+		Eventually(logFileContent("second")).Should(ContainSubstring("staging second-guid"))
+	})
+	It("should not stream logs when they cannot be retrieved", func() {
+		fakeClient.SetNewLogsError(errors.New("No doppler endpoint found, logs cannot be retrieved."))
+
+		stop := appResource.StreamLogs(fakeClient.GetClient(), app("app-guid", "my-app"))
+		stop()
+		Expect(fakeClient.FakeLogs().TailLogsForCallCount()).To(Equal(0))
+		Expect(fakeClient.FakeLogs().CloseCallCount()).To(Equal(0))
+	})
+})
@@ -0,0 +1,67 @@
+package resources
+
+import (
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"log"
+	"strings"
+)
+
+const appsSchemaVersion = 1
+
+func (c CfAppsResource) SchemaVersion() int {
+	return appsSchemaVersion
+}
+func (c CfAppsResource) MigrateState(version int, is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	if is == nil || is.ID == "" {
+		return is, nil
+	}
+	switch version {
+	case 0:
+		return c.migrateStateV0toV1(is, meta)
+	}
+	return is, nil
+}
+
+// migrateStateV0toV1 replace fingerprints made from the first 5KB of the bits by full sha256 digests.
+// Local digest is only kept when bits didn't change since last deployment, otherwise it is emptied to redeploy app.
+// Migration can run several times on the same state (e.g.: apps in a manifest), fingerprints in form type:value are already migrated.
+func (c CfAppsResource) migrateStateV0toV1(is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	if is.Attributes["docker_image"] != "" {
+		return is, nil
+	}
+	path := is.Attributes["path"]
+	pathSha1 := is.Attributes["path_sha1"]
+	if path != "" && pathSha1 != "" && !strings.Contains(pathSha1, ":") && !(bitsmanager.GitHandler{}).Detect(path) {
+		is.Attributes["path_sha1"] = c.migratePathSha1(path, pathSha1, meta)
+	}
+	remoteSha1 := is.Attributes["remote_sha1"]
+	if remoteSha1 != "" && !strings.Contains(remoteSha1, ":") {
+		client := meta.(cf_client.Client)
+		rmtSha1, err := client.ApplicationBits().GetApplicationSha1(is.ID)
+		if err != nil {
+			return is, err
+		}
+		is.Attributes["remote_sha1"] = rmtSha1
+	}
+	return is, nil
+}
+func (c CfAppsResource) migratePathSha1(path, legacySha1 string, meta interface{}) string {
+	bm := c.MakeBitsManager(meta, bitsmanager.FileFilter{}, nil, "")
+	currentLegacySha1, err := bm.GetLegacySha1(path)
+	if err != nil {
+		log.Printf("[WARN] cannot migrate fingerprint of %s, app will be redeployed: %s", path, err.Error())
+		return ""
+	}
+	if currentLegacySha1 != legacySha1 {
+		log.Printf("[INFO] bits of %s changed since last deployment, app will be redeployed", path)
+		return ""
+	}
+	sha256, err := bm.GetSha1(path)
+	if err != nil {
+		log.Printf("[WARN] cannot migrate fingerprint of %s, app will be redeployed: %s", path, err.Error())
+		return ""
+	}
+	return sha256
+}
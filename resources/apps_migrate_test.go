@@ -0,0 +1,111 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("CfAppsResource state migration", func() {
+	var fakeClient *fake_cf_client.FakeCfClient
+	var meta interface{}
+	var appPath string
+	var legacySha1 string
+	appResource := CfAppsResource{}
+	legacyState := func(pathSha1 string) *terraform.InstanceState {
+		return &terraform.InstanceState{
+			ID: "app-guid",
+			Attributes: map[string]string{
+				"path":        appPath,
+				"path_sha1":   pathSha1,
+				"remote_sha1": "bGVnYWN5LXJlbW90ZQ==",
+			},
+		}
+	}
+	BeforeEach(func() {
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		meta = fakeClient.GetClient()
+		fakeClient.FakeApplicationBits().GetApplicationSha1Returns("sha256:remote", nil)
+
+		var err error
+		appPath, err = ioutil.TempDir("", "app-migrate")
+		Expect(err).ToNot(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(appPath, "index.html"), []byte("hello"), 0644)
+		Expect(err).ToNot(HaveOccurred())
+		legacySha1, err = appResource.MakeBitsManager(meta, bitsmanager.FileFilter{}, nil, "").GetLegacySha1(appPath)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(appPath)
+	})
+	It("should replace fingerprints by sha256 digests when bits didn't change", func() {
+		sha256, err := appResource.MakeBitsManager(meta, bitsmanager.FileFilter{}, nil, "").GetSha1(appPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		is, err := appResource.MigrateState(0, legacyState(legacySha1), meta)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(is.Attributes["path_sha1"]).To(Equal(sha256))
+		Expect(is.Attributes["remote_sha1"]).To(Equal("sha256:remote"))
+		Expect(fakeClient.FakeApplicationBits().GetApplicationSha1ArgsForCall(0)).To(Equal("app-guid"))
+	})
+	It("should empty local fingerprint to redeploy app when bits changed", func() {
+		is, err := appResource.MigrateState(0, legacyState("YW5vdGhlci1zaGEx"), meta)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(is.Attributes["path_sha1"]).To(BeEmpty())
+	})
+	It("should keep fingerprints already migrated", func() {
+		state := legacyState("sha256:local")
+		state.Attributes["remote_sha1"] = "sha256:remote-before"
+
+		is, err := appResource.MigrateState(0, state, meta)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(is.Attributes["path_sha1"]).To(Equal("sha256:local"))
+		Expect(is.Attributes["remote_sha1"]).To(Equal("sha256:remote-before"))
+		Expect(fakeClient.FakeApplicationBits().GetApplicationSha1CallCount()).To(Equal(0))
+	})
+	Context("with a tgz url", func() {
+		var server *httptest.Server
+		var tgz []byte
+		BeforeEach(func() {
+			buf := new(bytes.Buffer)
+			gzipWriter := gzip.NewWriter(buf)
+			tarWriter := tar.NewWriter(gzipWriter)
+			content := []byte("hello")
+			Expect(tarWriter.WriteHeader(&tar.Header{Name: "index.html", Mode: 0644, Size: int64(len(content))})).To(Succeed())
+			_, err := tarWriter.Write(content)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tarWriter.Close()).To(Succeed())
+			Expect(gzipWriter.Close()).To(Succeed())
+			tgz = buf.Bytes()
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Write(tgz)
+			}))
+			appPath = server.URL + "/app.tgz"
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should compare fingerprint made from the downloaded file and not from the zip made from it", func() {
+			legacySha1, err := bitsmanager.GetLegacySha1FromReader(ioutil.NopCloser(bytes.NewReader(tgz)))
+			Expect(err).ToNot(HaveOccurred())
+			sha256, err := appResource.MakeBitsManager(meta, bitsmanager.FileFilter{}, nil, "").GetSha1(appPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			is, err := appResource.MigrateState(0, legacyState(legacySha1), meta)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(is.Attributes["path_sha1"]).To(Equal(sha256))
+		})
+	})
+})
@@ -0,0 +1,251 @@
+package resources
+
+import (
+	"code.cloudfoundry.org/cli/cf/models"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/rewind"
+	"log"
+	"strings"
+	"time"
+)
+
+const previousAppExpired = "expired"
+
+func previousAppName(appName string) string {
+	return fmt.Sprintf("%s-previous", appName)
+}
+
+// retireApp is the last step of a deployment creating a new app, old app is deleted
+// or, when keep_previous_for is set, kept stopped and without routes to be able to roll back to it
+func (c CfAppsResource) retireApp(d *schema.ResourceData, meta interface{}, appGuid string) error {
+	client := meta.(cf_client.Client)
+	keepPreviousFor := d.Get("keep_previous_for").(string)
+	if keepPreviousFor == "" {
+		return client.Applications().Delete(appGuid)
+	}
+	duration, err := time.ParseDuration(keepPreviousFor)
+	if err != nil {
+		return err
+	}
+	err = c.deletePreviousApp(d, meta)
+	if err != nil {
+		return err
+	}
+	app, err := client.Finder().GetAppFromCf(appGuid)
+	if err != nil {
+		return err
+	}
+	err = c.stopApp(client, app)
+	if err != nil {
+		return err
+	}
+	for _, route := range app.Routes {
+		err = client.Route().Unbind(route.GUID, appGuid)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.renameApplication(client, appGuid, previousAppName(d.Get("name").(string)))
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] previous version of app %s is kept during %s", d.Get("name").(string), duration)
+	c.setPreviousApp(d, appGuid, duration)
+	return nil
+}
+func (c CfAppsResource) setPreviousApp(d *schema.ResourceData, appGuid string, keepFor time.Duration) {
+	d.Set("previous_app_id", appGuid)
+	d.Set("previous_expires_at", time.Now().Add(keepFor).UTC().Format(time.RFC3339))
+	d.Set("previous_has_expired", "")
+}
+func (c CfAppsResource) deletePreviousApp(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(cf_client.Client)
+	previousGuid := d.Get("previous_app_id").(string)
+	if previousGuid == "" || previousGuid == d.Id() {
+		return nil
+	}
+	app, err := client.Finder().GetAppFromCf(previousGuid)
+	if err != nil {
+		return err
+	}
+	if app.GUID != "" {
+		log.Printf("[INFO] deleting previous version %s of app %s", previousGuid, d.Get("name").(string))
+		err = client.Applications().Delete(previousGuid)
+		if err != nil {
+			return err
+		}
+	}
+	d.Set("previous_app_id", "")
+	d.Set("previous_expires_at", "")
+	d.Set("previous_has_expired", "")
+	return nil
+}
+
+// IsPreviousAppExpired tell if rollback window of previous app has passed, d can be a ResourceData or a ResourceDiff
+func (c CfAppsResource) IsPreviousAppExpired(d interface {
+	Get(string) interface{}
+}) bool {
+	if d.Get("previous_app_id").(string) == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, d.Get("previous_expires_at").(string))
+	if err != nil {
+		return true
+	}
+	return time.Now().After(expiresAt)
+}
+
+// readPreviousApp forget a previous app which has been removed outside of terraform
+func (c CfAppsResource) readPreviousApp(d *schema.ResourceData, meta interface{}) error {
+	previousGuid := d.Get("previous_app_id").(string)
+	if previousGuid == "" {
+		return nil
+	}
+	client := meta.(cf_client.Client)
+	app, err := client.Finder().GetAppFromCf(previousGuid)
+	if err != nil {
+		return err
+	}
+	if app.GUID == "" {
+		d.Set("previous_app_id", "")
+		d.Set("previous_expires_at", "")
+		d.Set("previous_has_expired", "")
+	}
+	return nil
+}
+func (c CfAppsResource) IsRollback(d *schema.ResourceData) bool {
+	return d.HasChange("rollback") && d.Get("rollback").(string) != ""
+}
+
+// rollback swap current app with previous app kept, no bits are uploaded or staged.
+// Current app becomes the previous app and can be swapped back again.
+func (c CfAppsResource) rollback(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(cf_client.Client)
+	previousGuid := d.Get("previous_app_id").(string)
+	if previousGuid == "" {
+		return fmt.Errorf("No previous version of app %s is kept, rollback is not possible (see keep_previous_for)", d.Get("name").(string))
+	}
+	current, err := client.Finder().GetAppFromCf(d.Id())
+	if err != nil {
+		return err
+	}
+	previous, err := client.Finder().GetAppFromCf(previousGuid)
+	if err != nil {
+		return err
+	}
+	if previous.GUID == "" {
+		return fmt.Errorf("Previous version %s of app %s cannot be found, rollback is not possible", previousGuid, current.Name)
+	}
+	policy, err := NewReadinessPolicy(d)
+	if err != nil {
+		return err
+	}
+	unmapPrevious := func() error {
+		errMsgs := make([]string, 0)
+		err := c.stopApp(client, previous)
+		if err != nil {
+			errMsgs = append(errMsgs, err.Error())
+		}
+		for _, route := range current.Routes {
+			err := client.Route().Unbind(route.GUID, previousGuid)
+			if err != nil {
+				errMsgs = append(errMsgs, err.Error())
+			}
+		}
+		if len(errMsgs) > 0 {
+			return fmt.Errorf("Previous app %s cannot be unmapped: %s", previousGuid, strings.Join(errMsgs, ", "))
+		}
+		return nil
+	}
+	actions := []rewind.Action{
+		{
+			Name: "start previous app",
+			Forward: func() error {
+				_, err := client.Applications().Update(previousGuid, models.AppParams{InstanceCount: &current.InstanceCount})
+				if err != nil {
+					return err
+				}
+				for _, route := range current.Routes {
+					err := client.Route().Bind(route.GUID, previousGuid)
+					if err != nil {
+						return err
+					}
+				}
+				return c.startApp(client, previous, policy)
+			},
+			Reverse:         unmapPrevious,
+			ReversePrevious: unmapPrevious,
+		},
+		{
+			Name: "rename current app",
+			Forward: func() error {
+				return c.renameApplication(client, current.GUID, venerableAppName(current.Name))
+			},
+			Reverse: func() error {
+				return c.renameApplication(client, current.GUID, current.Name)
+			},
+		},
+		{
+			Name: "rename previous app",
+			Forward: func() error {
+				return c.renameApplication(client, previousGuid, current.Name)
+			},
+			Reverse: func() error {
+				return c.renameApplication(client, previousGuid, previousAppName(current.Name))
+			},
+		},
+		{
+			Name: "retire current app",
+			Forward: func() error {
+				err := c.stopApp(client, current)
+				if err != nil {
+					return err
+				}
+				for _, route := range current.Routes {
+					err := client.Route().Unbind(route.GUID, current.GUID)
+					if err != nil {
+						return err
+					}
+				}
+				return c.renameApplication(client, current.GUID, previousAppName(current.Name))
+			},
+			ReversePrevious: func() error {
+				errMsgs := make([]string, 0)
+				for _, route := range current.Routes {
+					err := client.Route().Bind(route.GUID, current.GUID)
+					if err != nil {
+						errMsgs = append(errMsgs, err.Error())
+					}
+				}
+				state := stateStarted
+				_, err := client.Applications().Update(current.GUID, models.AppParams{State: &state})
+				if err != nil {
+					errMsgs = append(errMsgs, err.Error())
+				}
+				if len(errMsgs) > 0 {
+					return fmt.Errorf("Current app %s cannot be restored: %s", current.GUID, strings.Join(errMsgs, ", "))
+				}
+				return nil
+			},
+		},
+	}
+	err = c.updateBg(actions)
+	if err != nil {
+		return fmt.Errorf("Error when trying to roll back the app %s: %s", current.Name, err.Error())
+	}
+	log.Printf("[INFO] app %s rolled back to previous version %s", current.Name, previousGuid)
+	d.SetId(previousGuid)
+	keepPreviousFor := d.Get("keep_previous_for").(string)
+	if keepPreviousFor == "" {
+		d.Set("previous_app_id", current.GUID)
+		return c.deletePreviousApp(d, meta)
+	}
+	duration, err := time.ParseDuration(keepPreviousFor)
+	if err != nil {
+		return err
+	}
+	c.setPreviousApp(d, current.GUID, duration)
+	return nil
+}
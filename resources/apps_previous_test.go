@@ -0,0 +1,310 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"code.cloudfoundry.org/cli/cf/api/apifakes"
+	"code.cloudfoundry.org/cli/cf/models"
+	"fmt"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"time"
+)
+
+var _ = Describe("CfAppsResource previous app", func() {
+	Describe("IsPreviousAppExpired", func() {
+		appResource := CfAppsResource{}
+		previousState := func(expiresAt string) *terraform.InstanceState {
+			return &terraform.InstanceState{
+				ID: "app-guid",
+				Attributes: map[string]string{
+					"previous_app_id":     "previous-guid",
+					"previous_expires_at": expiresAt,
+				},
+			}
+		}
+		It("should not be expired when no previous app is kept", func() {
+			resourceData := LoadCfResource(appResource).Data(&terraform.InstanceState{ID: "app-guid"})
+			Expect(appResource.IsPreviousAppExpired(resourceData)).To(BeFalse())
+		})
+		It("should not be expired during rollback window", func() {
+			expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+			resourceData := LoadCfResource(appResource).Data(previousState(expiresAt))
+			Expect(appResource.IsPreviousAppExpired(resourceData)).To(BeFalse())
+		})
+		It("should be expired when rollback window is passed", func() {
+			expiresAt := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+			resourceData := LoadCfResource(appResource).Data(previousState(expiresAt))
+			Expect(appResource.IsPreviousAppExpired(resourceData)).To(BeTrue())
+		})
+		It("should be expired when expiration date is not valid", func() {
+			resourceData := LoadCfResource(appResource).Data(previousState(""))
+			Expect(appResource.IsPreviousAppExpired(resourceData)).To(BeTrue())
+		})
+	})
+	Context("with a deployment", func() {
+		var fakeClient *fake_cf_client.FakeCfClient
+		var meta interface{}
+		var resource *schema.Resource
+		var state *terraform.InstanceState
+		// apps known by cloud controller by guid
+		var cfApps map[string]models.Application
+		// calls made to cloud controller in order
+		var calls []string
+		var crashed map[string]bool
+		app := func(guid, name string, instances int) models.Application {
+			a := models.Application{}
+			a.GUID = guid
+			a.Name = name
+			a.InstanceCount = instances
+			a.Stack = &models.Stack{GUID: "stack-guid"}
+			a.Routes = []models.RouteSummary{{GUID: "route-guid"}}
+			return a
+		}
+		update := func(attributes map[string]*terraform.ResourceAttrDiff) (*terraform.InstanceState, error) {
+			return resource.Apply(state, &terraform.InstanceDiff{Attributes: attributes}, meta)
+		}
+		BeforeEach(func() {
+			fakeClient = fake_cf_client.NewFakeCfClient()
+			meta = fakeClient.GetClient()
+			resource = LoadCfResource(CfAppsResource{})
+			state = &terraform.InstanceState{
+				ID: "orig-guid",
+				Attributes: map[string]string{
+					"name":              "my-app",
+					"space_id":          "space-guid",
+					"stack_id":          "stack-guid",
+					"memory":            "512M",
+					"disk_quota":        "1G",
+					"instances":         "2",
+					"started":           "true",
+					"command":           "old-command",
+					"keep_previous_for": "1h",
+				},
+			}
+			cfApps = map[string]models.Application{
+				"orig-guid": app("orig-guid", "my-app", 2),
+			}
+			calls = make([]string, 0)
+			crashed = make(map[string]bool)
+			fakeClient.FakeFinder().GetAppFromCfStub = func(appGuid string) (models.Application, error) {
+				return cfApps[appGuid], nil
+			}
+			fakeClient.FakeApplications().CreateStub = func(params models.AppParams) (models.Application, error) {
+				calls = append(calls, fmt.Sprintf("create %s", *params.Name))
+				return app("new-guid", *params.Name, *params.InstanceCount), nil
+			}
+			fakeClient.FakeApplications().UpdateStub = func(appGuid string, params models.AppParams) (models.Application, error) {
+				switch {
+				case params.Name != nil:
+					calls = append(calls, fmt.Sprintf("rename %s to %s", appGuid, *params.Name))
+				case params.State != nil:
+					calls = append(calls, fmt.Sprintf("%s %s", *params.State, appGuid))
+				case params.InstanceCount != nil:
+					calls = append(calls, fmt.Sprintf("scale %s to %d", appGuid, *params.InstanceCount))
+				}
+				return cfApps[appGuid], nil
+			}
+			fakeClient.FakeApplications().DeleteStub = func(appGuid string) error {
+				calls = append(calls, fmt.Sprintf("delete %s", appGuid))
+				delete(cfApps, appGuid)
+				return nil
+			}
+			fakeClient.FakeApplications().GetAppStub = func(appGuid string) (models.Application, error) {
+				a := app(appGuid, "my-app", 2)
+				a.PackageState = "STAGED"
+				return a, nil
+			}
+			fakeClient.FakeAppInstances().GetInstancesStub = func(appGuid string) ([]models.AppInstanceFields, error) {
+				state := models.InstanceRunning
+				if crashed[appGuid] {
+					state = models.InstanceCrashed
+				}
+				return []models.AppInstanceFields{{State: state}, {State: state}}, nil
+			}
+			fakeRoute := fakeClient.FakeRoute().(*apifakes.FakeRouteRepository)
+			fakeRoute.BindStub = func(routeGuid, appGuid string) error {
+				calls = append(calls, fmt.Sprintf("bind %s to %s", routeGuid, appGuid))
+				return nil
+			}
+			fakeRoute.UnbindStub = func(routeGuid, appGuid string) error {
+				calls = append(calls, fmt.Sprintf("unbind %s from %s", routeGuid, appGuid))
+				return nil
+			}
+		})
+		Describe("keep_previous_for", func() {
+			It("should keep old app stopped and without routes instead of deleting it", func() {
+				newState, err := update(map[string]*terraform.ResourceAttrDiff{
+					"command": {Old: "old-command", New: "new-command"},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(newState.ID).To(Equal("new-guid"))
+
+				Expect(calls).To(Equal([]string{
+					"rename orig-guid to my-app-venerable",
+					"create my-app",
+					"STARTED new-guid",
+					"STOPPED orig-guid",
+					"unbind route-guid from orig-guid",
+					"rename orig-guid to my-app-previous",
+				}))
+				Expect(newState.Attributes["previous_app_id"]).To(Equal("orig-guid"))
+				expiresAt, err := time.Parse(time.RFC3339, newState.Attributes["previous_expires_at"])
+				Expect(err).ToNot(HaveOccurred())
+				Expect(expiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+			})
+			It("should delete app kept by previous deployment", func() {
+				state.Attributes["previous_app_id"] = "older-guid"
+				state.Attributes["previous_expires_at"] = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+				cfApps["older-guid"] = app("older-guid", "my-app-previous", 2)
+
+				newState, err := update(map[string]*terraform.ResourceAttrDiff{
+					"command": {Old: "old-command", New: "new-command"},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(calls).To(ContainElement("delete older-guid"))
+				Expect(calls).ToNot(ContainElement("delete orig-guid"))
+				Expect(newState.Attributes["previous_app_id"]).To(Equal("orig-guid"))
+			})
+		})
+		Describe("rollback", func() {
+			rollback := func() (*terraform.InstanceState, error) {
+				return update(map[string]*terraform.ResourceAttrDiff{
+					"rollback": {Old: "", New: "1"},
+				})
+			}
+			BeforeEach(func() {
+				state.Attributes["previous_app_id"] = "previous-guid"
+				state.Attributes["previous_expires_at"] = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+				cfApps["previous-guid"] = app("previous-guid", "my-app-previous", 1)
+			})
+			It("should swap current app with previous app", func() {
+				newState, err := rollback()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(newState.ID).To(Equal("previous-guid"))
+
+				Expect(calls).To(Equal([]string{
+					"scale previous-guid to 2",
+					"bind route-guid to previous-guid",
+					"STARTED previous-guid",
+					"rename orig-guid to my-app-venerable",
+					"rename previous-guid to my-app",
+					"STOPPED orig-guid",
+					"unbind route-guid from orig-guid",
+					"rename orig-guid to my-app-previous",
+				}))
+				// current app can be swapped back
+				Expect(newState.Attributes["previous_app_id"]).To(Equal("orig-guid"))
+				Expect(fakeClient.FakeApplications().CreateCallCount()).To(Equal(0))
+				Expect(fakeClient.FakeApplicationBits().UploadBitsCallCount()).To(Equal(0))
+			})
+			It("should delete current app when previous versions are no longer kept", func() {
+				state.Attributes["keep_previous_for"] = ""
+
+				newState, err := rollback()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(newState.ID).To(Equal("previous-guid"))
+				Expect(calls[len(calls)-1]).To(Equal("delete orig-guid"))
+				Expect(newState.Attributes["previous_app_id"]).To(BeEmpty())
+			})
+			It("should keep current app when previous app fails to start", func() {
+				crashed["previous-guid"] = true
+
+				newState, err := rollback()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Error when trying to roll back the app my-app"))
+				Expect(newState.ID).To(Equal("orig-guid"))
+
+				Expect(calls).To(Equal([]string{
+					"scale previous-guid to 2",
+					"bind route-guid to previous-guid",
+					"STARTED previous-guid",
+					"STOPPED previous-guid",
+					"unbind route-guid from previous-guid",
+				}))
+			})
+			It("should report routes which cannot be unbound from previous app when rolling back", func() {
+				crashed["previous-guid"] = true
+				fakeRoute := fakeClient.FakeRoute().(*apifakes.FakeRouteRepository)
+				fakeRoute.UnbindStub = func(routeGuid, appGuid string) error {
+					return fmt.Errorf("route %s cannot be unbound", routeGuid)
+				}
+
+				_, err := rollback()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("route route-guid cannot be unbound"))
+			})
+			It("should fail when no previous app is kept", func() {
+				state.Attributes["previous_app_id"] = ""
+
+				_, err := rollback()
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("No previous version of app my-app is kept"))
+				Expect(calls).To(BeEmpty())
+			})
+		})
+		Describe("expiration", func() {
+			BeforeEach(func() {
+				state.Attributes["previous_app_id"] = "previous-guid"
+				cfApps["previous-guid"] = app("previous-guid", "my-app-previous", 1)
+				// defaults of the resource to only plan changes on previous app
+				state.Attributes["diego"] = "true"
+				state.Attributes["health_check_type"] = "port"
+			})
+			plan := func() *terraform.InstanceDiff {
+				rawConfig, err := config.NewRawConfig(map[string]interface{}{
+					"name":              "my-app",
+					"space_id":          "space-guid",
+					"stack_id":          "stack-guid",
+					"memory":            "512M",
+					"disk_quota":        "1G",
+					"instances":         2,
+					"command":           "old-command",
+					"keep_previous_for": "1h",
+				})
+				Expect(err).ToNot(HaveOccurred())
+				diff, err := resource.Diff(state, terraform.NewResourceConfig(rawConfig), meta)
+				Expect(err).ToNot(HaveOccurred())
+				return diff
+			}
+			It("should plan deletion of an expired previous app and delete it on apply", func() {
+				state.Attributes["previous_expires_at"] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+				// refresh never changes Cloud Foundry nor flags previous app, only plan does
+				refreshedState, err := resource.Refresh(state, meta)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(refreshedState.Attributes["previous_app_id"]).To(Equal("previous-guid"))
+				Expect(refreshedState.Attributes["previous_has_expired"]).To(BeEmpty())
+				Expect(calls).To(BeEmpty())
+
+				diff := plan()
+				Expect(diff.Attributes).To(HaveKey("previous_has_expired"))
+				Expect(diff.Attributes["previous_has_expired"].New).To(Equal("expired"))
+
+				newState, err := resource.Apply(state, diff, meta)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(calls).To(Equal([]string{"delete previous-guid"}))
+				Expect(newState.ID).To(Equal("orig-guid"))
+				Expect(newState.Attributes["previous_app_id"]).To(BeEmpty())
+				Expect(newState.Attributes["previous_expires_at"]).To(BeEmpty())
+				Expect(newState.Attributes["previous_has_expired"]).To(BeEmpty())
+			})
+			It("should not plan deletion of a previous app during rollback window", func() {
+				state.Attributes["previous_expires_at"] = time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+				diff := plan()
+				Expect(diff == nil || diff.Empty()).To(BeTrue())
+			})
+			It("should forget a previous app removed outside of terraform", func() {
+				state.Attributes["previous_expires_at"] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+				delete(cfApps, "previous-guid")
+				refreshedState, err := resource.Refresh(state, meta)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(refreshedState.Attributes["previous_app_id"]).To(BeEmpty())
+				Expect(refreshedState.Attributes["previous_has_expired"]).To(BeEmpty())
+			})
+		})
+	})
+})
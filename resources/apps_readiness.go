@@ -0,0 +1,204 @@
+package resources
+
+import (
+	"code.cloudfoundry.org/cli/cf/models"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/common"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultReadinessTimeout = 15 * time.Minute
+	readinessPollingTime    = 5 * time.Second
+	crashEventName          = "app.crash"
+	crashEventsLimit        = 50
+)
+
+// ReadinessPolicy define when a started app is considered as healthy,
+// by default all instances must be running.
+// Timeout applies to the whole deployment: every wait (package processing, staging, v3 deployment, instances)
+// must end before DeployedAt + Timeout, and crashes which happened before DeployedAt are not reported.
+type ReadinessPolicy struct {
+	MinInstances  int
+	MinPercentage int
+	StablePeriod  time.Duration
+	Timeout       time.Duration
+	DeployedAt    time.Time
+}
+
+// NewReadinessPolicy give policy of the app, it must be made when deployment starts
+func NewReadinessPolicy(d *schema.ResourceData) (ReadinessPolicy, error) {
+	policy := ReadinessPolicy{
+		Timeout:    DefaultReadinessTimeout,
+		DeployedAt: time.Now(),
+	}
+	readinessList := d.Get("readiness").([]interface{})
+	if len(readinessList) == 0 || readinessList[0] == nil {
+		return policy, nil
+	}
+	readiness := readinessList[0].(map[string]interface{})
+	policy.MinInstances = readiness["min_instances"].(int)
+	policy.MinPercentage = readiness["min_percentage"].(int)
+	var err error
+	if stablePeriod := readiness["stable_period"].(string); stablePeriod != "" {
+		policy.StablePeriod, err = time.ParseDuration(stablePeriod)
+		if err != nil {
+			return policy, err
+		}
+	}
+	if timeout := readiness["timeout"].(string); timeout != "" {
+		policy.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// RequiredInstances give the number of instances which must be running, it can never be more than total of instances
+func (p ReadinessPolicy) RequiredInstances(total int) int {
+	required := total
+	if p.MinInstances > 0 {
+		required = p.MinInstances
+	}
+	if p.MinPercentage > 0 {
+		required = int(math.Ceil(float64(total) * float64(p.MinPercentage) / 100))
+	}
+	if required > total {
+		return total
+	}
+	return required
+}
+
+// Remaining give time left before the deadline of the deployment
+func (p ReadinessPolicy) Remaining() time.Duration {
+	return p.DeployedAt.Add(p.Timeout).Sub(time.Now())
+}
+
+// waitForInstances wait that enough instances are running during the stable period defined by policy
+// and fails as soon as too many instances crashed or when deadline is reached.
+func (c CfAppsResource) waitForInstances(client cf_client.Client, app models.Application, policy ReadinessPolicy) error {
+	if app.InstanceCount == 0 {
+		return nil
+	}
+	required := policy.RequiredInstances(app.InstanceCount)
+	var stableSince time.Time
+	var checkErr error
+	running := 0
+	err := common.PollingWithTimeout(func() (bool, error) {
+		appInstances, err := client.AppInstances().GetInstances(app.GUID)
+		if err != nil {
+			checkErr = err
+			return true, err
+		}
+		running = 0
+		crashed := 0
+		for _, instance := range appInstances {
+			switch instance.State {
+			case models.InstanceRunning:
+				running++
+			case models.InstanceCrashed, models.InstanceFlapping:
+				crashed++
+			}
+		}
+		if crashed > 0 && app.InstanceCount-crashed < required {
+			checkErr = fmt.Errorf(
+				"%d instance(s) crashed for app %s, %d running instance(s) required%s",
+				crashed,
+				app.Name,
+				required,
+				c.crashReasons(client, app, policy.DeployedAt),
+			)
+			return true, checkErr
+		}
+		if running < required {
+			stableSince = time.Time{}
+			return false, nil
+		}
+		if stableSince.IsZero() {
+			stableSince = time.Now()
+		}
+		return time.Since(stableSince) >= policy.StablePeriod, nil
+	}, readinessPollingTime, policy.Remaining())
+	if err != nil && checkErr == nil {
+		return fmt.Errorf(
+			"Timeout reached after %s for app %s: %d/%d instance(s) running, %d required during %s%s",
+			policy.Timeout,
+			app.Name,
+			running,
+			app.InstanceCount,
+			required,
+			policy.StablePeriod,
+			c.crashReasons(client, app, policy.DeployedAt),
+		)
+	}
+	return err
+}
+
+// crashReasons give exit descriptions of last crashes found in app events, crashes before since are left out
+func (c CfAppsResource) crashReasons(client cf_client.Client, app models.Application, since time.Time) string {
+	events, err := client.AppEvents().RecentEvents(app.GUID, crashEventsLimit)
+	if err != nil {
+		return fmt.Sprintf(" (failed to retrieve crash events: %s)", err.Error())
+	}
+	reasons := make([]string, 0)
+	for _, event := range events {
+		if event.Name != crashEventName || event.Timestamp.Before(since) {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("\n\t%s: %s", event.Timestamp.Format(time.RFC3339), event.Description))
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	return "\ncrash reasons:" + strings.Join(reasons, "")
+}
+func readinessSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"min_instances": &schema.Schema{
+					Type:          schema.TypeInt,
+					Optional:      true,
+					ConflictsWith: []string{"readiness.0.min_percentage"},
+				},
+				"min_percentage": &schema.Schema{
+					Type:          schema.TypeInt,
+					Optional:      true,
+					ConflictsWith: []string{"readiness.0.min_instances"},
+					ValidateFunc: func(elem interface{}, index string) ([]string, []error) {
+						percentage := elem.(int)
+						if percentage < 0 || percentage > 100 {
+							return make([]string, 0), []error{fmt.Errorf("min_percentage must be between 0 and 100")}
+						}
+						return make([]string, 0), make([]error, 0)
+					},
+				},
+				"stable_period": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: validateDuration,
+				},
+				"timeout": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: validateDuration,
+				},
+			},
+		},
+	}
+}
+func validateDuration(elem interface{}, index string) ([]string, []error) {
+	_, err := time.ParseDuration(elem.(string))
+	if err != nil {
+		return make([]string, 0), []error{fmt.Errorf("%s is not a valid duration: %s", index, err.Error())}
+	}
+	return make([]string, 0), make([]error, 0)
+}
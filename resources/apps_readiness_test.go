@@ -0,0 +1,67 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"time"
+)
+
+var _ = Describe("ReadinessPolicy", func() {
+	Describe("NewReadinessPolicy", func() {
+		It("should require all instances with default timeout when no readiness is set", func() {
+			resourceData := LoadCfResource(CfAppsResource{}).Data(&terraform.InstanceState{})
+
+			policy, err := NewReadinessPolicy(resourceData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(policy.DeployedAt).To(BeTemporally("~", time.Now(), time.Minute))
+			policy.DeployedAt = time.Time{}
+			Expect(policy).To(Equal(ReadinessPolicy{Timeout: DefaultReadinessTimeout}))
+			Expect(policy.RequiredInstances(3)).To(Equal(3))
+		})
+		It("should load readiness from schema", func() {
+			resourceData := LoadCfResource(CfAppsResource{}).Data(&terraform.InstanceState{})
+			err := resourceData.Set("readiness", []interface{}{
+				map[string]interface{}{
+					"min_instances":  2,
+					"min_percentage": 0,
+					"stable_period":  "30s",
+					"timeout":        "2m",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			policy, err := NewReadinessPolicy(resourceData)
+			Expect(err).ToNot(HaveOccurred())
+			policy.DeployedAt = time.Time{}
+			Expect(policy).To(Equal(ReadinessPolicy{
+				MinInstances: 2,
+				StablePeriod: 30 * time.Second,
+				Timeout:      2 * time.Minute,
+			}))
+		})
+	})
+	Describe("RequiredInstances", func() {
+		It("should never require more than total of instances", func() {
+			Expect(ReadinessPolicy{MinInstances: 5}.RequiredInstances(3)).To(Equal(3))
+			Expect(ReadinessPolicy{MinInstances: 2}.RequiredInstances(3)).To(Equal(2))
+		})
+		It("should round up percentage", func() {
+			Expect(ReadinessPolicy{MinPercentage: 50}.RequiredInstances(3)).To(Equal(2))
+			Expect(ReadinessPolicy{MinPercentage: 100}.RequiredInstances(3)).To(Equal(3))
+			Expect(ReadinessPolicy{MinPercentage: 10}.RequiredInstances(1)).To(Equal(1))
+		})
+	})
+	Describe("Remaining", func() {
+		It("should give time left before deadline of the deployment", func() {
+			policy := ReadinessPolicy{Timeout: 15 * time.Minute, DeployedAt: time.Now().Add(-10 * time.Minute)}
+			Expect(policy.Remaining()).To(BeNumerically("~", 5*time.Minute, time.Second))
+		})
+		It("should be over when deadline is reached", func() {
+			policy := ReadinessPolicy{Timeout: time.Minute, DeployedAt: time.Now().Add(-2 * time.Minute)}
+			Expect(policy.Remaining()).To(BeNumerically("<", 0))
+		})
+	})
+})
@@ -0,0 +1,136 @@
+package resources
+
+import (
+	"code.cloudfoundry.org/cli/cf/models"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/common"
+	"log"
+	"strings"
+	"time"
+)
+
+// restageKeys are attributes which need a new droplet when they change, restarting the app is not enough
+var restageKeys = []string{"buildpack", "stack_id", "diego", "docker_image", "docker_username", "docker_password"}
+
+// IsRollingRestartUpdate is true when rolling_restart is enabled and app can be updated in place by only restarting it
+func (c CfAppsResource) IsRollingRestartUpdate(d *schema.ResourceData) bool {
+	if !d.Get("rolling_restart").(bool) {
+		return false
+	}
+	for _, key := range restageKeys {
+		if d.HasChange(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// updateRollingRestart update app in place and restart instances one by one, app keeps its guid
+func (c CfAppsResource) updateRollingRestart(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(cf_client.Client)
+	appParams, err := c.resourceObject(d)
+	if err != nil {
+		return err
+	}
+	// instances are restarted by us
+	appParams.State = nil
+	app, err := client.Applications().Update(d.Id(), appParams.AppParams)
+	if err != nil {
+		return err
+	}
+	err = c.updateRoutes(d, meta, app)
+	if err != nil {
+		return err
+	}
+	currentServices := make([]string, 0)
+	if d.HasChange("services") {
+		currentTfServices, _ := d.GetChange("services")
+		currentServices = common.SchemaSetToStringList(currentTfServices.(*schema.Set))
+	}
+	err = c.BindServices(client, app, appParams.ServiceIds, currentServices)
+	if err != nil {
+		return err
+	}
+	policy, err := NewReadinessPolicy(d)
+	if err != nil {
+		return err
+	}
+	if !d.Get("started").(bool) {
+		return c.stopApp(client, app)
+	}
+	if strings.ToUpper(app.State) != stateStarted {
+		err = c.startApp(client, app, policy)
+	} else {
+		err = c.rollingRestart(client, app, policy)
+	}
+	if err != nil {
+		return fmt.Errorf("Error when trying to update the app %s in rolling restart mode: %s", d.Get("name").(string), err.Error())
+	}
+	return nil
+}
+
+// rollingRestart restart instances of a started app one index at a time,
+// next instance is restarted only when previous one is running again
+func (c CfAppsResource) rollingRestart(client cf_client.Client, app models.Application, policy ReadinessPolicy) error {
+	if app.InstanceCount == 1 {
+		log.Printf("[WARN] app %s has only one instance, it will not be available during its restart", app.Name)
+	}
+	for index := 0; index < app.InstanceCount; index++ {
+		instances, err := client.AppInstances().GetInstances(app.GUID)
+		if err != nil {
+			return err
+		}
+		var since time.Time
+		if index < len(instances) {
+			since = instances[index].Since
+		}
+		log.Printf("[INFO] restarting instance %d/%d of app %s", index+1, app.InstanceCount, app.Name)
+		err = client.AppInstances().DeleteInstance(app.GUID, index)
+		if err != nil {
+			return err
+		}
+		err = c.waitForInstanceRestart(client, app, index, since, policy)
+		if err != nil {
+			return c.createErrorFromLog(err, client, app)
+		}
+	}
+	err := c.waitForInstances(client, app, policy)
+	if err != nil {
+		return c.createErrorFromLog(err, client, app)
+	}
+	return nil
+}
+func (c CfAppsResource) waitForInstanceRestart(client cf_client.Client, app models.Application, index int, since time.Time, policy ReadinessPolicy) error {
+	var state models.InstanceState
+	var checkErr error
+	err := common.PollingWithTimeout(func() (bool, error) {
+		instances, err := client.AppInstances().GetInstances(app.GUID)
+		if err != nil {
+			checkErr = err
+			return true, err
+		}
+		if index >= len(instances) {
+			return false, nil
+		}
+		instance := instances[index]
+		state = instance.State
+		// instance still reports its state from before the restart
+		if !instance.Since.After(since) {
+			return false, nil
+		}
+		switch instance.State {
+		case models.InstanceRunning:
+			return true, nil
+		case models.InstanceCrashed, models.InstanceFlapping:
+			checkErr = fmt.Errorf("Instance %d of app %s crashed after restart%s", index, app.Name, c.crashReasons(client, app, policy.DeployedAt))
+			return true, checkErr
+		}
+		return false, nil
+	}, readinessPollingTime, policy.Remaining())
+	if err != nil && checkErr == nil {
+		return fmt.Errorf("Timeout reached after %s for instance %d of app %s to restart (state: %s)", policy.Timeout, index, app.Name, state)
+	}
+	return err
+}
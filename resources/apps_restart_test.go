@@ -0,0 +1,132 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"code.cloudfoundry.org/cli/cf/models"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"time"
+)
+
+var _ = Describe("CfAppsResource rolling restart", func() {
+	var fakeClient *fake_cf_client.FakeCfClient
+	var meta interface{}
+	var resource *schema.Resource
+	var state *terraform.InstanceState
+	var diff *terraform.InstanceDiff
+	// instances of the app, a deleted instance comes back with restartedState after startingPolls polls
+	var instances []models.AppInstanceFields
+	var restarted []int
+	var restartedState models.InstanceState
+	var startingPolls int
+	update := func() error {
+		_, err := resource.Apply(state, diff, meta)
+		return err
+	}
+	BeforeEach(func() {
+		resource = LoadCfResource(CfAppsResource{})
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		meta = fakeClient.GetClient()
+		state = &terraform.InstanceState{
+			ID: "app-guid",
+			Attributes: map[string]string{
+				"name":            "my-app",
+				"space_id":        "space-guid",
+				"stack_id":        "stack-guid",
+				"memory":          "512M",
+				"disk_quota":      "1G",
+				"instances":       "2",
+				"started":         "true",
+				"rolling_restart": "true",
+				"command":         "old-command",
+			},
+		}
+		// a change of command only needs a restart
+		diff = &terraform.InstanceDiff{Attributes: map[string]*terraform.ResourceAttrDiff{
+			"command": {Old: "old-command", New: "new-command"},
+		}}
+
+		app := models.Application{}
+		app.GUID = "app-guid"
+		app.Name = "my-app"
+		app.State = "started"
+		app.InstanceCount = 2
+		fakeClient.FakeApplications().UpdateReturns(app, nil)
+
+		startedAt := time.Now().Add(-time.Hour)
+		instances = []models.AppInstanceFields{
+			{State: models.InstanceRunning, Since: startedAt},
+			{State: models.InstanceRunning, Since: startedAt},
+		}
+		restarted = make([]int, 0)
+		restartedState = models.InstanceRunning
+		startingPolls = 0
+		polls := make(map[int]int)
+		fakeClient.FakeAppInstances().GetInstancesStub = func(appGuid string) ([]models.AppInstanceFields, error) {
+			for _, index := range restarted {
+				polls[index]++
+				if polls[index] > startingPolls {
+					instances[index].State = restartedState
+				}
+			}
+			result := make([]models.AppInstanceFields, len(instances))
+			copy(result, instances)
+			return result, nil
+		}
+		fakeClient.FakeAppInstances().DeleteInstanceStub = func(appGuid string, index int) error {
+			// previous instance must be running again before the next one is restarted
+			for _, previous := range restarted {
+				Expect(instances[previous].State).To(Equal(models.InstanceRunning))
+			}
+			restarted = append(restarted, index)
+			instances[index] = models.AppInstanceFields{State: models.InstanceStarting, Since: time.Now()}
+			return nil
+		}
+	})
+	It("should update app in place and restart instances one by one", func() {
+		Expect(update()).To(Succeed())
+
+		appGuid, params := fakeClient.FakeApplications().UpdateArgsForCall(0)
+		Expect(appGuid).To(Equal("app-guid"))
+		Expect(*params.Command).To(Equal("new-command"))
+		Expect(params.State).To(BeNil())
+
+		Expect(restarted).To(Equal([]int{0, 1}))
+		Expect(fakeClient.FakeAppInstances().DeleteInstanceCallCount()).To(Equal(2))
+		Expect(fakeClient.FakeApplications().CreateCallCount()).To(Equal(0))
+		Expect(fakeClient.FakeApplications().DeleteCallCount()).To(Equal(0))
+	})
+	It("should wait that a restarted instance is running before restarting the next one", func() {
+		startingPolls = 1
+
+		Expect(update()).To(Succeed())
+		Expect(restarted).To(Equal([]int{0, 1}))
+		// each restarted instance is seen starting before running
+		Expect(fakeClient.FakeAppInstances().GetInstancesCallCount()).To(BeNumerically(">=", 5))
+	})
+	It("should abort when a restarted instance crashes", func() {
+		restartedState = models.InstanceCrashed
+		crash := models.EventFields{Name: "app.crash", Timestamp: time.Now().Add(time.Minute), Description: "out of memory"}
+		previousCrash := models.EventFields{Name: "app.crash", Timestamp: time.Now().Add(-time.Hour), Description: "crash of a previous deployment"}
+		fakeClient.FakeAppEvents().RecentEventsReturns([]models.EventFields{crash, previousCrash}, nil)
+
+		err := update()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Instance 0 of app my-app crashed after restart"))
+		Expect(err.Error()).To(ContainSubstring("out of memory"))
+		Expect(err.Error()).ToNot(ContainSubstring("crash of a previous deployment"))
+		Expect(restarted).To(Equal([]int{0}))
+	})
+	It("should not restart instances of an app which must be stopped", func() {
+		diff.Attributes["started"] = &terraform.ResourceAttrDiff{Old: "true", New: "false"}
+
+		Expect(update()).To(Succeed())
+		Expect(fakeClient.FakeAppInstances().DeleteInstanceCallCount()).To(Equal(0))
+		_, params := fakeClient.FakeApplications().UpdateArgsForCall(1)
+		Expect(*params.State).To(Equal("STOPPED"))
+	})
+})
@@ -0,0 +1,127 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"code.cloudfoundry.org/cli/cf/models"
+	"errors"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+)
+
+var _ = Describe("CfAppsResource rolling deployment", func() {
+	var fakeClient *fake_cf_client.FakeCfClient
+	var meta interface{}
+	var resource *schema.Resource
+	var state *terraform.InstanceState
+	var diff *terraform.InstanceDiff
+	update := func() error {
+		_, err := resource.Apply(state, diff, meta)
+		return err
+	}
+	deployment := func(state string) cf_client.V3Deployment {
+		return cf_client.V3Deployment{GUID: "deployment-guid", State: state}
+	}
+	BeforeEach(func() {
+		fakeClient = fake_cf_client.NewFakeCfClient()
+		meta = fakeClient.GetClient()
+		resource = LoadCfResource(CfAppsResource{})
+		state = &terraform.InstanceState{
+			ID: "app-guid",
+			Attributes: map[string]string{
+				"name":                "my-app",
+				"space_id":            "space-guid",
+				"stack_id":            "stack-guid",
+				"memory":              "512M",
+				"disk_quota":          "1G",
+				"instances":           "2",
+				"started":             "true",
+				"deployment_strategy": "rolling",
+				"buildpack":           "old-buildpack",
+			},
+		}
+		// a configuration change restages last package and rolls out its droplet
+		diff = &terraform.InstanceDiff{Attributes: map[string]*terraform.ResourceAttrDiff{
+			"buildpack": {Old: "old-buildpack", New: "new-buildpack"},
+		}}
+
+		app := models.Application{}
+		app.GUID = "app-guid"
+		app.Name = "my-app"
+		app.State = "started"
+		fakeClient.FakeApplications().UpdateReturns(app, nil)
+		fakeClient.FakeDeployments().GetLatestPackageReturns(cf_client.V3Package{GUID: "package-guid", State: "READY"}, nil)
+		fakeClient.FakeDeployments().CreateBuildReturns(cf_client.V3Build{GUID: "build-guid"}, nil)
+		build := cf_client.V3Build{GUID: "build-guid", State: cf_client.V3BuildStateStaged}
+		build.Droplet.GUID = "droplet-guid"
+		fakeClient.FakeDeployments().GetBuildReturns(build, nil)
+		fakeClient.FakeDeployments().CreateDeploymentReturns(deployment(cf_client.V3DeploymentStateDeploying), nil)
+	})
+	It("should roll out the new droplet with a deployment", func() {
+		fakeClient.FakeDeployments().GetDeploymentReturns(deployment(cf_client.V3DeploymentStateDeployed), nil)
+
+		newState, err := resource.Apply(state, diff, meta)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(newState.ID).To(Equal("app-guid"))
+
+		appGuid, params := fakeClient.FakeApplications().UpdateArgsForCall(0)
+		Expect(appGuid).To(Equal("app-guid"))
+		Expect(params.State).To(BeNil())
+		Expect(*params.BuildpackURL).To(Equal("new-buildpack"))
+		Expect(fakeClient.FakeDeployments().CreateBuildArgsForCall(0)).To(Equal("package-guid"))
+		appGuid, dropletGuid := fakeClient.FakeDeployments().CreateDeploymentArgsForCall(0)
+		Expect(appGuid).To(Equal("app-guid"))
+		Expect(dropletGuid).To(Equal("droplet-guid"))
+		Expect(fakeClient.FakeDeployments().GetDeploymentArgsForCall(0)).To(Equal("deployment-guid"))
+		Expect(fakeClient.FakeDeployments().CancelDeploymentCallCount()).To(Equal(0))
+		Expect(fakeClient.FakeDeployments().SetCurrentDropletCallCount()).To(Equal(0))
+	})
+	It("should fail without canceling a deployment which failed", func() {
+		fakeClient.FakeDeployments().GetDeploymentReturns(deployment(cf_client.V3DeploymentStateFailed), nil)
+
+		err := update()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Deployment deployment-guid failed with state FAILED"))
+		Expect(fakeClient.FakeDeployments().CancelDeploymentCallCount()).To(Equal(0))
+		Expect(fakeClient.FakeLogs().RecentLogsForArgsForCall(0)).To(Equal("app-guid"))
+	})
+	It("should cancel the created deployment when its state cannot be polled", func() {
+		fakeClient.FakeDeployments().GetDeploymentReturns(cf_client.V3Deployment{}, errors.New("cloud controller unavailable"))
+
+		err := update()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("cloud controller unavailable"))
+		Expect(fakeClient.FakeDeployments().CancelDeploymentCallCount()).To(Equal(1))
+		Expect(fakeClient.FakeDeployments().CancelDeploymentArgsForCall(0)).To(Equal("deployment-guid"))
+	})
+	It("should report when the deployment cannot be canceled", func() {
+		fakeClient.FakeDeployments().GetDeploymentReturns(cf_client.V3Deployment{}, errors.New("cloud controller unavailable"))
+		fakeClient.FakeDeployments().CancelDeploymentReturns(errors.New("cancel refused"))
+
+		err := update()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to cancel deployment (error: cancel refused)"))
+	})
+	It("should stop waiting for staging after readiness timeout", func() {
+		state.Attributes["readiness.#"] = "1"
+		state.Attributes["readiness.0.timeout"] = "1ns"
+
+		err := update()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Timeout reached"))
+		Expect(fakeClient.FakeDeployments().CreateDeploymentCallCount()).To(Equal(0))
+	})
+	It("should set droplet as current without deployment when app is stopped", func() {
+		diff.Attributes["started"] = &terraform.ResourceAttrDiff{Old: "true", New: "false"}
+
+		Expect(update()).To(Succeed())
+		appGuid, dropletGuid := fakeClient.FakeDeployments().SetCurrentDropletArgsForCall(0)
+		Expect(appGuid).To(Equal("app-guid"))
+		Expect(dropletGuid).To(Equal("droplet-guid"))
+		Expect(fakeClient.FakeDeployments().CreateDeploymentCallCount()).To(Equal(0))
+	})
+})
@@ -0,0 +1,204 @@
+package resources
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/rewind"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	smokeTestRetryInterval = 5 * time.Second
+	// gorouter send request to this app instance when header is set, see
+	// https://docs.cloudfoundry.org/concepts/http-routing.html#app-instance-routing
+	appInstanceHeader = "X-Cf-App-Instance"
+)
+
+// SmokeTest check that a freshly deployed app really serves traffic before the old app is deleted
+type SmokeTest struct {
+	URL            string
+	ExpectedStatus int
+	BodyRegex      *regexp.Regexp
+	Retries        int
+	Timeout        time.Duration
+	RetryInterval  time.Duration
+}
+
+// NewSmokeTest load smoke test from schema, it returns nil if no smoke test is defined
+func NewSmokeTest(d *schema.ResourceData, meta interface{}) (*SmokeTest, error) {
+	smokeTestList := d.Get("smoke_test").([]interface{})
+	if len(smokeTestList) == 0 || smokeTestList[0] == nil {
+		return nil, nil
+	}
+	smokeTestMap := smokeTestList[0].(map[string]interface{})
+	smokeTest := &SmokeTest{
+		URL:            smokeTestMap["url"].(string),
+		ExpectedStatus: smokeTestMap["expected_status"].(int),
+		Retries:        smokeTestMap["retries"].(int),
+		RetryInterval:  smokeTestRetryInterval,
+	}
+	if routeId := smokeTestMap["route_id"].(string); routeId != "" {
+		client := meta.(cf_client.Client)
+		route, err := client.Finder().GetRouteFromCf(routeId)
+		if err != nil {
+			return nil, err
+		}
+		if route.GUID == "" {
+			return nil, fmt.Errorf("Route %s for smoke test cannot be found", routeId)
+		}
+		smokeTest.URL = "https://" + route.URL()
+	}
+	if smokeTest.URL == "" {
+		return nil, fmt.Errorf("One of url or route_id must be set in smoke_test")
+	}
+	if path := smokeTestMap["path"].(string); path != "" {
+		smokeTest.URL = strings.TrimSuffix(smokeTest.URL, "/") + "/" + strings.TrimPrefix(path, "/")
+	}
+	var err error
+	if bodyRegex := smokeTestMap["body_regex"].(string); bodyRegex != "" {
+		smokeTest.BodyRegex, err = regexp.Compile(bodyRegex)
+		if err != nil {
+			return nil, err
+		}
+	}
+	smokeTest.Timeout, err = time.ParseDuration(smokeTestMap["timeout"].(string))
+	if err != nil {
+		return nil, err
+	}
+	return smokeTest, nil
+}
+
+// Run call url until it gives expected response or retries are exhausted,
+// requests are sent to the first instance of the given app when they pass through gorouter.
+func (s SmokeTest) Run(appGuid string, skipInsecureSSL bool) error {
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: skipInsecureSSL},
+		},
+		Timeout: s.Timeout,
+	}
+	var err error
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(s.RetryInterval)
+		}
+		err = s.check(httpClient, appGuid)
+		if err == nil {
+			return nil
+		}
+		log.Printf("[INFO] smoke test on %s failed (attempt %d/%d): %s", s.URL, attempt+1, s.Retries+1, err.Error())
+	}
+	return fmt.Errorf("Smoke test on %s failed after %d attempt(s): %s", s.URL, s.Retries+1, err.Error())
+}
+func (s SmokeTest) check(httpClient *http.Client, appGuid string) error {
+	req, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(appInstanceHeader, appGuid+":0")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != s.ExpectedStatus {
+		return fmt.Errorf("status code %d received, %d expected", resp.StatusCode, s.ExpectedStatus)
+	}
+	if s.BodyRegex == nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if !s.BodyRegex.Match(body) {
+		return fmt.Errorf("body doesn't match regex '%s'", s.BodyRegex.String())
+	}
+	return nil
+}
+
+// runSmokeTest is a no-op when no smoke test is defined
+func (c CfAppsResource) runSmokeTest(d *schema.ResourceData, meta interface{}) error {
+	smokeTest, err := NewSmokeTest(d, meta)
+	if err != nil {
+		return err
+	}
+	if smokeTest == nil {
+		return nil
+	}
+	client := meta.(cf_client.Client)
+	return smokeTest.Run(d.Id(), client.Config().SkipInsecureSSL)
+}
+func smokeTestSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"url": &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					ConflictsWith: []string{"smoke_test.0.route_id"},
+				},
+				"route_id": &schema.Schema{
+					Type:          schema.TypeString,
+					Optional:      true,
+					ConflictsWith: []string{"smoke_test.0.url"},
+				},
+				"path": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"expected_status": &schema.Schema{
+					Type:     schema.TypeInt,
+					Optional: true,
+					Default:  http.StatusOK,
+				},
+				"body_regex": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					ValidateFunc: func(elem interface{}, index string) ([]string, []error) {
+						_, err := regexp.Compile(elem.(string))
+						if err != nil {
+							return make([]string, 0), []error{fmt.Errorf("%s is not a valid regex: %s", index, err.Error())}
+						}
+						return make([]string, 0), make([]error, 0)
+					},
+				},
+				"retries": &schema.Schema{
+					Type:     schema.TypeInt,
+					Optional: true,
+					Default:  3,
+				},
+				"timeout": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "10s",
+					ValidateFunc: validateDuration,
+				},
+			},
+		},
+	}
+}
+
+// smokeTestAction run smoke test on started app before old app is deleted
+func (c CfAppsResource) smokeTestAction(d *schema.ResourceData, meta interface{}) rewind.Action {
+	return rewind.Action{
+		Name: "smoke test",
+		Forward: func() error {
+			if !d.Get("started").(bool) {
+				return nil
+			}
+			return c.runSmokeTest(d, meta)
+		},
+	}
+}
@@ -0,0 +1,107 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	"fmt"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"time"
+)
+
+var _ = Describe("SmokeTest", func() {
+	Describe("NewSmokeTest", func() {
+		It("should give no smoke test when not set", func() {
+			resourceData := LoadCfResource(CfAppsResource{}).Data(&terraform.InstanceState{})
+
+			smokeTest, err := NewSmokeTest(resourceData, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(smokeTest).To(BeNil())
+		})
+		It("should load smoke test from schema", func() {
+			resourceData := LoadCfResource(CfAppsResource{}).Data(&terraform.InstanceState{})
+			err := resourceData.Set("smoke_test", []interface{}{
+				map[string]interface{}{
+					"url":             "https://my-app.example.com/",
+					"route_id":        "",
+					"path":            "/health",
+					"expected_status": 204,
+					"body_regex":      "",
+					"retries":         2,
+					"timeout":         "3s",
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			smokeTest, err := NewSmokeTest(resourceData, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(smokeTest.URL).To(Equal("https://my-app.example.com/health"))
+			Expect(smokeTest.ExpectedStatus).To(Equal(204))
+			Expect(smokeTest.Retries).To(Equal(2))
+			Expect(smokeTest.Timeout).To(Equal(3 * time.Second))
+			Expect(smokeTest.BodyRegex).To(BeNil())
+		})
+	})
+	Describe("Run", func() {
+		var server *httptest.Server
+		var calls int
+		var appInstances []string
+		BeforeEach(func() {
+			calls = 0
+			appInstances = make([]string, 0)
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+				appInstances = append(appInstances, req.Header.Get("X-Cf-App-Instance"))
+				if calls < 2 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				fmt.Fprint(w, `{"status": "UP"}`)
+			}))
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should retry until app answers as expected", func() {
+			smokeTest := SmokeTest{
+				URL:            server.URL,
+				ExpectedStatus: http.StatusOK,
+				BodyRegex:      regexp.MustCompile(`"status":\s*"UP"`),
+				Retries:        2,
+				Timeout:        time.Second,
+			}
+			err := smokeTest.Run("app-guid", false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(calls).To(Equal(2))
+			Expect(appInstances).To(Equal([]string{"app-guid:0", "app-guid:0"}))
+		})
+		It("should fail when body doesn't match after all retries", func() {
+			smokeTest := SmokeTest{
+				URL:            server.URL,
+				ExpectedStatus: http.StatusOK,
+				BodyRegex:      regexp.MustCompile(`DOWN`),
+				Retries:        2,
+				Timeout:        time.Second,
+			}
+			err := smokeTest.Run("app-guid", false)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed after 3 attempt(s)"))
+			Expect(err.Error()).To(ContainSubstring("body doesn't match regex"))
+			Expect(calls).To(Equal(3))
+		})
+		It("should fail on unexpected status when no retries are left", func() {
+			smokeTest := SmokeTest{
+				URL:            server.URL,
+				ExpectedStatus: http.StatusOK,
+				Timeout:        time.Second,
+			}
+			err := smokeTest.Run("app-guid", false)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("status code 502 received, 200 expected"))
+		})
+	})
+})
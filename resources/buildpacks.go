@@ -4,9 +4,13 @@ import (
 	"code.cloudfoundry.org/cli/cf/errors"
 	"code.cloudfoundry.org/cli/cf/models"
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/bitsmanager"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/common"
+	"io"
+	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -64,7 +68,7 @@ func (c CfBuildpackResource) Create(d *schema.ResourceData, meta interface{}) er
 	if c.isSystemBuildpackManaged(buildpack) {
 		return nil
 	}
-	return c.updateBuildpack(client, buildpackCf, buildpack, d.Get("path").(string))
+	return c.updateBuildpack(client, buildpackCf, buildpack, d)
 }
 
 func (c CfBuildpackResource) Exists(d *schema.ResourceData, meta interface{}) (bool, error) {
@@ -94,6 +98,13 @@ func (c CfBuildpackResource) generateFilename(buildpackPath string) (string, err
 	if common.IsWebURL(buildpackPath) {
 		return path.Base(buildpackPath), nil
 	}
+	if (bitsmanager.S3Handler{}).Detect(buildpackPath) {
+		u, err := url.Parse(buildpackPath)
+		if err != nil {
+			return "", err
+		}
+		return path.Base(u.Path), nil
+	}
 	buildpackFileName := filepath.Base(buildpackPath)
 	dir, err := filepath.Abs(buildpackPath)
 	if err != nil {
@@ -137,6 +148,15 @@ func (c CfBuildpackResource) Read(d *schema.ResourceData, meta interface{}) erro
 	if bp.Filename != buildpack.Filename && d.Get("path").(string) != "" {
 		d.Set("path", buildpack.Filename)
 	}
+	pathSha1, err := c.pathSha1(client, d.Get("path").(string))
+	if err != nil {
+		return err
+	}
+	if pathSha1 != d.Get("path_sha1").(string) {
+		log.Printf("[INFO] buildpack %s changed in s3 (%s), it will be uploaded again", name, pathSha1)
+		// path is shown as changed to upload the object again
+		d.Set("path", buildpack.Filename)
+	}
 	d.Set("position", *buildpack.Position)
 	d.Set("enabled", *buildpack.Enabled)
 	d.Set("locked", *buildpack.Locked)
@@ -169,9 +189,12 @@ func (c CfBuildpackResource) Update(d *schema.ResourceData, meta interface{}) er
 		d.SetId("")
 		return nil
 	}
-	return c.updateBuildpack(client, buildpackCf, buildpack, d.Get("path").(string))
+	return c.updateBuildpack(client, buildpackCf, buildpack, d)
 }
-func (c CfBuildpackResource) updateBuildpack(client cf_client.Client, buildpackFrom, buildpackTo models.Buildpack, buildpackPath string) error {
+
+// updateBuildpack upload buildpack bits when filename changed or when the object in s3 changed since last upload
+// (path_sha1 keeps its version id, or its ETag when bucket is not versioned)
+func (c CfBuildpackResource) updateBuildpack(client cf_client.Client, buildpackFrom, buildpackTo models.Buildpack, d *schema.ResourceData) error {
 	var err error
 	if buildpackTo.Locked != buildpackFrom.Locked ||
 		buildpackTo.Enabled != buildpackFrom.Enabled ||
@@ -186,8 +209,18 @@ func (c CfBuildpackResource) updateBuildpack(client cf_client.Client, buildpackF
 	if buildpackTo.Filename == "" {
 		return nil
 	}
-	if buildpackTo.Filename != buildpackFrom.Filename {
-		file, _, err := client.BuildpackBits().CreateBuildpackZipFile(buildpackPath)
+	buildpackPath := d.Get("path").(string)
+	pathSha1, err := c.pathSha1(client, buildpackPath)
+	if err != nil {
+		return err
+	}
+	if buildpackTo.Filename != buildpackFrom.Filename || pathSha1 != d.Get("path_sha1").(string) {
+		localPath, cleanFunc, err := c.localBuildpackPath(client, buildpackPath, buildpackTo.Filename)
+		if err != nil {
+			return err
+		}
+		defer cleanFunc()
+		file, _, err := client.BuildpackBits().CreateBuildpackZipFile(localPath)
 		if err != nil {
 			return err
 		}
@@ -195,9 +228,64 @@ func (c CfBuildpackResource) updateBuildpack(client cf_client.Client, buildpackF
 		if err != nil {
 			return err
 		}
+		d.Set("path_sha1", pathSha1)
 	}
 	return nil
 }
+func (c CfBuildpackResource) s3Handler(client cf_client.Client) *bitsmanager.S3Handler {
+	return bitsmanager.NewS3Handler(
+		client.Config().SkipInsecureSSL,
+		client.Config().S3Config(),
+		bitsmanager.NewBitsCache(client.Config().BitsCacheDir),
+		bitsmanager.NewArtifactVerifier("", client.Config().ArtifactPublicKey),
+		bitsmanager.FileFilter{},
+	)
+}
+
+// pathSha1 give fingerprint of a buildpack stored in s3 without downloading it, it is empty for other paths
+// as their changes are detected by filename
+func (c CfBuildpackResource) pathSha1(client cf_client.Client, buildpackPath string) (string, error) {
+	handler := c.s3Handler(client)
+	if !handler.Detect(buildpackPath) {
+		return "", nil
+	}
+	return handler.GetSha1File(buildpackPath)
+}
+
+// localBuildpackPath download a buildpack stored in s3 in a temporary folder (its signature <key>.asc is checked
+// when artifact_public_key is set), other paths are given as is
+func (c CfBuildpackResource) localBuildpackPath(client cf_client.Client, buildpackPath, filename string) (string, func() error, error) {
+	handler := c.s3Handler(client)
+	if !handler.Detect(buildpackPath) {
+		return buildpackPath, func() error { return nil }, nil
+	}
+	fileHandler, err := handler.GetZipFile(buildpackPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer fileHandler.Clean()
+	defer fileHandler.ZipFile.Close()
+	tmpDir, err := ioutil.TempDir("", "buildpack-s3")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanFunc := func() error {
+		return os.RemoveAll(tmpDir)
+	}
+	localPath := filepath.Join(tmpDir, filename)
+	file, err := os.Create(localPath)
+	if err != nil {
+		cleanFunc()
+		return "", nil, err
+	}
+	defer file.Close()
+	_, err = io.Copy(file, fileHandler.ZipFile)
+	if err != nil {
+		cleanFunc()
+		return "", nil, err
+	}
+	return localPath, cleanFunc, nil
+}
 func (c CfBuildpackResource) Delete(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(cf_client.Client)
 	bp, err := c.resourceObject(d)
@@ -221,6 +309,10 @@ func (c CfBuildpackResource) Schema() map[string]*schema.Schema {
 			Type:     schema.TypeString,
 			Optional: true,
 		},
+		"path_sha1": &schema.Schema{
+			Type:     schema.TypeString,
+			Computed: true,
+		},
 		"position": &schema.Schema{
 			Type:     schema.TypeInt,
 			Optional: true,
@@ -10,7 +10,10 @@ import (
 	"github.com/hashicorp/terraform/terraform"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client"
 	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/cf_client/fake_cf_client"
+	"net/http"
+	"net/http/httptest"
 )
 
 var _ = Describe("Buildpacks", func() {
@@ -224,4 +227,85 @@ var _ = Describe("Buildpacks", func() {
 		})
 	})
 
+	Describe("with a buildpack in s3", func() {
+		var server *httptest.Server
+		var etag string
+		var state *terraform.InstanceState
+		position := 1
+		enabled := true
+		locked := false
+		BeforeEach(func() {
+			etag = `"etag-1"`
+			// stand-in of s3 giving the version asked or the ETag of a non versioned object
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.URL.Path).To(Equal("/bucket/bp.zip"))
+				if versionId := req.URL.Query().Get("versionId"); versionId != "" {
+					w.Header().Set("x-amz-version-id", versionId)
+				}
+				w.Header().Set("ETag", etag)
+				w.Write([]byte("buildpack content"))
+			}))
+			fakeClient.SetConfig(cf_client.Config{
+				S3AccessKeyID:     "AKIDEXAMPLE",
+				S3SecretAccessKey: "secret",
+				S3Endpoint:        server.URL,
+				S3PathStyle:       true,
+			})
+			fakeClient.FakeFinder().GetBuildpackFromCfReturns(models.Buildpack{
+				GUID:     "1",
+				Name:     "aBuildpack",
+				Position: &position,
+				Enabled:  &enabled,
+				Locked:   &locked,
+				Filename: "bp.zip",
+			}, nil)
+			state = &terraform.InstanceState{
+				ID: "1",
+				Attributes: map[string]string{
+					"name":      "aBuildpack",
+					"path":      "s3://bucket/bp.zip?versionId=v1",
+					"path_sha1": "s3-version:v1",
+					"position":  "1",
+					"enabled":   "true",
+					"locked":    "false",
+				},
+			}
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should upload buildpack again when another version is asked", func() {
+			diff := &terraform.InstanceDiff{Attributes: map[string]*terraform.ResourceAttrDiff{
+				"path": {Old: "s3://bucket/bp.zip?versionId=v1", New: "s3://bucket/bp.zip?versionId=v2"},
+			}}
+			newState, err := resource.Apply(state, diff, meta)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.FakeBuildpackBits().UploadBuildpackCallCount()).To(Equal(1))
+			_, _, filename := fakeClient.FakeBuildpackBits().UploadBuildpackArgsForCall(0)
+			Expect(filename).To(Equal("bp.zip"))
+			Expect(newState.Attributes["path_sha1"]).To(Equal("s3-version:v2"))
+		})
+		It("should not upload buildpack again when the object didn't change", func() {
+			diff := &terraform.InstanceDiff{Attributes: map[string]*terraform.ResourceAttrDiff{
+				"position": {Old: "1", New: "2"},
+			}}
+			_, err := resource.Apply(state, diff, meta)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fakeClient.FakeBuildpack().UpdateCallCount()).To(Equal(1))
+			Expect(fakeClient.FakeBuildpackBits().UploadBuildpackCallCount()).To(Equal(0))
+		})
+		It("should show a change when the object was replaced in a non versioned bucket", func() {
+			state.Attributes["path"] = "s3://bucket/bp.zip"
+			state.Attributes["path_sha1"] = "etag:etag-1"
+			resourceData := resource.Data(state)
+			Expect(resource.Read(resourceData, meta)).To(Succeed())
+			Expect(resourceData.Get("path")).To(Equal("s3://bucket/bp.zip"))
+
+			etag = `"etag-2"`
+			Expect(resource.Read(resourceData, meta)).To(Succeed())
+			Expect(resourceData.Get("path")).To(Equal("bp.zip"))
+		})
+	})
 })
@@ -1,6 +1,9 @@
 package resources
 
-import "github.com/hashicorp/terraform/helper/schema"
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
 
 type CfResource interface {
 	Create(*schema.ResourceData, interface{}) error
@@ -10,13 +13,25 @@ type CfResource interface {
 	Exists(*schema.ResourceData, interface{}) (bool, error)
 	Schema() map[string]*schema.Schema
 }
+
+// CfResourceDiffCustomizer can be implemented by a resource to alter its plan (see schema.CustomizeDiffFunc)
+type CfResourceDiffCustomizer interface {
+	CustomizeDiff(*schema.ResourceDiff, interface{}) error
+}
+
+// CfResourceStateMigrator can be implemented by a resource which changed the format of its state,
+// MigrateState receives states recorded with a schema version lower than SchemaVersion
+type CfResourceStateMigrator interface {
+	SchemaVersion() int
+	MigrateState(int, *terraform.InstanceState, interface{}) (*terraform.InstanceState, error)
+}
 type CfDataSource interface {
 	DataSourceSchema() map[string]*schema.Schema
 	DataSourceRead(*schema.ResourceData, interface{}) error
 }
 
 func LoadCfResource(cfResource CfResource) *schema.Resource {
-	return &schema.Resource{
+	resource := &schema.Resource{
 		Create: cfResource.Create,
 		Read:   cfResource.Read,
 		Update: cfResource.Update,
@@ -24,6 +39,14 @@ func LoadCfResource(cfResource CfResource) *schema.Resource {
 		Exists: cfResource.Exists,
 		Schema: cfResource.Schema(),
 	}
+	if diffCustomizer, ok := cfResource.(CfResourceDiffCustomizer); ok {
+		resource.CustomizeDiff = diffCustomizer.CustomizeDiff
+	}
+	if stateMigrator, ok := cfResource.(CfResourceStateMigrator); ok {
+		resource.SchemaVersion = stateMigrator.SchemaVersion()
+		resource.MigrateState = stateMigrator.MigrateState
+	}
+	return resource
 }
 func LoadCfDataSource(cfDataSource CfDataSource) *schema.Resource {
 	return &schema.Resource{
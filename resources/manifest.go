@@ -0,0 +1,190 @@
+package resources
+
+import (
+	"fmt"
+	"github.com/viant/toolbox"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var manifestVarRegex = regexp.MustCompile(`\(\(([-/\.\w]+)\)\)`)
+
+type ManifestRoute struct {
+	Route string `yaml:"route"`
+}
+type ManifestDocker struct {
+	Image    string `yaml:"image"`
+	Username string `yaml:"username"`
+}
+
+// ManifestApp follow the cf manifest schema as described in https://docs.cloudfoundry.org/devguide/deploy-apps/manifest.html
+type ManifestApp struct {
+	Name                    string                 `yaml:"name"`
+	Buildpack               string                 `yaml:"buildpack"`
+	Buildpacks              []string               `yaml:"buildpacks"`
+	Command                 string                 `yaml:"command"`
+	DiskQuota               string                 `yaml:"disk_quota"`
+	Docker                  ManifestDocker         `yaml:"docker"`
+	Env                     map[string]interface{} `yaml:"env"`
+	HealthCheckType         string                 `yaml:"health-check-type"`
+	HealthCheckHTTPEndpoint string                 `yaml:"health-check-http-endpoint"`
+	Timeout                 int                    `yaml:"timeout"`
+	Instances               *int                   `yaml:"instances"`
+	Memory                  string                 `yaml:"memory"`
+	NoRoute                 bool                   `yaml:"no-route"`
+	Path                    string                 `yaml:"path"`
+	Routes                  []ManifestRoute        `yaml:"routes"`
+	Services                []string               `yaml:"services"`
+	Stack                   string                 `yaml:"stack"`
+}
+type AppManifest struct {
+	Applications []ManifestApp `yaml:"applications"`
+	// global attributes are deprecated by cloud foundry but still used in a lot of manifests
+	ManifestApp `yaml:",inline"`
+}
+
+// ParseAppManifest read a cf manifest, replace all ((var)) by values from vars
+// and give back all applications with global attributes merged and path made absolute
+func ParseAppManifest(manifestPath string, vars map[string]string) (AppManifest, error) {
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return AppManifest{}, err
+	}
+	content, err = interpolateManifest(content, vars)
+	if err != nil {
+		return AppManifest{}, err
+	}
+	var manifest AppManifest
+	err = yaml.Unmarshal(content, &manifest)
+	if err != nil {
+		return AppManifest{}, fmt.Errorf("Manifest '%s' is not valid: %s", manifestPath, err.Error())
+	}
+	if len(manifest.Applications) == 0 {
+		return AppManifest{}, fmt.Errorf("Manifest '%s' doesn't contain any application", manifestPath)
+	}
+	manifestDir, err := filepath.Abs(filepath.Dir(manifestPath))
+	if err != nil {
+		return AppManifest{}, err
+	}
+	names := make(map[string]bool)
+	for i, app := range manifest.Applications {
+		if app.Name == "" {
+			return AppManifest{}, fmt.Errorf("Application at index %d in manifest '%s' doesn't have a name", i, manifestPath)
+		}
+		if names[app.Name] {
+			return AppManifest{}, fmt.Errorf("Application '%s' is defined more than once in manifest '%s'", app.Name, manifestPath)
+		}
+		names[app.Name] = true
+		app = manifest.mergeGlobal(app)
+		if len(app.Buildpacks) > 1 {
+			return AppManifest{}, fmt.Errorf("Application '%s' use multiple buildpacks which is not supported", app.Name)
+		}
+		if len(app.Buildpacks) == 1 && app.Buildpack == "" {
+			app.Buildpack = app.Buildpacks[0]
+		}
+		app.Path = resolveManifestAppPath(manifestDir, app.Path)
+		manifest.Applications[i] = app
+	}
+	return manifest, nil
+}
+func (m AppManifest) mergeGlobal(app ManifestApp) ManifestApp {
+	global := m.ManifestApp
+	if app.Buildpack == "" && len(app.Buildpacks) == 0 {
+		app.Buildpack = global.Buildpack
+		app.Buildpacks = global.Buildpacks
+	}
+	if app.Command == "" {
+		app.Command = global.Command
+	}
+	if app.DiskQuota == "" {
+		app.DiskQuota = global.DiskQuota
+	}
+	if app.Docker.Image == "" {
+		app.Docker = global.Docker
+	}
+	if app.HealthCheckType == "" {
+		app.HealthCheckType = global.HealthCheckType
+	}
+	if app.HealthCheckHTTPEndpoint == "" {
+		app.HealthCheckHTTPEndpoint = global.HealthCheckHTTPEndpoint
+	}
+	if app.Timeout == 0 {
+		app.Timeout = global.Timeout
+	}
+	if app.Instances == nil {
+		app.Instances = global.Instances
+	}
+	if app.Memory == "" {
+		app.Memory = global.Memory
+	}
+	if !app.NoRoute {
+		app.NoRoute = global.NoRoute
+	}
+	if app.Path == "" {
+		app.Path = global.Path
+	}
+	if len(app.Routes) == 0 {
+		app.Routes = global.Routes
+	}
+	if app.Stack == "" {
+		app.Stack = global.Stack
+	}
+	services := append([]string{}, global.Services...)
+	for _, service := range app.Services {
+		if !toolbox.HasSliceAnyElements(services, service) {
+			services = append(services, service)
+		}
+	}
+	app.Services = services
+	env := make(map[string]interface{})
+	for key, value := range global.Env {
+		env[key] = value
+	}
+	for key, value := range app.Env {
+		env[key] = value
+	}
+	app.Env = env
+	return app
+}
+
+// EnvAsString give env in the form of a map of strings as cloud controller will store it
+func (a ManifestApp) EnvAsString() map[string]string {
+	env := make(map[string]string)
+	for key, value := range a.Env {
+		env[key] = fmt.Sprint(value)
+	}
+	return env
+}
+func resolveManifestAppPath(manifestDir, appPath string) string {
+	if appPath == "" {
+		return manifestDir
+	}
+	// urls (e.g.: http://, ssh://, s3://, maven://) are kept as is for bits manager
+	if strings.Contains(appPath, "://") || strings.HasPrefix(appPath, "git@") || filepath.IsAbs(appPath) {
+		return appPath
+	}
+	return filepath.Join(manifestDir, appPath)
+}
+func interpolateManifest(content []byte, vars map[string]string) ([]byte, error) {
+	missing := make([]string, 0)
+	result := manifestVarRegex.ReplaceAllFunc(content, func(match []byte) []byte {
+		name := string(manifestVarRegex.FindSubmatch(match)[1])
+		value, ok := vars[name]
+		if !ok {
+			if !toolbox.HasSliceAnyElements(missing, name) {
+				missing = append(missing, name)
+			}
+			return match
+		}
+		return []byte(value)
+	})
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("Expected to find variables: %s", strings.Join(missing, ", "))
+	}
+	return result, nil
+}
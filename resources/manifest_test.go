@@ -0,0 +1,153 @@
+package resources_test
+
+import (
+	. "github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/resources"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Manifest", func() {
+	var manifestDir string
+	var manifestPath string
+	writeManifest := func(content string) {
+		err := ioutil.WriteFile(manifestPath, []byte(content), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	}
+	BeforeEach(func() {
+		var err error
+		manifestDir, err = ioutil.TempDir("", "manifest")
+		Expect(err).ToNot(HaveOccurred())
+		manifestPath = filepath.Join(manifestDir, "manifest.yml")
+	})
+	AfterEach(func() {
+		os.RemoveAll(manifestDir)
+	})
+	Describe("ParseAppManifest", func() {
+		It("should parse applications and replace variables", func() {
+			writeManifest(`---
+applications:
+- name: ((app_name))
+  instances: ((instances))
+  memory: 64M
+  buildpacks:
+  - php_buildpack
+  path: ./app
+  routes:
+  - route: myapp.((domain))
+  services:
+  - db
+  env:
+    KEY: ((value))
+    DEBUG: true
+  health-check-type: http
+  health-check-http-endpoint: /health
+  timeout: 60
+`)
+			manifest, err := ParseAppManifest(manifestPath, map[string]string{
+				"app_name":  "myapp",
+				"instances": "2",
+				"domain":    "example.com",
+				"value":     "myvalue",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest.Applications).To(HaveLen(1))
+			app := manifest.Applications[0]
+			Expect(app.Name).To(Equal("myapp"))
+			Expect(*app.Instances).To(Equal(2))
+			Expect(app.Memory).To(Equal("64M"))
+			Expect(app.Buildpack).To(Equal("php_buildpack"))
+			Expect(app.Path).To(Equal(filepath.Join(manifestDir, "app")))
+			Expect(app.Routes).To(Equal([]ManifestRoute{{Route: "myapp.example.com"}}))
+			Expect(app.Services).To(Equal([]string{"db"}))
+			Expect(app.EnvAsString()).To(Equal(map[string]string{"KEY": "myvalue", "DEBUG": "true"}))
+			Expect(app.HealthCheckType).To(Equal("http"))
+			Expect(app.HealthCheckHTTPEndpoint).To(Equal("/health"))
+			Expect(app.Timeout).To(Equal(60))
+		})
+		It("should merge global attributes in each application", func() {
+			writeManifest(`---
+memory: 128M
+services:
+- db
+env:
+  GLOBAL: global
+applications:
+- name: app1
+  services:
+  - cache
+- name: app2
+  memory: 256M
+  path: https://example.com/app.zip
+  env:
+    GLOBAL: overridden
+`)
+			manifest, err := ParseAppManifest(manifestPath, map[string]string{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest.Applications).To(HaveLen(2))
+
+			Expect(manifest.Applications[0].Memory).To(Equal("128M"))
+			Expect(manifest.Applications[0].Services).To(Equal([]string{"db", "cache"}))
+			Expect(manifest.Applications[0].EnvAsString()).To(Equal(map[string]string{"GLOBAL": "global"}))
+			Expect(manifest.Applications[0].Path).To(Equal(manifestDir))
+
+			Expect(manifest.Applications[1].Memory).To(Equal("256M"))
+			Expect(manifest.Applications[1].Path).To(Equal("https://example.com/app.zip"))
+			Expect(manifest.Applications[1].EnvAsString()).To(Equal(map[string]string{"GLOBAL": "overridden"}))
+		})
+		for _, appPath := range []string{
+			"http://example.com/app.zip",
+			"https://example.com/app.zip",
+			"ssh://git@example.com/org/app.git",
+			"file:///tmp/app.zip",
+			"s3://bucket/app.zip",
+			"maven://com.example:app:1.0.0:zip",
+			"git@example.com:org/app.git",
+		} {
+			appPath := appPath
+			It("should keep path "+appPath+" as is", func() {
+				writeManifest(`---
+applications:
+- name: myapp
+  path: ` + appPath + `
+`)
+				manifest, err := ParseAppManifest(manifestPath, map[string]string{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(manifest.Applications[0].Path).To(Equal(appPath))
+			})
+		}
+		It("should return an error when variables are missing", func() {
+			writeManifest(`---
+applications:
+- name: ((app_name))
+  memory: ((memory))
+`)
+			_, err := ParseAppManifest(manifestPath, map[string]string{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("app_name, memory"))
+		})
+		It("should return an error when an application is defined twice", func() {
+			writeManifest(`---
+applications:
+- name: myapp
+- name: myapp
+`)
+			_, err := ParseAppManifest(manifestPath, map[string]string{})
+			Expect(err).To(HaveOccurred())
+		})
+		It("should return an error when multiple buildpacks are used", func() {
+			writeManifest(`---
+applications:
+- name: myapp
+  buildpacks:
+  - go_buildpack
+  - binary_buildpack
+`)
+			_, err := ParseAppManifest(manifestPath, map[string]string{})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -203,39 +203,154 @@ See the License for the specific language governing permissions and
 limitations under the License.*/
 package rewind
 
-import "fmt"
-
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Actions is a saga: actions are run in order and, when one of them fails,
+// actions already completed are reversed in reverse order.
 type Actions struct {
 	Actions []Action
 
 	RewindFailureMessage string
+	// OnStepCompleted is called after each action successfully run, it can be used to record progress
+	OnStepCompleted func(step int, action Action)
+}
+
+type Action struct {
+	// Name is used in errors, step number is used when empty
+	Name    string
+	Forward func() error
+	// Reverse undo this action after it has been completed, it is called when a later action fails
+	Reverse func() error
+	// ReversePrevious is called when Forward of this action fails, it must clean what Forward has partially done
+	ReversePrevious func() error
+	// Timeout of Forward, no timeout when 0. Forward which didn't return before its timeout is failed
+	// and rewind starts, Forward is left running in background.
+	Timeout time.Duration
+}
+
+// StepError is an error which occurred when running a step
+type StepError struct {
+	Step int
+	Name string
+	Err  error
+}
+
+func (e StepError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err.Error())
+}
+
+// Error is given when an action failed, it contains error which triggered the rewind and all errors which
+// occurred during rewind.
+// Steps are indexes in actions list.
+type Error struct {
+	Message        string
+	ForwardError   StepError
+	CompletedSteps []int
+	ReversedSteps  []int
+	RewindErrors   []StepError
+}
+
+func (e *Error) Error() string {
+	if len(e.RewindErrors) == 0 {
+		return e.ForwardError.Err.Error()
+	}
+	rewindErrs := make([]string, len(e.RewindErrors))
+	for i, rewindErr := range e.RewindErrors {
+		rewindErrs[i] = "rewind of " + rewindErr.Error()
+	}
+	msg := strings.Join(rewindErrs, ", ")
+	if e.Message != "" {
+		msg = e.Message + ": " + msg
+	}
+	return fmt.Sprintf("%s (rewind was triggered by error on %s)", msg, e.ForwardError.Error())
 }
 
 func (actions Actions) Execute() error {
-	for _, action := range actions.Actions {
-		err := action.Forward()
-		if err != nil {
-			if action.ReversePrevious == nil {
-				return err
-			}
+	return actions.ExecuteContext(context.Background())
+}
 
-			reverseError := action.ReversePrevious()
-			if reverseError != nil {
-				if actions.RewindFailureMessage != "" {
-					return fmt.Errorf("%s: %s", actions.RewindFailureMessage, reverseError)
-				} else {
-					return reverseError
-				}
+// ExecuteContext run actions until context is done, a canceled context stops actions and completed ones are reversed.
+// Running action is not waited for: it is failed as soon as context is done and its ReversePrevious is called.
+// Reverse functions are always run until the end, even if context is done.
+func (actions Actions) ExecuteContext(ctx context.Context) error {
+	completed := make([]int, 0)
+	for i, action := range actions.Actions {
+		err := ctx.Err()
+		forwardRun := err == nil
+		if forwardRun {
+			err = runStep(ctx, action.Forward, action.Timeout)
+		}
+		if err == nil {
+			completed = append(completed, i)
+			if actions.OnStepCompleted != nil {
+				actions.OnStepCompleted(i, action)
 			}
-
-			return err
+			continue
 		}
+		return actions.rewind(i, err, forwardRun, completed)
 	}
-
 	return nil
 }
+func (actions Actions) rewind(failedStep int, forwardErr error, forwardRun bool, completed []int) error {
+	rewindErr := &Error{
+		Message:        actions.RewindFailureMessage,
+		ForwardError:   actions.stepError(failedStep, forwardErr),
+		CompletedSteps: completed,
+		ReversedSteps:  make([]int, 0),
+		RewindErrors:   make([]StepError, 0),
+	}
+	failedAction := actions.Actions[failedStep]
+	if forwardRun && failedAction.ReversePrevious != nil {
+		err := failedAction.ReversePrevious()
+		if err != nil {
+			rewindErr.RewindErrors = append(rewindErr.RewindErrors, actions.stepError(failedStep, err))
+		}
+	}
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := completed[i]
+		action := actions.Actions[step]
+		if action.Reverse == nil {
+			continue
+		}
+		err := action.Reverse()
+		if err != nil {
+			rewindErr.RewindErrors = append(rewindErr.RewindErrors, actions.stepError(step, err))
+			continue
+		}
+		rewindErr.ReversedSteps = append(rewindErr.ReversedSteps, step)
+	}
+	return rewindErr
+}
+func (actions Actions) stepError(step int, err error) StepError {
+	name := actions.Actions[step].Name
+	if name == "" {
+		name = fmt.Sprintf("step %d", step+1)
+	}
+	return StepError{Step: step, Name: name, Err: err}
+}
 
-type Action struct {
-	Forward         func() error
-	ReversePrevious func() error
+// runStep run fn until it returns or until context is done (canceled or timed out),
+// fn can't be stopped and goes on in background when context is done first
+func runStep(ctx context.Context, fn func() error, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// buffered to let fn end even when nobody waits for it anymore
+	result := make(chan error, 1)
+	go func() {
+		result <- fn()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
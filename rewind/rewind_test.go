@@ -1,167 +1,250 @@
 package rewind_test
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
-	"github.com/contraband/autopilot/rewind"
+	"github.com/orange-cloudfoundry/terraform-provider-cloudfoundry/rewind"
 )
 
-var _ = Describe("Rewind", func() {
-	It("runs through all actions if they're all successful", func() {
-		firstRun := false
-		secondRun := false
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) step(name string, err error) func() error {
+	return func() error {
+		r.calls = append(r.calls, name)
+		return err
+	}
+}
+
+// blockingStep never returns, it can only be interrupted.
+// It is not recorded as it runs concurrently with next calls.
+func blockingStep() error {
+	select {}
+}
+
+type rewindEntry struct {
+	description     string
+	actions         func(r *recorder) rewind.Actions
+	expectedCalls   []string
+	expectedErr     string
+	expectedSteps   []int
+	expectedReverse []int
+}
 
-		actions := rewind.Actions{
-			Actions: []rewind.Action{
-				{
-					Forward: func() error {
-						firstRun = true
-						return nil
+var _ = Describe("Rewind", func() {
+	entries := []rewindEntry{
+		{
+			description: "runs through all actions if they're all successful",
+			actions: func(r *recorder) rewind.Actions {
+				return rewind.Actions{
+					Actions: []rewind.Action{
+						{Forward: r.step("first", nil), Reverse: r.step("first reverse", nil)},
+						{Forward: r.step("second", nil), Reverse: r.step("second reverse", nil)},
 					},
-				},
-				{
-					Forward: func() error {
-						secondRun = true
-						return nil
+				}
+			},
+			expectedCalls: []string{"first", "second"},
+		},
+		{
+			description: "stops and runs the rewind of an action if it fails",
+			actions: func(r *recorder) rewind.Actions {
+				return rewind.Actions{
+					Actions: []rewind.Action{
+						{Forward: r.step("first", nil)},
+						{Forward: r.step("second", errors.New("disaster")), ReversePrevious: r.step("second reverse previous", nil)},
+						{Forward: r.step("third", nil)},
 					},
-				},
+				}
 			},
-		}
-
-		err := actions.Execute()
-		Expect(err).ToNot(HaveOccurred())
-
-		Expect(firstRun).To(BeTrue())
-		Expect(secondRun).To(BeTrue())
-	})
-
-	It("stops and runs the rewind of an action if it fails", func() {
-		firstRun := false
-		secondRun := false
-		secondReverseRun := false
-		thirdRun := false
-
-		actions := rewind.Actions{
-			Actions: []rewind.Action{
-				{
-					Forward: func() error {
-						firstRun = true
-						return nil
+			expectedCalls:   []string{"first", "second", "second reverse previous"},
+			expectedErr:     "disaster",
+			expectedSteps:   []int{0},
+			expectedReverse: []int{},
+		},
+		{
+			description: "reverses all completed actions in reverse order",
+			actions: func(r *recorder) rewind.Actions {
+				return rewind.Actions{
+					Actions: []rewind.Action{
+						{Forward: r.step("first", nil), Reverse: r.step("first reverse", nil)},
+						{Forward: r.step("second", nil), Reverse: r.step("second reverse", nil)},
+						{Forward: r.step("third", nil)},
+						{
+							Forward:         r.step("fourth", errors.New("disaster")),
+							Reverse:         r.step("fourth reverse", nil),
+							ReversePrevious: r.step("fourth reverse previous", nil),
+						},
+						{Forward: r.step("fifth", nil), Reverse: r.step("fifth reverse", nil)},
 					},
-				},
-				{
-					Forward: func() error {
-						secondRun = true
-						return errors.New("disaster")
+				}
+			},
+			expectedCalls:   []string{"first", "second", "third", "fourth", "fourth reverse previous", "second reverse", "first reverse"},
+			expectedErr:     "disaster",
+			expectedSteps:   []int{0, 1, 2},
+			expectedReverse: []int{1, 0},
+		},
+		{
+			description: "keeps the error which triggered the rewind if the rewind action fails",
+			actions: func(r *recorder) rewind.Actions {
+				return rewind.Actions{
+					Actions: []rewind.Action{
+						{Forward: r.step("first", nil)},
+						{Forward: r.step("second", errors.New("disaster")), ReversePrevious: r.step("second reverse previous", errors.New("another disaster"))},
+						{Forward: r.step("third", nil)},
 					},
-					ReversePrevious: func() error {
-						secondReverseRun = true
-						return nil
+					RewindFailureMessage: "uh oh",
+				}
+			},
+			expectedCalls:   []string{"first", "second", "second reverse previous"},
+			expectedErr:     "uh oh: rewind of step 2: another disaster (rewind was triggered by error on step 2: disaster)",
+			expectedSteps:   []int{0},
+			expectedReverse: []int{},
+		},
+		{
+			description: "just returns the errors if a rewind fails with no reverse message",
+			actions: func(r *recorder) rewind.Actions {
+				return rewind.Actions{
+					Actions: []rewind.Action{
+						{Forward: r.step("first", nil)},
+						{Forward: r.step("second", errors.New("disaster")), ReversePrevious: r.step("second reverse previous", errors.New("another disaster"))},
+						{Forward: r.step("third", nil)},
 					},
-				},
-				{
-					Forward: func() error {
-						thirdRun = true
-						return nil
+				}
+			},
+			expectedCalls:   []string{"first", "second", "second reverse previous"},
+			expectedErr:     "rewind of step 2: another disaster (rewind was triggered by error on step 2: disaster)",
+			expectedSteps:   []int{0},
+			expectedReverse: []int{},
+		},
+		{
+			description: "goes on reversing when a reverse fails and aggregates all rewind errors",
+			actions: func(r *recorder) rewind.Actions {
+				return rewind.Actions{
+					Actions: []rewind.Action{
+						{Name: "rename", Forward: r.step("first", nil), Reverse: r.step("first reverse", errors.New("rename disaster"))},
+						{Forward: r.step("second", nil), Reverse: r.step("second reverse", nil)},
+						{Name: "create", Forward: r.step("third", nil), Reverse: r.step("third reverse", errors.New("create disaster"))},
+						{Name: "start", Forward: r.step("fourth", errors.New("disaster"))},
 					},
-				},
+					RewindFailureMessage: "uh oh",
+				}
 			},
-		}
-
-		err := actions.Execute()
-		Expect(err).To(MatchError("disaster"))
-
-		Expect(firstRun).To(BeTrue())
-		Expect(secondRun).To(BeTrue())
-		Expect(secondReverseRun).To(BeTrue())
-		Expect(thirdRun).To(BeFalse())
-	})
-
-	It("gives up if the rewind action fails", func() {
-		firstRun := false
-		secondRun := false
-		secondReverseRun := false
-		thirdRun := false
+			expectedCalls: []string{"first", "second", "third", "fourth", "third reverse", "second reverse", "first reverse"},
+			expectedErr: "uh oh: rewind of create: create disaster, rewind of rename: rename disaster " +
+				"(rewind was triggered by error on start: disaster)",
+			expectedSteps:   []int{0, 1, 2},
+			expectedReverse: []int{1},
+		},
+		{
+			description: "interrupts an action which blocks after its timeout and reverses it",
+			actions: func(r *recorder) rewind.Actions {
+				return rewind.Actions{
+					Actions: []rewind.Action{
+						{Forward: r.step("first", nil), Reverse: r.step("first reverse", nil)},
+						{
+							Forward:         blockingStep,
+							ReversePrevious: r.step("second reverse previous", nil),
+							Timeout:         10 * time.Millisecond,
+						},
+						{Forward: r.step("third", nil)},
+					},
+				}
+			},
+			expectedCalls:   []string{"first", "second reverse previous", "first reverse"},
+			expectedErr:     context.DeadlineExceeded.Error(),
+			expectedSteps:   []int{0},
+			expectedReverse: []int{0},
+		},
+	}
+	for _, entry := range entries {
+		entry := entry
+		It(entry.description, func() {
+			r := &recorder{calls: make([]string, 0)}
+
+			err := entry.actions(r).Execute()
+			Expect(r.calls).To(Equal(entry.expectedCalls))
+			if entry.expectedErr == "" {
+				Expect(err).ToNot(HaveOccurred())
+				return
+			}
+			Expect(err).To(MatchError(entry.expectedErr))
+			rewindErr, ok := err.(*rewind.Error)
+			Expect(ok).To(BeTrue())
+			Expect(rewindErr.CompletedSteps).To(Equal(entry.expectedSteps))
+			Expect(rewindErr.ReversedSteps).To(Equal(entry.expectedReverse))
+		})
+	}
+
+	It("notifies each completed action", func() {
+		r := &recorder{calls: make([]string, 0)}
+		completed := make([]string, 0)
 
 		actions := rewind.Actions{
 			Actions: []rewind.Action{
-				{
-					Forward: func() error {
-						firstRun = true
-						return nil
-					},
-				},
-				{
-					Forward: func() error {
-						secondRun = true
-						return errors.New("disaster")
-					},
-					ReversePrevious: func() error {
-						secondReverseRun = true
-						return errors.New("another disaster")
-					},
-				},
-				{
-					Forward: func() error {
-						thirdRun = true
-						return nil
-					},
-				},
+				{Name: "rename", Forward: r.step("first", nil)},
+				{Name: "create", Forward: r.step("second", nil)},
+				{Name: "start", Forward: r.step("third", errors.New("disaster"))},
+			},
+			OnStepCompleted: func(step int, action rewind.Action) {
+				completed = append(completed, action.Name)
 			},
-			RewindFailureMessage: "uh oh",
 		}
-
 		err := actions.Execute()
-		Expect(err).To(MatchError("uh oh: another disaster"))
-
-		Expect(firstRun).To(BeTrue())
-		Expect(secondRun).To(BeTrue())
-		Expect(secondReverseRun).To(BeTrue())
-		Expect(thirdRun).To(BeFalse())
+		Expect(err).To(MatchError("disaster"))
+		Expect(completed).To(Equal([]string{"rename", "create"}))
 	})
 
-	It("just returns the error if a rewind fails with no reverse message", func() {
-		firstRun := false
-		secondRun := false
-		secondReverseRun := false
-		thirdRun := false
+	Context("with a context", func() {
+		It("doesn't run any action if context is already canceled", func() {
+			r := &recorder{calls: make([]string, 0)}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
 
-		actions := rewind.Actions{
-			Actions: []rewind.Action{
-				{
-					Forward: func() error {
-						firstRun = true
-						return nil
-					},
+			actions := rewind.Actions{
+				Actions: []rewind.Action{
+					{Forward: r.step("first", nil), ReversePrevious: r.step("first reverse previous", nil)},
 				},
-				{
-					Forward: func() error {
-						secondRun = true
-						return errors.New("disaster")
-					},
-					ReversePrevious: func() error {
-						secondReverseRun = true
-						return errors.New("another disaster")
+			}
+			err := actions.ExecuteContext(ctx)
+			Expect(err).To(MatchError(context.Canceled.Error()))
+			Expect(r.calls).To(BeEmpty())
+		})
+		It("interrupts running action and reverses it with completed actions when context is canceled", func() {
+			r := &recorder{calls: make([]string, 0)}
+			ctx, cancel := context.WithCancel(context.Background())
+			actions := rewind.Actions{
+				Actions: []rewind.Action{
+					{Forward: r.step("first", nil), Reverse: r.step("first reverse", nil)},
+					{
+						Forward: func() error {
+							r.calls = append(r.calls, "second")
+							cancel()
+							select {}
+						},
+						Reverse:         r.step("second reverse", nil),
+						ReversePrevious: r.step("second reverse previous", nil),
 					},
+					{Forward: r.step("third", nil)},
 				},
-				{
-					Forward: func() error {
-						thirdRun = true
-						return nil
-					},
+			}
+			err := actions.ExecuteContext(ctx)
+			Expect(err).To(MatchError(context.Canceled.Error()))
+			Expect(r.calls).To(Equal([]string{"first", "second", "second reverse previous", "first reverse"}))
+			Expect(err.(*rewind.Error).ForwardError.Step).To(Equal(1))
+		})
+		It("gives error of an action which failed before its timeout", func() {
+			actions := rewind.Actions{
+				Actions: []rewind.Action{
+					{Forward: func() error { return errors.New("disaster") }, Timeout: time.Minute},
 				},
-			},
-		}
-
-		err := actions.Execute()
-		Expect(err).To(MatchError("another disaster"))
-
-		Expect(firstRun).To(BeTrue())
-		Expect(secondRun).To(BeTrue())
-		Expect(secondReverseRun).To(BeTrue())
-		Expect(thirdRun).To(BeFalse())
+			}
+			Expect(actions.Execute()).To(MatchError("disaster"))
+		})
 	})
 })